@@ -0,0 +1,52 @@
+package cmd
+
+import (
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/viper"
+	"github.com/tmoneypenny/conspirator/internal/pkg/acme"
+	"github.com/tmoneypenny/conspirator/internal/pkg/bind"
+)
+
+// acmeChallengeTTL is the TTL of DNS-01 challenge records
+const acmeChallengeTTL = 60
+
+// zoneProvider publishes DNS-01 challenges in the zone store
+type zoneProvider struct{}
+
+func (zoneProvider) Present(fqdn, value string) error {
+	return bind.AddTXT(fqdn, value, acmeChallengeTTL)
+}
+
+func (zoneProvider) CleanUp(fqdn, value string) error {
+	bind.RemoveTXT(fqdn, value)
+	return nil
+}
+
+// configureACME returns a certificate manager for the configured
+// zones or nil if ACME is disabled
+func configureACME() *acme.Manager {
+	if !viper.GetBool("acme.enable") {
+		return nil
+	}
+
+	directory := viper.GetString("acme.directory")
+	email := viper.GetString("acme.email")
+	accountKey := viper.GetString("acme.accountKey")
+	certDirectory := viper.GetString("acme.certDirectory")
+	caFile := viper.GetString("acme.caFile")
+
+	manager, err := acme.NewManager(&acme.ACMEConfig{
+		DirectoryURL:   &directory,
+		Email:          &email,
+		AccountKeyFile: &accountKey,
+		CertDirectory:  &certDirectory,
+		CAFile:         &caFile,
+		RenewBefore:    viper.GetDuration("acme.renewBefore"),
+		Zones:          viper.GetStringSlice("dns.zones"),
+		Provider:       zoneProvider{},
+	})
+	if err != nil {
+		log.Fatal().Msgf("failed to configure ACME: %v", err)
+	}
+	return manager
+}
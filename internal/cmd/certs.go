@@ -0,0 +1,67 @@
+package cmd
+
+import (
+	"crypto/tls"
+
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/viper"
+	"github.com/tmoneypenny/conspirator/internal/pkg/acme"
+	"github.com/tmoneypenny/conspirator/internal/pkg/bind"
+	"github.com/tmoneypenny/conspirator/internal/pkg/certs"
+	"github.com/tmoneypenny/conspirator/internal/pkg/http"
+)
+
+// configureCertificates returns the certificate manager shared by all
+// TLS listeners. It loads the key pairs listed in certificates, the
+// ACME certificates and the key pairs of the listeners
+func configureCertificates(httpConfig *http.HTTPServerConfig, bindConfig *bind.BindConfig, acmeManager *acme.Manager) *certs.Manager {
+	manager, err := certs.NewManager()
+	if err != nil {
+		log.Fatal().Msgf("failed to start certificate manager: %v", err)
+	}
+
+	// field names in the config match CertificateKeyPair case-insensitively
+	var pairs []CertificateKeyPair
+	if err := viper.UnmarshalKey("certificates", &pairs); err != nil {
+		log.Fatal().Msgf("failed to parse certificates: %v", err)
+	}
+	for _, p := range pairs {
+		if err := manager.AddKeyPair(p.PublicKey, p.PrivateKey); err != nil {
+			log.Fatal().Msgf("Cannot load KeyPair %s: %v", p.PublicKey, err)
+		}
+	}
+
+	// ACME certificates are loaded once they are obtained
+	if acmeManager != nil {
+		for _, p := range acmeManager.KeyPairs() {
+			if err := manager.AddKeyPair(p.CertFile, p.KeyFile); err != nil {
+				log.Debug().Msgf("no certificate for %s yet: %v", p.Zone, err)
+			}
+		}
+	}
+
+	// the key pair of a listener is optional if other certificates
+	// are configured
+	optional := acmeManager != nil || len(pairs) > 0
+	listenerCertificate := func(certFile, keyFile *string) func(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+		if *certFile == "" && !optional {
+			log.Fatal().Msg("Cannot load KeyPair: no key pair configured")
+		}
+		getCertificate, err := manager.Listener(*certFile, *keyFile)
+		if err != nil {
+			log.Fatal().Msgf("Cannot load KeyPair: %v", err)
+		}
+		return getCertificate
+	}
+
+	if httpConfig.TLS != nil {
+		httpConfig.TLS.GetCertificate = listenerCertificate(httpConfig.TLS.CertFile, httpConfig.TLS.KeyFile)
+	}
+	for i := range bindConfig.Configs {
+		if c := bindConfig.Configs[i].TLS; c != nil {
+			c.GetCertificate = listenerCertificate(c.CertFile, c.KeyFile)
+		}
+	}
+
+	return manager
+}
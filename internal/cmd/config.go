@@ -30,26 +30,101 @@ var configCmd = &cobra.Command{
 }
 
 type Configuration struct {
-	Domain           string            `json:"domain"`
-	PublicAddress    string            `json:"publicAddress"`
-	LogLevel         string            `json:"logLevel"`
-	PollingEncoding  string            `json:"pollingEncoding"`
-	MaxPollingEvents int               `json:"maxPollingEvents"`
-	HTTP             HTTPConfiguration `json:"http"`
-	DNS              DNSConfiguration  `json:"dns"`
-	PluginsDirectory string            `json:"pluginsDirectory"`
-	Plugin           Plugins           `json:"plugins"`
+	Domain           string               `json:"domain"`
+	PublicAddress    string               `json:"publicAddress"`
+	LogLevel         string               `json:"logLevel"`
+	PollingEncoding  string               `json:"pollingEncoding"`
+	MaxPollingEvents int                  `json:"maxPollingEvents"`
+	HTTP             HTTPConfiguration    `json:"http"`
+	DNS              DNSConfiguration     `json:"dns"`
+	ACME             *ACMEConfiguration   `json:"acme,omitempty"`
+	Certificates     []CertificateKeyPair `json:"certificates,omitempty"`
+	PluginsDirectory string               `json:"pluginsDirectory"`
+	Plugin           Plugins              `json:"plugins"`
+}
+
+type ACMEConfiguration struct {
+	Enable        bool   `json:"enable"`
+	Directory     string `json:"directory"`
+	Email         string `json:"email,omitempty"`
+	AccountKey    string `json:"accountKey"`
+	CertDirectory string `json:"certDirectory"`
+	CAFile        string `json:"caFile,omitempty"`
+	RenewBefore   string `json:"renewBefore,omitempty"`
+}
+
+// CertificateKeyPair is an additional certificate of the TLS listeners
+type CertificateKeyPair struct {
+	PublicKey  string `json:"publicKey"`
+	PrivateKey string `json:"privateKey"`
 }
 
 type DNSConfiguration struct {
-	Zones     []string       `json:"zones"`
-	Listeners []DNSListeners `json:"listeners"`
+	Zones        []string          `json:"zones"`
+	Defaults     []DNSDefaults     `json:"defaults,omitempty"`
+	ReverseZones []DNSReverseZones `json:"reverseZones,omitempty"`
+	DNSSEC       []DNSSEC          `json:"dnssec,omitempty"`
+	TSIG         []DNSTSIG         `json:"tsig,omitempty"`
+	Transfer     *DNSTransfer      `json:"transfer,omitempty"`
+	RateLimit    *DNSRateLimit     `json:"rateLimit,omitempty"`
+	Listeners    []DNSListeners    `json:"listeners"`
+}
+
+type DNSDefaults struct {
+	Zone         string   `json:"zone"`
+	TTL          uint32   `json:"ttl"`
+	A            string   `json:"a,omitempty"`
+	AAAA         string   `json:"aaaa,omitempty"`
+	TXT          []string `json:"txt,omitempty"`
+	MXPreference uint16   `json:"mxPreference"`
+	SRVPriority  uint16   `json:"srvPriority"`
+	SRVWeight    uint16   `json:"srvWeight"`
+	SRVPort      uint16   `json:"srvPort"`
+	NS           []string `json:"ns,omitempty"`
+	CAA          []string `json:"caa,omitempty"`
+}
+
+type DNSReverseZones struct {
+	Network string `json:"network"`
+	Zone    string `json:"zone,omitempty"`
+}
+
+type DNSSEC struct {
+	Zone      string `json:"zone"`
+	KeyFile   string `json:"keyFile"`
+	Algorithm string `json:"algorithm,omitempty"`
+	NSEC3     bool   `json:"nsec3"`
+}
+
+type DNSTSIG struct {
+	Name      string `json:"name"`
+	Algorithm string `json:"algorithm,omitempty"`
+	Secret    string `json:"secret"`
+}
+
+type DNSTransfer struct {
+	Allow     []string `json:"allow,omitempty"`
+	Keys      []string `json:"keys,omitempty"`
+	Notify    []string `json:"notify,omitempty"`
+	NotifyKey string   `json:"notifyKey,omitempty"`
+}
+
+type DNSRateLimit struct {
+	ResponsesPerSecond int      `json:"responsesPerSecond"`
+	Burst              int      `json:"burst,omitempty"`
+	Slip               int      `json:"slip"`
+	IPv4PrefixLength   int      `json:"ipv4PrefixLength,omitempty"`
+	IPv6PrefixLength   int      `json:"ipv6PrefixLength,omitempty"`
+	Exempt             []string `json:"exempt,omitempty"`
+	MaxPrefixes        int      `json:"maxPrefixes,omitempty"`
+	ExcludeLimited     bool     `json:"excludeLimited"`
 }
 
 type DNSListeners struct {
 	Address string                `json:"address"`
 	Proto   string                `json:"proto"`
 	Port    int                   `json:"port"`
+	Path    string                `json:"path,omitempty"` // doh only
 	TLS     *DNSTransportSecurity `json:"tls,omitempty"`
 }
 
@@ -65,6 +140,7 @@ type HTTPConfiguration struct {
 	CsrfKey      string                   `json:"csrfKey"`
 	SigningKey   string                   `json:"signingKey"`
 	TemplatePath string                   `json:"templatePath"`
+	RoutesFile   string                   `json:"routesFile,omitempty"`
 	Listeners    []HTTPListeners          `json:"listeners"`
 	Static       HTTPStaticConfigurration `json:"static"`
 }
@@ -106,6 +182,7 @@ func generateConfig() {
 			CsrfKey:      generateCredentials("csrfKey"),
 			SigningKey:   generateCredentials("signingKey"),
 			TemplatePath: "internal/pkg/http/template/",
+			RoutesFile:   "data/routes.json",
 			Static: HTTPStaticConfigurration{
 				Browsing: true,
 				Enable:   false,
@@ -128,6 +205,54 @@ func generateConfig() {
 		},
 		DNS: DNSConfiguration{
 			Zones: []string{"example.test.domain", "example2.test.domain"},
+			Defaults: []DNSDefaults{
+				{
+					Zone:         "example2.test.domain",
+					TTL:          30,
+					AAAA:         "::1",
+					TXT:          []string{"conspirator"},
+					MXPreference: 10,
+					SRVPriority:  10,
+					SRVWeight:    90,
+					SRVPort:      443,
+				},
+			},
+			ReverseZones: []DNSReverseZones{
+				{
+					Network: "192.0.2.0/24",
+					Zone:    "example.test.domain",
+				},
+			},
+			DNSSEC: []DNSSEC{
+				{
+					Zone:      "example.test.domain",
+					KeyFile:   "configs/Kexample.test.domain",
+					Algorithm: "ECDSAP256SHA256",
+				},
+			},
+			TSIG: []DNSTSIG{
+				{
+					Name:      "certbot",
+					Algorithm: "hmac-sha256",
+					Secret:    "c2VjcmV0LWtleS1yZXBsYWNlLW1lCg==",
+				},
+			},
+			Transfer: &DNSTransfer{
+				Allow:     []string{"192.0.2.53/32"},
+				Keys:      []string{"certbot"},
+				Notify:    []string{"192.0.2.53:53"},
+				NotifyKey: "certbot",
+			},
+			RateLimit: &DNSRateLimit{
+				ResponsesPerSecond: 20,
+				Burst:              100,
+				Slip:               2,
+				IPv4PrefixLength:   24,
+				IPv6PrefixLength:   56,
+				Exempt:             []string{"192.0.2.53/32"},
+				MaxPrefixes:        100000,
+				ExcludeLimited:     true,
+			},
 			Listeners: []DNSListeners{
 				{
 					Address: "",
@@ -148,6 +273,30 @@ func generateConfig() {
 						PrivateKey: "/usr/local/share/certs/star.example.test.domain/privkey.pem",
 					},
 				},
+				{
+					Address: "",
+					Proto:   "doh",
+					Port:    8443,
+					Path:    "/dns-query",
+					TLS: &DNSTransportSecurity{
+						PublicKey:  "/usr/local/share/certs/star.example.test.domain/fullchain.pem",
+						PrivateKey: "/usr/local/share/certs/star.example.test.domain/privkey.pem",
+					},
+				},
+			},
+		},
+		ACME: &ACMEConfiguration{
+			Enable:        false,
+			Directory:     "https://acme-v02.api.letsencrypt.org/directory",
+			Email:         "admin@example.test.domain",
+			AccountKey:    "/usr/local/share/certs/acme/account.key",
+			CertDirectory: "/usr/local/share/certs/acme",
+			RenewBefore:   "720h",
+		},
+		Certificates: []CertificateKeyPair{
+			{
+				PublicKey:  "/usr/local/share/certs/star.example.other.domain/fullchain.pem",
+				PrivateKey: "/usr/local/share/certs/star.example.other.domain/privkey.pem",
 			},
 		},
 		PluginsDirectory: "plugins/",
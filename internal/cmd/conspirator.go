@@ -47,17 +47,19 @@ that contains some enhanced functionality useful in for testing.`, ProjectName),
 // add command for profile
 func init() {
 	// global flags
+	rootCmd.PersistentFlags().StringP("config", "c", "",
+		fmt.Sprintf("config file (default is $HOME/%s/configs/%s.config)", ProjectName, ProjectName))
 
 	// cmd Flags
-	startCmd.Flags().StringP("config", "c", "",
-		fmt.Sprintf("config file (default is $HOME/%s/configs/%s.config)", ProjectName, ProjectName))
 	startCmd.Flags().BoolP("profile", "p", false, "enable profiler")
 
+	viper.BindPFlags(rootCmd.PersistentFlags())
 	viper.BindPFlags(startCmd.Flags())
 
 	// Add sub-commands
 	rootCmd.AddCommand(startCmd)
 	rootCmd.AddCommand(configCmd)
+	rootCmd.AddCommand(dnssecCmd)
 
 	// prevent init for root help cmd
 	if rootCmd.Use == ProjectName {
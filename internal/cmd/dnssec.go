@@ -0,0 +1,44 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+	"github.com/tmoneypenny/conspirator/internal/pkg/bind"
+)
+
+var dnssecCmd = &cobra.Command{
+	Use:   "dnssec",
+	Short: "Manage DNSSEC keys",
+	Run: func(cmd *cobra.Command, args []string) {
+		cmd.Help()
+	},
+}
+
+var dsCmd = &cobra.Command{
+	Use:   "ds",
+	Short: "Print the DS records to add at the parent zones",
+	Long: `Prints the DS record of each zone in dns.dnssec. Keys that do not
+exist are generated at the configured keyFile.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		zones := configureDNSSEC()
+		if len(zones) == 0 {
+			fmt.Fprintln(os.Stderr, "no zones configured in dns.dnssec")
+			os.Exit(1)
+		}
+
+		for _, z := range zones {
+			ds, err := bind.DS(z)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "failed to create DS record: %v\n", err)
+				os.Exit(1)
+			}
+			fmt.Println(ds)
+		}
+	},
+}
+
+func init() {
+	dnssecCmd.AddCommand(dsCmd)
+}
@@ -12,6 +12,7 @@ import (
 	"github.com/rs/zerolog/log"
 	"github.com/spf13/viper"
 	"github.com/tmoneypenny/conspirator/internal/pkg/bind"
+	"github.com/tmoneypenny/conspirator/internal/pkg/certs"
 	"github.com/tmoneypenny/conspirator/internal/pkg/http"
 	"github.com/tmoneypenny/conspirator/internal/pkg/polling"
 	"github.com/tmoneypenny/conspirator/pkg/wrapper"
@@ -40,9 +41,13 @@ func configureBind() *bind.BindConfig {
 			Net:     &proto,
 		})
 
+		if path, ok := v.(map[string]interface{})["path"].(string); ok {
+			bindServers[i].Path = &path
+		}
+
 		if tls != nil {
-			cert := tls.(map[string]interface{})["publicKey"].(string)
-			pk := tls.(map[string]interface{})["privateKey"].(string)
+			cert, _ := tls.(map[string]interface{})["publicKey"].(string)
+			pk, _ := tls.(map[string]interface{})["privateKey"].(string)
 			bindServers[i].TLS = &bind.TLSConfig{
 				CertFile: &cert,
 				KeyFile:  &pk,
@@ -50,13 +55,60 @@ func configureBind() *bind.BindConfig {
 		}
 	}
 
+	// field names in the config match DefaultProfile case-insensitively
+	var defaults []bind.DefaultProfile
+	if err := viper.UnmarshalKey("dns.defaults", &defaults); err != nil {
+		log.Fatal().Msgf("failed to parse dns.defaults: %v", err)
+	}
+
+	var reverseZones []bind.ReverseZone
+	if err := viper.UnmarshalKey("dns.reverseZones", &reverseZones); err != nil {
+		log.Fatal().Msgf("failed to parse dns.reverseZones: %v", err)
+	}
+
+	var tsig []bind.TSIGKey
+	if err := viper.UnmarshalKey("dns.tsig", &tsig); err != nil {
+		log.Fatal().Msgf("failed to parse dns.tsig: %v", err)
+	}
+
+	var transfer *bind.TransferConfig
+	if viper.IsSet("dns.transfer") {
+		transfer = &bind.TransferConfig{}
+		if err := viper.UnmarshalKey("dns.transfer", transfer); err != nil {
+			log.Fatal().Msgf("failed to parse dns.transfer: %v", err)
+		}
+	}
+
+	var rateLimit *bind.RateLimitConfig
+	if viper.IsSet("dns.rateLimit") {
+		rateLimit = &bind.RateLimitConfig{}
+		if err := viper.UnmarshalKey("dns.rateLimit", rateLimit); err != nil {
+			log.Fatal().Msgf("failed to parse dns.rateLimit: %v", err)
+		}
+	}
+
 	return &bind.BindConfig{
 		Zones:         viper.GetStringSlice("dns.zones"),
+		Defaults:      defaults,
+		ReverseZones:  reverseZones,
+		DNSSEC:        configureDNSSEC(),
+		TSIG:          tsig,
+		Transfer:      transfer,
+		RateLimit:     rateLimit,
 		Configs:       bindServers,
 		PublicAddress: viper.GetString("publicAddress"),
 	}
 }
 
+// configureDNSSEC parses the zones to sign
+func configureDNSSEC() []bind.DNSSECConfig {
+	var dnssec []bind.DNSSECConfig
+	if err := viper.UnmarshalKey("dns.dnssec", &dnssec); err != nil {
+		log.Fatal().Msgf("failed to parse dns.dnssec: %v", err)
+	}
+	return dnssec
+}
+
 func configureHTTP() *http.HTTPServerConfig {
 	v := viper.Get("http.listeners").([]interface{})
 	address := v[0].(map[string]interface{})["address"].(string)
@@ -82,8 +134,9 @@ func configureHTTP() *http.HTTPServerConfig {
 	}
 
 	if tls != nil {
-		cert := tls.(map[string]interface{})["publicKey"].(string)
-		pk := tls.(map[string]interface{})["privateKey"].(string)
+		// the key pair is optional if ACME provides certificates
+		cert, _ := tls.(map[string]interface{})["publicKey"].(string)
+		pk, _ := tls.(map[string]interface{})["privateKey"].(string)
 		tlsPort := int(tls.(map[string]interface{})["port"].(float64))
 		server.TLS = &http.TLSConfig{
 			CertFile: &cert,
@@ -114,11 +167,20 @@ func serverHandler() {
 	httpConfig.PollingManager = manager
 	bindConfig.PollingManager = manager
 
+	// certificates are reloaded when renewed, e.g. by ACME
+	acmeManager := configureACME()
+	certManager := configureCertificates(httpConfig, bindConfig, acmeManager)
+	certManager.Start()
+
 	bind.BindServer(bindConfig).Start()
+	// challenges are answered by the DNS server
+	if acmeManager != nil {
+		acmeManager.Start()
+	}
 	http.HTTPServer(httpConfig).Start()
 
 	extShutdown := make(chan bool)
-	go extensionHandler(manager, extShutdown)
+	go extensionHandler(manager, certManager, extShutdown)
 
 	c := make(chan os.Signal, 1)
 	signal.Notify(c, os.Interrupt)
@@ -129,10 +191,14 @@ func serverHandler() {
 	defer func() {
 		log.Info().Msg("Shutting down services...")
 		http.HTTPServer(httpConfig).Stop()
+		if acmeManager != nil {
+			acmeManager.Stop()
+		}
 		bind.BindServer(bindConfig).Stop()
 		extShutdown <- true // Initial plugin shutdown
 		<-extShutdown       // Wait for shutdown
 		manager.Stop()      // Stop polling server
+		certManager.Stop()
 		log.Info().Msg("Bye!")
 	}()
 }
@@ -143,10 +209,11 @@ func serverHandler() {
 // ExtensionPlugins
 type ExtensionPlugins struct {
 	PollingServer *polling.PollingServer
+	Certificates  *certs.Manager
 }
 
 // extensionHandler is used to load modules defined in the config
-func extensionHandler(pollingServer *polling.PollingServer, shutdown chan bool) {
+func extensionHandler(pollingServer *polling.PollingServer, certManager *certs.Manager, shutdown chan bool) {
 	log.Debug().Msg("Starting extension handler...")
 
 	plugins := viper.Get("plugins")
@@ -154,6 +221,7 @@ func extensionHandler(pollingServer *polling.PollingServer, shutdown chan bool)
 
 	extensions := ExtensionPlugins{
 		PollingServer: pollingServer,
+		Certificates:  certManager,
 	}
 
 	for k := range plugins.(map[string]interface{}) {
@@ -185,6 +253,7 @@ func (e *ExtensionPlugins) extensionLoader(pluginName string) {
 	// Start Server
 	server.(func(cfg wrapper.Config) wrapper.Module)(wrapper.Config{
 		PollingManager: e.PollingServer,
+		Certificates:   e.Certificates,
 	}).Start()
 
 }
@@ -0,0 +1,80 @@
+package acme
+
+import (
+	"time"
+)
+
+// Manager is a facade to obtain and renew certificates
+type Manager struct {
+	issuer *issuer
+}
+
+// DNSProvider publishes the TXT records of DNS-01 challenges
+type DNSProvider interface {
+	Present(fqdn, value string) error
+	CleanUp(fqdn, value string) error
+}
+
+// ACMEConfig holds the ACME account and the zones to
+// obtain wildcard certificates for
+type ACMEConfig struct {
+	// DirectoryURL is the ACME directory of the CA. Defaults to
+	// the Let's Encrypt production directory
+	DirectoryURL *string
+	Email        *string // Optional. Contact address of the account
+	// AccountKeyFile is the PEM encoded account key. The key is
+	// generated if the file does not exist
+	AccountKeyFile *string
+	// CertDirectory stores the certificate of each zone in
+	// <zone>/fullchain.pem and <zone>/privkey.pem
+	CertDirectory *string
+	// CAFile is an optional PEM bundle of CAs trusted for the
+	// directory, e.g. the pebble.minica.pem of a local pebble
+	CAFile      *string
+	RenewBefore time.Duration // Optional. Defaults to 30 days
+	Zones       []string
+	Provider    DNSProvider
+}
+
+// NewManager loads the account and the stored certificates
+func NewManager(cfg *ACMEConfig) (*Manager, error) {
+	i, err := newIssuer(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Manager{issuer: i}, nil
+}
+
+// Start obtains missing certificates and renews them before they
+// expire in the background
+func (m *Manager) Start() {
+	m.issuer.start()
+}
+
+// Stop stops renewing certificates
+func (m *Manager) Stop() {
+	m.issuer.stop()
+}
+
+// KeyPair is the location of the certificate of a zone
+type KeyPair struct {
+	Zone     string
+	CertFile string
+	KeyFile  string
+}
+
+// KeyPairs returns the files of the zone certificates. Certificates
+// are written to the files when they are obtained, so the files do
+// not exist until the first certificate of a zone is obtained
+func (m *Manager) KeyPairs() []KeyPair {
+	var pairs []KeyPair
+	for _, zone := range m.issuer.zones {
+		pairs = append(pairs, KeyPair{
+			Zone:     zone,
+			CertFile: m.issuer.certPath(zone, certFile),
+			KeyFile:  m.issuer.certPath(zone, keyFile),
+		})
+	}
+	return pairs
+}
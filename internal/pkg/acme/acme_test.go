@@ -0,0 +1,330 @@
+package acme
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tmoneypenny/conspirator/internal/pkg/util"
+)
+
+// fakeProvider stores the published challenge records
+type fakeProvider struct {
+	mutex   sync.Mutex
+	records map[string][]string
+}
+
+func (p *fakeProvider) Present(fqdn, value string) error {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.records[fqdn] = append(p.records[fqdn], value)
+	return nil
+}
+
+func (p *fakeProvider) CleanUp(fqdn, value string) error {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	var kept []string
+	for _, v := range p.records[fqdn] {
+		if v != value {
+			kept = append(kept, v)
+		}
+	}
+	p.records[fqdn] = kept
+	return nil
+}
+
+func (p *fakeProvider) has(fqdn, value string) bool {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	for _, v := range p.records[fqdn] {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+type fakeAuthz struct {
+	domain string
+	token  string
+	status string
+}
+
+type fakeOrder struct {
+	authz  []int
+	status string
+	cert   []byte
+}
+
+// fakeCA implements the parts of RFC 8555 used by the issuer. The
+// challenge is valid if the provider published the key authorization
+type fakeCA struct {
+	*httptest.Server
+	provider *fakeProvider
+	keyAuth  func(token string) (string, error)
+	caKey    *ecdsa.PrivateKey
+	caCert   *x509.Certificate
+	mutex    sync.Mutex
+	authz    []*fakeAuthz
+	orders   []*fakeOrder
+}
+
+func newFakeCA(t *testing.T, provider *fakeProvider) *fakeCA {
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "fake CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(24 * time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	assert.NoError(t, err)
+	caCert, _ := x509.ParseCertificate(der)
+
+	ca := &fakeCA{provider: provider, caKey: key, caCert: caCert}
+	ca.Server = httptest.NewTLSServer(http.HandlerFunc(ca.serveHTTP))
+	t.Cleanup(ca.Close)
+	return ca
+}
+
+// payload returns the decoded payload of the JWS request body
+func payload(r *http.Request) []byte {
+	var jws struct{ Payload string }
+	json.NewDecoder(r.Body).Decode(&jws)
+	data, _ := base64.RawURLEncoding.DecodeString(jws.Payload)
+	return data
+}
+
+func (ca *fakeCA) orderJSON(id int) map[string]interface{} {
+	o := ca.orders[id]
+	var authz []string
+	for _, a := range o.authz {
+		authz = append(authz, fmt.Sprintf("%s/authz/%d", ca.URL, a))
+	}
+	v := map[string]interface{}{
+		"status":         o.status,
+		"authorizations": authz,
+		"finalize":       fmt.Sprintf("%s/finalize/%d", ca.URL, id),
+	}
+	if o.cert != nil {
+		v["certificate"] = fmt.Sprintf("%s/cert/%d", ca.URL, id)
+	}
+	return v
+}
+
+func (ca *fakeCA) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	ca.mutex.Lock()
+	defer ca.mutex.Unlock()
+
+	w.Header().Set("Replay-Nonce", fmt.Sprintf("nonce-%d", time.Now().UnixNano()))
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/"), "/")
+	var id int
+	if len(parts) > 1 {
+		fmt.Sscan(parts[1], &id)
+	}
+
+	var v interface{}
+	switch parts[0] {
+	case "dir":
+		v = map[string]string{
+			"newNonce":   ca.URL + "/nonce",
+			"newAccount": ca.URL + "/account",
+			"newOrder":   ca.URL + "/order",
+		}
+	case "nonce":
+		return
+	case "account":
+		w.Header().Set("Location", ca.URL+"/account/1")
+		w.WriteHeader(http.StatusCreated)
+		v = map[string]string{"status": "valid"}
+	case "order":
+		if len(parts) == 1 {
+			var req struct{ Identifiers []struct{ Value string } }
+			json.Unmarshal(payload(r), &req)
+
+			o := &fakeOrder{status: "pending"}
+			for _, ident := range req.Identifiers {
+				o.authz = append(o.authz, len(ca.authz))
+				ca.authz = append(ca.authz, &fakeAuthz{
+					domain: ident.Value,
+					token:  fmt.Sprintf("token%d", len(ca.authz)),
+					status: "pending",
+				})
+			}
+			ca.orders = append(ca.orders, o)
+			id = len(ca.orders) - 1
+			w.Header().Set("Location", fmt.Sprintf("%s/order/%d", ca.URL, id))
+			w.WriteHeader(http.StatusCreated)
+		}
+		v = ca.orderJSON(id)
+	case "authz", "chal":
+		a := ca.authz[id]
+		if parts[0] == "chal" {
+			value, _ := ca.keyAuth(a.token)
+			if ca.provider.has(challengePrefix+strings.TrimPrefix(a.domain, "*."), value) {
+				a.status = "valid"
+			} else {
+				a.status = "invalid"
+			}
+			for _, o := range ca.orders {
+				ready := true
+				for _, i := range o.authz {
+					ready = ready && ca.authz[i].status == "valid"
+				}
+				if ready && o.status == "pending" {
+					o.status = "ready"
+				}
+			}
+		}
+		challenge := map[string]string{
+			"type":   "dns-01",
+			"url":    fmt.Sprintf("%s/chal/%d", ca.URL, id),
+			"token":  a.token,
+			"status": a.status,
+		}
+		if parts[0] == "chal" {
+			v = challenge
+		} else {
+			v = map[string]interface{}{
+				"status":     a.status,
+				"identifier": map[string]string{"type": "dns", "value": a.domain},
+				"challenges": []interface{}{challenge},
+			}
+		}
+	case "finalize":
+		var req struct{ CSR string }
+		json.Unmarshal(payload(r), &req)
+		der, _ := base64.RawURLEncoding.DecodeString(req.CSR)
+		csr, _ := x509.ParseCertificateRequest(der)
+
+		leaf, _ := x509.CreateCertificate(rand.Reader, &x509.Certificate{
+			SerialNumber: big.NewInt(int64(id + 2)),
+			DNSNames:     csr.DNSNames,
+			NotBefore:    time.Now().Add(-time.Hour),
+			NotAfter:     time.Now().Add(90 * 24 * time.Hour),
+		}, ca.caCert, csr.PublicKey, ca.caKey)
+		ca.orders[id].status = "valid"
+		ca.orders[id].cert = append(
+			pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: leaf}),
+			pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ca.caCert.Raw})...,
+		)
+		w.Header().Set("Location", fmt.Sprintf("%s/order/%d", ca.URL, id))
+		v = ca.orderJSON(id)
+	case "cert":
+		w.Header().Set("Content-Type", "application/pem-certificate-chain")
+		w.Write(ca.orders[id].cert)
+		return
+	default:
+		http.NotFound(w, r)
+		return
+	}
+
+	json.NewEncoder(w).Encode(v)
+}
+
+// newTestIssuer returns an issuer for src.properties that trusts the
+// fake CA
+func newTestIssuer(t *testing.T, dir string) (*issuer, *fakeCA, *fakeProvider) {
+	provider := &fakeProvider{records: make(map[string][]string)}
+	ca := newFakeCA(t, provider)
+
+	caFile := filepath.Join(dir, "ca.pem")
+	assert.NoError(t, ioutil.WriteFile(caFile, pem.EncodeToMemory(&pem.Block{
+		Type:  "CERTIFICATE",
+		Bytes: ca.Certificate().Raw,
+	}), 0600))
+
+	i, err := newIssuer(&ACMEConfig{
+		DirectoryURL:   util.StrToPtr(ca.URL + "/dir"),
+		AccountKeyFile: util.StrToPtr(filepath.Join(dir, "account.key")),
+		CertDirectory:  util.StrToPtr(dir),
+		CAFile:         &caFile,
+		Zones:          []string{"src.properties."},
+		Provider:       provider,
+	})
+	assert.NoError(t, err)
+	ca.keyAuth = i.client.DNS01ChallengeRecord
+	return i, ca, provider
+}
+
+func TestObtain(t *testing.T) {
+	dir := t.TempDir()
+	i, ca, provider := newTestIssuer(t, dir)
+	assert.True(t, i.needsRenewal("src.properties", time.Now()))
+
+	assert.NoError(t, i.renew())
+	assert.Len(t, ca.orders, 1)
+	assert.Empty(t, provider.records[challengePrefix+"src.properties"])
+
+	cert, err := tls.LoadX509KeyPair(filepath.Join(dir, "src.properties", certFile), filepath.Join(dir, "src.properties", keyFile))
+	assert.NoError(t, err)
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"src.properties", "*.src.properties"}, leaf.DNSNames)
+	assert.False(t, i.needsRenewal("src.properties", time.Now()))
+	assert.True(t, i.needsRenewal("src.properties", time.Now().Add(80*24*time.Hour)))
+
+	// valid certificates are not renewed
+	assert.NoError(t, i.renew())
+	assert.Len(t, ca.orders, 1)
+
+	// the account key and certificate are reused after a restart
+	_, err = os.Stat(filepath.Join(dir, "src.properties", certFile))
+	assert.NoError(t, err)
+	restarted, err := newIssuer(&ACMEConfig{
+		AccountKeyFile: util.StrToPtr(filepath.Join(dir, "account.key")),
+		CertDirectory:  util.StrToPtr(dir),
+		Zones:          []string{"src.properties"},
+		Provider:       provider,
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, i.client.Key, restarted.client.Key)
+	assert.False(t, restarted.needsRenewal("src.properties", time.Now()))
+}
+
+func TestObtainFailure(t *testing.T) {
+	i, ca, _ := newTestIssuer(t, t.TempDir())
+
+	// the CA rejects challenges that were not published
+	ca.keyAuth = func(token string) (string, error) { return "wrong", nil }
+	assert.Error(t, i.renew())
+	assert.True(t, i.needsRenewal("src.properties", time.Now()))
+}
+
+func TestNewIssuer(t *testing.T) {
+	_, err := newIssuer(&ACMEConfig{Zones: []string{"src.properties"}, Provider: &fakeProvider{}})
+	assert.Error(t, err)
+
+	dir := t.TempDir()
+	keyFile := filepath.Join(dir, "account.key")
+	assert.NoError(t, ioutil.WriteFile(keyFile, []byte("not a key"), 0600))
+	_, err = newIssuer(&ACMEConfig{
+		AccountKeyFile: &keyFile,
+		CertDirectory:  &dir,
+		Zones:          []string{"src.properties"},
+		Provider:       &fakeProvider{},
+	})
+	assert.Error(t, err)
+}
@@ -0,0 +1,408 @@
+package acme
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"golang.org/x/crypto/acme"
+)
+
+const (
+	challengePrefix    = "_acme-challenge."
+	defaultRenewBefore = 30 * 24 * time.Hour
+	renewCheckInterval = 12 * time.Hour
+	renewRetryInterval = time.Hour
+	obtainTimeout      = 5 * time.Minute
+	certFile           = "fullchain.pem"
+	keyFile            = "privkey.pem"
+)
+
+// Errors
+var (
+	invalidACMEConfig error = fmt.Errorf("Invalid ACME configuration")
+	invalidCAFile     error = fmt.Errorf("No certificates found in CA file")
+	noDNS01Challenge  error = fmt.Errorf("CA did not offer a dns-01 challenge")
+)
+
+// issuer obtains a wildcard certificate for each zone
+type issuer struct {
+	client      *acme.Client
+	email       string
+	certDir     string
+	renewBefore time.Duration
+	zones       []string
+	provider    DNSProvider
+	mutex       *sync.RWMutex
+	certs       map[string]*tls.Certificate // mapped by zone, only used for renewal
+	done        chan struct{}
+	wg          sync.WaitGroup
+}
+
+// newIssuer validates the config, loads or generates the account key
+// and loads certificates stored by a previous run
+func newIssuer(cfg *ACMEConfig) (*issuer, error) {
+	if cfg.AccountKeyFile == nil || *cfg.AccountKeyFile == "" ||
+		cfg.CertDirectory == nil || *cfg.CertDirectory == "" ||
+		cfg.Provider == nil || len(cfg.Zones) == 0 {
+		return nil, invalidACMEConfig
+	}
+
+	key, err := loadAccountKey(*cfg.AccountKeyFile)
+	if err != nil {
+		return nil, err
+	}
+
+	client := &acme.Client{
+		Key:          key,
+		DirectoryURL: acme.LetsEncryptURL,
+		UserAgent:    "conspirator",
+	}
+	if cfg.DirectoryURL != nil && *cfg.DirectoryURL != "" {
+		client.DirectoryURL = *cfg.DirectoryURL
+	}
+	if cfg.CAFile != nil && *cfg.CAFile != "" {
+		if client.HTTPClient, err = newHTTPClient(*cfg.CAFile); err != nil {
+			return nil, err
+		}
+	}
+
+	i := &issuer{
+		client:      client,
+		certDir:     *cfg.CertDirectory,
+		renewBefore: cfg.RenewBefore,
+		provider:    cfg.Provider,
+		mutex:       &sync.RWMutex{},
+		certs:       make(map[string]*tls.Certificate),
+		done:        make(chan struct{}),
+	}
+	if cfg.Email != nil {
+		i.email = *cfg.Email
+	}
+	if i.renewBefore <= 0 {
+		i.renewBefore = defaultRenewBefore
+	}
+
+	for _, z := range cfg.Zones {
+		zone := strings.ToLower(strings.TrimSuffix(z, "."))
+		i.zones = append(i.zones, zone)
+
+		// the directory is watched for new certificates
+		if err := os.MkdirAll(filepath.Join(i.certDir, zone), 0700); err != nil {
+			return nil, err
+		}
+
+		cert, err := tls.LoadX509KeyPair(i.certPath(zone, certFile), i.certPath(zone, keyFile))
+		if err != nil {
+			log.Debug().Msgf("no stored certificate for %s: %v", zone, err)
+			continue
+		}
+		if cert.Leaf, err = x509.ParseCertificate(cert.Certificate[0]); err != nil {
+			return nil, err
+		}
+		i.certs[zone] = &cert
+	}
+	sort.Strings(i.zones)
+
+	return i, nil
+}
+
+// newHTTPClient trusts the CAs in the PEM bundle for the directory
+func newHTTPClient(caFile string) (*http.Client, error) {
+	data, err := ioutil.ReadFile(caFile)
+	if err != nil {
+		return nil, err
+	}
+
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(data) {
+		return nil, invalidCAFile
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = &tls.Config{RootCAs: pool}
+	return &http.Client{Transport: transport}, nil
+}
+
+// loadAccountKey reads the PEM encoded account key or generates one
+func loadAccountKey(path string) (crypto.Signer, error) {
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		if err != nil {
+			return nil, err
+		}
+		if err := writeKey(path, key); err != nil {
+			return nil, err
+		}
+		log.Info().Msgf("generated ACME account key %s", path)
+		return key, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("%v: no PEM data in %s", invalidACMEConfig, path)
+	}
+	switch block.Type {
+	case "EC PRIVATE KEY":
+		return x509.ParseECPrivateKey(block.Bytes)
+	case "RSA PRIVATE KEY":
+		return x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "PRIVATE KEY":
+		key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		if signer, ok := key.(crypto.Signer); ok {
+			return signer, nil
+		}
+	}
+	return nil, fmt.Errorf("%v: unsupported key type %s", invalidACMEConfig, block.Type)
+}
+
+// writeKey stores the key as a PEM encoded EC private key
+func writeKey(path string, key *ecdsa.PrivateKey) error {
+	der, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return err
+	}
+	return writeFile(path, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der}))
+}
+
+// writeFile atomically replaces the file so that listeners never read
+// a partially written certificate
+func writeFile(path string, data []byte) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+
+	tmp := path + ".tmp"
+	if err := ioutil.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+func (i *issuer) certPath(zone, name string) string {
+	return filepath.Join(i.certDir, zone, name)
+}
+
+// start obtains and renews certificates until stop is called
+func (i *issuer) start() {
+	i.wg.Add(1)
+	go func() {
+		defer i.wg.Done()
+		for {
+			interval := renewCheckInterval
+			if err := i.renew(); err != nil {
+				log.Error().Msgf("failed to renew certificates: %v", err)
+				interval = renewRetryInterval
+			}
+
+			select {
+			case <-i.done:
+				return
+			case <-time.After(interval):
+			}
+		}
+	}()
+}
+
+func (i *issuer) stop() {
+	close(i.done)
+	i.wg.Wait()
+}
+
+// needsRenewal is true if the zone has no certificate or the
+// certificate expires within renewBefore
+func (i *issuer) needsRenewal(zone string, now time.Time) bool {
+	i.mutex.RLock()
+	cert, ok := i.certs[zone]
+	i.mutex.RUnlock()
+
+	return !ok || now.Add(i.renewBefore).After(cert.Leaf.NotAfter)
+}
+
+// renew obtains a certificate for every zone that needs one
+func (i *issuer) renew() error {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		select {
+		case <-i.done:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	if err := i.register(ctx); err != nil {
+		return err
+	}
+
+	var failed []string
+	for _, zone := range i.zones {
+		if !i.needsRenewal(zone, time.Now()) {
+			continue
+		}
+
+		log.Info().Msgf("obtaining certificate for %s", zone)
+		obtainCtx, obtainCancel := context.WithTimeout(ctx, obtainTimeout)
+		err := i.obtain(obtainCtx, zone)
+		obtainCancel()
+		if err != nil {
+			log.Error().Msgf("failed to obtain certificate for %s: %v", zone, err)
+			failed = append(failed, zone)
+			continue
+		}
+		log.Info().Msgf("obtained certificate for %s", zone)
+	}
+
+	if len(failed) > 0 {
+		return fmt.Errorf("failed zones: %s", strings.Join(failed, ", "))
+	}
+	return nil
+}
+
+// register creates the account. Existing accounts are reused
+func (i *issuer) register(ctx context.Context) error {
+	account := &acme.Account{}
+	if i.email != "" {
+		account.Contact = []string{"mailto:" + i.email}
+	}
+
+	if _, err := i.client.Register(ctx, account, acme.AcceptTOS); err != nil && err != acme.ErrAccountAlreadyExists {
+		return err
+	}
+	return nil
+}
+
+// obtain orders a certificate for the zone and its wildcard
+func (i *issuer) obtain(ctx context.Context, zone string) error {
+	order, err := i.client.AuthorizeOrder(ctx, acme.DomainIDs(zone, "*."+zone))
+	if err != nil {
+		return err
+	}
+
+	// both authorizations share the challenge name, so all records are
+	// published before any challenge is accepted
+	var presented []string
+	defer func() {
+		for _, value := range presented {
+			if err := i.provider.CleanUp(challengePrefix+zone, value); err != nil {
+				log.Warn().Msgf("failed to remove challenge of %s: %v", zone, err)
+			}
+		}
+	}()
+
+	var pending []*acme.Challenge
+	for _, url := range order.AuthzURLs {
+		authz, err := i.client.GetAuthorization(ctx, url)
+		if err != nil {
+			return err
+		}
+		if authz.Status == acme.StatusValid {
+			continue
+		}
+
+		var challenge *acme.Challenge
+		for _, c := range authz.Challenges {
+			if c.Type == "dns-01" {
+				challenge = c
+			}
+		}
+		if challenge == nil {
+			return noDNS01Challenge
+		}
+
+		value, err := i.client.DNS01ChallengeRecord(challenge.Token)
+		if err != nil {
+			return err
+		}
+		if err := i.provider.Present(challengePrefix+zone, value); err != nil {
+			return err
+		}
+		presented = append(presented, value)
+		pending = append(pending, challenge)
+	}
+
+	for _, challenge := range pending {
+		if _, err := i.client.Accept(ctx, challenge); err != nil {
+			return err
+		}
+	}
+	for _, url := range order.AuthzURLs {
+		if _, err := i.client.WaitAuthorization(ctx, url); err != nil {
+			return err
+		}
+	}
+
+	if _, err := i.client.WaitOrder(ctx, order.URI); err != nil {
+		return err
+	}
+
+	return i.finalize(ctx, zone, order)
+}
+
+// finalize submits the CSR and stores the certificate. Listeners
+// reload the stored files
+func (i *issuer) finalize(ctx context.Context, zone string, order *acme.Order) error {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return err
+	}
+
+	csr, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{
+		DNSNames: []string{zone, "*." + zone},
+	}, key)
+	if err != nil {
+		return err
+	}
+
+	der, _, err := i.client.CreateOrderCert(ctx, order.FinalizeURL, csr, true)
+	if err != nil {
+		return err
+	}
+
+	leaf, err := x509.ParseCertificate(der[0])
+	if err != nil {
+		return err
+	}
+
+	var chain []byte
+	for _, c := range der {
+		chain = append(chain, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: c})...)
+	}
+	if err := writeKey(i.certPath(zone, keyFile), key); err != nil {
+		return err
+	}
+	if err := writeFile(i.certPath(zone, certFile), chain); err != nil {
+		return err
+	}
+
+	i.mutex.Lock()
+	i.certs[zone] = &tls.Certificate{
+		Certificate: der,
+		PrivateKey:  key,
+		Leaf:        leaf,
+	}
+	i.mutex.Unlock()
+
+	return nil
+}
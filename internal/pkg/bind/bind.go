@@ -1,6 +1,8 @@
 package bind
 
 import (
+	"crypto/tls"
+
 	"github.com/miekg/dns"
 	"github.com/rs/zerolog/log"
 	"github.com/tmoneypenny/conspirator/internal/pkg/polling"
@@ -14,9 +16,12 @@ type Server struct {
 // Record is used to update or delete a record from the zone
 type Record struct {
 	FQDN       *string     // Required. All addresses are converted to a FQDN
-	RecordType *string     // Optional for Delete; Required for Upsert
+	RecordType *string     // Optional for Delete; Required for Upsert and Get
 	TTL        *uint32     // Optional for Delete; Required for Upsert
 	Value      interface{} // Optional for Delete; Required for Upsert
+	// Shaping optionally changes how the answers are sent. If
+	// RecordType is nil, every answer for the name is shaped
+	Shaping *Shaping
 }
 
 // BindConfig holds all the server configurations
@@ -24,6 +29,12 @@ type Record struct {
 type BindConfig struct {
 	Configs        []BindServerConfig
 	Zones          []string
+	Defaults       []DefaultProfile // Optional. Default answers per zone
+	ReverseZones   []ReverseZone    // Optional. in-addr.arpa and ip6.arpa zones to serve
+	DNSSEC         []DNSSECConfig   // Optional. Zones to sign
+	TSIG           []TSIGKey        // Optional. Keys allowed to send dynamic updates
+	Transfer       *TransferConfig  // Optional. Secondaries allowed to transfer zones
+	RateLimit      *RateLimitConfig // Optional. Limits UDP responses per client prefix
 	PollingManager *polling.PollingServer
 	PublicAddress  string
 }
@@ -37,8 +48,9 @@ type BindServerConfig struct {
 	// to a generic interface, use 0.0.0.0 to represent *:<port>
 	Address *string
 	Port    *int
-	Net     *string    // tcp, tcp-tls, udp
-	TLS     *TLSConfig // If TLS is enabled, Net is forced to tcp-tls
+	Net     *string    // tcp, tcp-tls, udp, doh
+	TLS     *TLSConfig // If TLS is enabled, Net is forced to tcp-tls unless it is doh
+	Path    *string    // Optional. URL path of doh listeners, defaults to /dns-query
 }
 
 // TLSConfig contains the path to PEM encoded certs
@@ -50,6 +62,10 @@ type TLSConfig struct {
 	// KeyFile contains the private key that corresponds to the public key
 	// in CertFile.
 	KeyFile *string
+	// GetCertificate optionally provides certificates that are
+	// reloaded while the listener is running. The key pair is not
+	// loaded by the listener if it is set
+	GetCertificate func(*tls.ClientHelloInfo) (*tls.Certificate, error)
 }
 
 // BindServer creates a new configured Server struct that can
@@ -75,20 +91,23 @@ func (s *Server) Stop() {
 
 // UpsertRRS will update or insert a resource record to override the
 // the defaultHandler
-func UpsertRRS(record *Record) {
+func UpsertRRS(record *Record) error {
 	if err := upsertRRS(record); err != nil {
 		log.Error().Msgf("Failed to upsert record: %v", err)
+		return err
 	}
+	return nil
 }
 
-// DeleteRRS will remove a resource record and convert the
-// behavior of the record back to that of the defaultHandler
-func DeleteRRS(record *Record) {
-	deleteRecord(record)
+// DeleteRRS will remove a resource record and its shaping and convert
+// the behavior of the record back to that of the defaultHandler.
+// DeleteRRS returns false if the name had no record or shaping
+func DeleteRRS(record *Record) bool {
+	return deleteRecord(record)
 }
 
-// GetRRS will return the RR if it was found in the cache. Otherwise,
-// GetRRS will return nil and false
+// GetRRS will return the RRs of the record type if they were found in
+// the cache. Otherwise, GetRRS will return nil and false
 func GetRRS(record *Record) (*Record, bool) {
 	// findRecordInZone() // convert back to *Record
 	if rec, found := findRecordInZone(record); found == nil {
@@ -97,7 +116,7 @@ func GetRRS(record *Record) (*Record, bool) {
 			wireRecords = append(wireRecords, record.String())
 		}
 		return &Record{
-			FQDN:       &rec.Record.(dns.RR).Header().Name,
+			FQDN:       &rec.Record.([]dns.RR)[0].Header().Name,
 			RecordType: &rec.RecordType,
 			TTL:        &rec.TTL,
 			Value:      wireRecords,
@@ -106,4 +125,75 @@ func GetRRS(record *Record) (*Record, bool) {
 	return nil, false
 }
 
+// GetExfil returns the reassembled payload of DNS exfil chunks
+// received for the interaction ID
+func GetExfil(interactionID string) (*ExfilPayload, bool) {
+	return findExfil(interactionID)
+}
+
+// ListExfil returns the reassembled payload of every interaction
+// ID that has received DNS exfil chunks
+func ListExfil() []*ExfilPayload {
+	return listExfil()
+}
+
+// DeleteExfil removes all chunks received for the interaction ID
+func DeleteExfil(interactionID string) {
+	deleteExfil(interactionID)
+}
+
+// StageFile serves data as base64 chunks in TXT answers at
+// <index>.<fqdn> with a manifest at <fqdn>. A chunkSize of 0
+// uses the largest chunk that fits in a UDP response
+func StageFile(fqdn string, data []byte, chunkSize int) (*StagedPayload, error) {
+	return stageFile(fqdn, data, chunkSize)
+}
+
+// DeleteStage removes a staged payload
+func DeleteStage(fqdn string) {
+	deleteStage(fqdn)
+}
+
+// ListStages returns all staged payloads
+func ListStages() []*StagedPayload {
+	return listStages()
+}
+
+// UpsertPolicy adds a client-aware response policy, replacing the
+// policy with the same ID. Policies are evaluated before records
+func UpsertPolicy(p Policy) (*Policy, error) {
+	return upsertPolicy(p)
+}
+
+// DeletePolicy removes the policy with the ID
+func DeletePolicy(id string) error {
+	return deletePolicy(id)
+}
+
+// ListPolicies returns all policies in evaluation order
+func ListPolicies() []Policy {
+	return listPolicies()
+}
+
+// AddTXT adds the value to the TXT records of the name. Existing
+// values are kept so that multiple ACME challenges can be published
+func AddTXT(fqdn, value string, ttl uint32) error {
+	return addTXT(fqdn, value, ttl)
+}
+
+// RemoveTXT removes the value from the TXT records of the name
+func RemoveTXT(fqdn, value string) {
+	removeTXT(fqdn, value)
+}
+
+// DS returns the DS record of the zone's DNSSEC key to publish at the
+// parent zone. A key is generated if the key pair does not exist
+func DS(cfg DNSSECConfig) (string, error) {
+	sg, err := newSigner(cfg)
+	if err != nil {
+		return "", err
+	}
+	return sg.ds().String(), nil
+}
+
 // import / export
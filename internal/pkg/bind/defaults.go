@@ -0,0 +1,282 @@
+package bind
+
+import (
+	"encoding/base64"
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/miekg/dns"
+)
+
+// Built-in values used when a zone has no DefaultProfile or the
+// profile leaves a field unset
+const (
+	defaultTTL          uint32 = 30
+	defaultMXPreference uint16 = 10
+	defaultSRVPriority  uint16 = 10
+	defaultSRVWeight    uint16 = 90
+	defaultSRVPort      uint16 = 443
+	defaultSPF                 = "v=spf1 a mx -all"
+	defaultCAA                 = `0 issue "letsencrypt.org"`
+	defaultHTTPS               = "1 . alpn=h2,http/1.1"
+)
+
+// synthesizedTypes are the types answer returns records of for any
+// name. CNAME is left out since it cannot exist with other types, and
+// NS since below the apex it would mark the name as a delegation
+var synthesizedTypes = []uint16{
+	dns.TypeA,
+	dns.TypeAAAA,
+	dns.TypeTXT,
+	dns.TypeMX,
+	dns.TypeSRV,
+	dns.TypePTR,
+	dns.TypeSPF,
+	dns.TypeCAA,
+	dns.TypeNAPTR,
+	dns.TypeHTTPS,
+	dns.TypeSVCB,
+}
+
+var invalidDefaultProfile error = fmt.Errorf("Invalid default profile")
+
+// DefaultProfile configures the answers given for names in a zone
+// that do not have a record. Unset fields use the built-in defaults
+type DefaultProfile struct {
+	// Zone the profile applies to
+	Zone *string
+	TTL  *uint32
+	// A is the IPv4 address to answer with. If unset, the address
+	// of the listener or PublicAddress is used
+	A            *string
+	AAAA         *string
+	TXT          []string
+	MXPreference *uint16
+	SRVPriority  *uint16
+	SRVWeight    *uint16
+	SRVPort      *uint16
+	// NS are the nameservers for the zone. If unset, ns1.<zone> is
+	// used, which resolves to the default A record
+	NS []string
+	// CAA are CAA RDATA values, e.g. 0 issue "letsencrypt.org"
+	CAA []string
+}
+
+// defaultProfile is a validated DefaultProfile. RRs are constructed
+// from it for every query so concurrent queries never share an RR
+type defaultProfile struct {
+	ttl          uint32
+	a            net.IP
+	aaaa         net.IP
+	txt          []string
+	mxPreference uint16
+	srvPriority  uint16
+	srvWeight    uint16
+	srvPort      uint16
+	ns           []string
+	caa          []dns.RR
+}
+
+// builtinProfile is used for zones without a DefaultProfile
+var builtinProfile = &defaultProfile{
+	ttl:          defaultTTL,
+	aaaa:         net.IPv6loopback,
+	txt:          []string{base64.StdEncoding.EncodeToString(seed.Bytes())},
+	mxPreference: defaultMXPreference,
+	srvPriority:  defaultSRVPriority,
+	srvWeight:    defaultSRVWeight,
+	srvPort:      defaultSRVPort,
+}
+
+// newDefaultProfile validates the profile and fills unset fields
+// from the built-in profile
+func newDefaultProfile(p DefaultProfile) (*defaultProfile, error) {
+	profile := *builtinProfile
+
+	if p.TTL != nil {
+		profile.ttl = *p.TTL
+	}
+
+	if p.A != nil && *p.A != "" {
+		ip := net.ParseIP(*p.A).To4()
+		if ip == nil {
+			return nil, invalidDefaultProfile
+		}
+		profile.a = ip
+	}
+
+	if p.AAAA != nil && *p.AAAA != "" {
+		ip := net.ParseIP(*p.AAAA)
+		if ip == nil || ip.To4() != nil {
+			return nil, invalidDefaultProfile
+		}
+		profile.aaaa = ip
+	}
+
+	if len(p.TXT) > 0 {
+		profile.txt = p.TXT
+	}
+
+	if p.MXPreference != nil {
+		profile.mxPreference = *p.MXPreference
+	}
+	if p.SRVPriority != nil {
+		profile.srvPriority = *p.SRVPriority
+	}
+	if p.SRVWeight != nil {
+		profile.srvWeight = *p.SRVWeight
+	}
+	if p.SRVPort != nil {
+		profile.srvPort = *p.SRVPort
+	}
+
+	if len(p.NS) > 0 {
+		if !validateFQDN(p.NS...) {
+			return nil, invalidDefaultProfile
+		}
+		for _, ns := range p.NS {
+			profile.ns = append(profile.ns, dns.Fqdn(ns))
+		}
+	}
+
+	if len(p.CAA) > 0 {
+		caa, ok := validateRData(dns.RR_Header{
+			Name:   "default.",
+			Rrtype: dns.TypeCAA,
+			Class:  dns.ClassINET,
+			Ttl:    profile.ttl,
+		}, p.CAA...)
+		if !ok {
+			return nil, invalidDefaultProfile
+		}
+		profile.caa = caa
+	}
+
+	return &profile, nil
+}
+
+// newDefaultProfiles maps each zone to its validated profile
+func newDefaultProfiles(profiles []DefaultProfile) (map[string]*defaultProfile, error) {
+	zones := make(map[string]*defaultProfile)
+	for _, p := range profiles {
+		if p.Zone == nil || !validateFQDN(*p.Zone) {
+			return nil, invalidDomainName
+		}
+
+		profile, err := newDefaultProfile(p)
+		if err != nil {
+			return nil, fmt.Errorf("%v for zone %s", err, *p.Zone)
+		}
+		zones[strings.ToLower(dns.Fqdn(*p.Zone))] = profile
+	}
+	return zones, nil
+}
+
+// profileForName returns the profile and zone that contains name
+func (s *server) profileForName(name string) (*defaultProfile, string) {
+	if zone, ok := zoneForName(name, s.Zones); ok {
+		if profile, found := s.Defaults[strings.ToLower(zone)]; found {
+			return profile, zone
+		}
+		return builtinProfile, zone
+	}
+	return builtinProfile, dns.Fqdn(name)
+}
+
+// builtinRData parses RDATA that is known to be valid
+func builtinRData(header dns.RR_Header, rdata string) []dns.RR {
+	rrs, _ := validateRData(header, rdata)
+	return rrs
+}
+
+// answer constructs the default RRs for the question. localIP is used
+// for A questions when the profile does not set an address. The
+// returned bool is false if the question type has no default answer.
+// An empty answer with true is returned for types that exist but have
+// no data at this name (NODATA)
+func (p *defaultProfile) answer(q dns.Question, zone string, localIP net.IP) ([]dns.RR, bool) {
+	header := dns.RR_Header{
+		Name:   q.Name,
+		Rrtype: q.Qtype,
+		Class:  dns.ClassINET,
+		Ttl:    p.ttl,
+	}
+
+	switch q.Qtype {
+	case dns.TypeA:
+		ip := p.a
+		if ip == nil {
+			ip = localIP
+		}
+		return []dns.RR{&dns.A{Hdr: header, A: ip}}, true
+	case dns.TypeAAAA:
+		return []dns.RR{&dns.AAAA{Hdr: header, AAAA: p.aaaa}}, true
+	case dns.TypeCNAME:
+		return []dns.RR{&dns.CNAME{Hdr: header, Target: q.Name}}, true
+	case dns.TypeTXT:
+		txt := make([]string, len(p.txt))
+		copy(txt, p.txt)
+		return []dns.RR{&dns.TXT{Hdr: header, Txt: txt}}, true
+	case dns.TypeMX:
+		return []dns.RR{&dns.MX{
+			Hdr:        header,
+			Preference: p.mxPreference,
+			Mx:         q.Name,
+		}}, true
+	case dns.TypeSRV:
+		return []dns.RR{&dns.SRV{
+			Hdr:      header,
+			Priority: p.srvPriority,
+			Weight:   p.srvWeight,
+			Port:     p.srvPort,
+			Target:   q.Name,
+		}}, true
+	case dns.TypePTR:
+		return []dns.RR{&dns.PTR{Hdr: header, Ptr: q.Name}}, true
+	case dns.TypeNS:
+		ns := p.ns
+		if len(ns) == 0 {
+			ns = []string{"ns1." + dns.Fqdn(zone)}
+		}
+		rrs := make([]dns.RR, 0, len(ns))
+		for _, n := range ns {
+			rrs = append(rrs, &dns.NS{Hdr: header, Ns: n})
+		}
+		return rrs, true
+	case dns.TypeSPF:
+		return []dns.RR{&dns.SPF{Hdr: header, Txt: []string{defaultSPF}}}, true
+	case dns.TypeCAA:
+		if len(p.caa) == 0 {
+			return builtinRData(header, defaultCAA), true
+		}
+		rrs := make([]dns.RR, 0, len(p.caa))
+		for _, rr := range p.caa {
+			caa := dns.Copy(rr)
+			*caa.Header() = header
+			rrs = append(rrs, caa)
+		}
+		return rrs, true
+	case dns.TypeNAPTR:
+		// long names would not fit the prefix, so the root is used
+		replacement := "_sip._udp." + q.Name
+		if _, ok := dns.IsDomainName(replacement); !ok {
+			replacement = "."
+		}
+		return []dns.RR{&dns.NAPTR{
+			Hdr:         header,
+			Order:       100,
+			Preference:  10,
+			Flags:       "S",
+			Service:     "SIP+D2U",
+			Replacement: replacement,
+		}}, true
+	case dns.TypeHTTPS, dns.TypeSVCB:
+		return builtinRData(header, defaultHTTPS), true
+	case dns.TypeDS:
+		// unsigned delegation
+		return []dns.RR{}, true
+	}
+
+	return nil, false
+}
@@ -0,0 +1,130 @@
+package bind
+
+import (
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"github.com/tmoneypenny/conspirator/internal/pkg/util"
+)
+
+func TestDefaultProfiles(t *testing.T) {
+	ttl := uint32(60)
+	port := uint16(8443)
+	profiles, err := newDefaultProfiles([]DefaultProfile{
+		{
+			Zone:    util.StrToPtr("custom.src"),
+			TTL:     &ttl,
+			A:       util.StrToPtr("10.0.0.1"),
+			TXT:     []string{"custom"},
+			SRVPort: &port,
+		},
+	})
+	assert.NoError(t, err)
+
+	s := &server{Zones: []string{"custom.src", "plain.src"}, Defaults: profiles}
+	local := net.ParseIP("192.0.2.1")
+
+	profile, zone := s.profileForName("a.custom.src.")
+	assert.Equal(t, "custom.src.", zone)
+
+	rrs, ok := profile.answer(dns.Question{Name: "a.custom.src.", Qtype: dns.TypeA}, zone, local)
+	assert.True(t, ok)
+	assert.Equal(t, "10.0.0.1", rrs[0].(*dns.A).A.String())
+	assert.Equal(t, ttl, rrs[0].Header().Ttl)
+
+	rrs, _ = profile.answer(dns.Question{Name: "a.custom.src.", Qtype: dns.TypeSRV}, zone, local)
+	assert.Equal(t, port, rrs[0].(*dns.SRV).Port)
+	assert.Equal(t, defaultSRVWeight, rrs[0].(*dns.SRV).Weight)
+
+	profile, zone = s.profileForName("a.plain.src.")
+	rrs, _ = profile.answer(dns.Question{Name: "a.plain.src.", Qtype: dns.TypeA}, zone, local)
+	assert.Equal(t, "192.0.2.1", rrs[0].(*dns.A).A.String())
+	assert.Equal(t, defaultTTL, rrs[0].Header().Ttl)
+
+	_, ok = builtinProfile.answer(dns.Question{Name: "a.plain.src.", Qtype: dns.TypeHINFO}, zone, local)
+	assert.False(t, ok)
+
+	_, err = newDefaultProfiles([]DefaultProfile{{Zone: util.StrToPtr("bad.src"), A: util.StrToPtr("::1")}})
+	assert.Error(t, err)
+}
+
+func TestDefaultAnswerTypes(t *testing.T) {
+	profile, err := newDefaultProfile(DefaultProfile{
+		NS:  []string{"ns1.example.test", "ns2.example.test"},
+		CAA: []string{`0 issuewild "pki.goog"`},
+	})
+	assert.NoError(t, err)
+
+	testCases := []struct {
+		qtype    uint16
+		expected []string
+	}{
+		{dns.TypePTR, []string{"x.src.\t30\tIN\tPTR\tx.src."}},
+		{dns.TypeNS, []string{"x.src.\t30\tIN\tNS\tns1.example.test.", "x.src.\t30\tIN\tNS\tns2.example.test."}},
+		{dns.TypeSPF, []string{"x.src.\t30\tIN\tSPF\t\"v=spf1 a mx -all\""}},
+		{dns.TypeCAA, []string{"x.src.\t30\tIN\tCAA\t0 issuewild \"pki.goog\""}},
+		{dns.TypeNAPTR, []string{"x.src.\t30\tIN\tNAPTR\t100 10 \"S\" \"SIP+D2U\" \"\" _sip._udp.x.src."}},
+		{dns.TypeHTTPS, []string{"x.src.\t30\tIN\tHTTPS\t1 . alpn=\"h2,http/1.1\""}},
+		{dns.TypeSVCB, []string{"x.src.\t30\tIN\tSVCB\t1 . alpn=\"h2,http/1.1\""}},
+		{dns.TypeDS, []string{}},
+	}
+
+	for _, tc := range testCases {
+		rrs, ok := profile.answer(dns.Question{Name: "x.src.", Qtype: tc.qtype}, "src.", nil)
+		assert.True(t, ok, dns.TypeToString[tc.qtype])
+		answers := []string{}
+		for _, rr := range rrs {
+			answers = append(answers, rr.String())
+		}
+		assert.Equal(t, tc.expected, answers)
+	}
+
+	// signed denials claim the synthesized types exist at every name
+	for _, qtype := range synthesizedTypes {
+		rrs, ok := builtinProfile.answer(dns.Question{Name: "x.src.", Qtype: qtype}, "src.", net.IPv4(127, 0, 0, 1))
+		assert.True(t, ok, dns.TypeToString[qtype])
+		assert.NotEmpty(t, rrs, dns.TypeToString[qtype])
+	}
+
+	// the answers for long names, e.g. exfil chunks, must still pack
+	long := strings.Repeat(strings.Repeat("a", 63)+".", 3) + strings.Repeat("b", 52) + ".src."
+	assert.Equal(t, 250, len(long)+1) // octets in wire format
+	for _, qtype := range synthesizedTypes {
+		m := new(dns.Msg)
+		m.SetQuestion(long, qtype)
+		m.Answer, _ = builtinProfile.answer(m.Question[0], "src.", net.IPv4(127, 0, 0, 1))
+		_, err := m.Pack()
+		assert.NoError(t, err, dns.TypeToString[qtype])
+	}
+	rrs, _ := builtinProfile.answer(dns.Question{Name: long, Qtype: dns.TypeNAPTR}, "src.", nil)
+	assert.Equal(t, ".", rrs[0].(*dns.NAPTR).Replacement)
+
+	rrs, _ = builtinProfile.answer(dns.Question{Name: "x.src.", Qtype: dns.TypeNS}, "src.", nil)
+	assert.Equal(t, "ns1.src.", rrs[0].(*dns.NS).Ns)
+
+	_, err = newDefaultProfile(DefaultProfile{CAA: []string{"issue letsencrypt.org"}})
+	assert.Error(t, err)
+}
+
+// TestDefaultAnswerConcurrency verifies concurrent queries never
+// receive the name of another query
+func TestDefaultAnswerConcurrency(t *testing.T) {
+	var wg sync.WaitGroup
+	for i := 0; i < 100; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			name := fmt.Sprintf("q%d.src.", i)
+			for _, qtype := range []uint16{dns.TypeA, dns.TypeCNAME, dns.TypeTXT, dns.TypeMX, dns.TypeCAA, dns.TypeHTTPS} {
+				rrs, _ := builtinProfile.answer(dns.Question{Name: name, Qtype: qtype}, "src.", net.IPv4(127, 0, 0, 1))
+				assert.Equal(t, name, rrs[0].Header().Name)
+			}
+		}(i)
+	}
+	wg.Wait()
+}
@@ -6,6 +6,7 @@ import (
 	"crypto/tls"
 	"fmt"
 	"net"
+	"net/http"
 	"time"
 
 	"github.com/miekg/dns"
@@ -32,65 +33,146 @@ var (
 // server contains a slice of dns.Servers to start as listeners
 // as well as the zones to serve
 type server struct {
-	DNS           []*dns.Server
-	Zones         []string
-	PollingServer *polling.PollingServer
-	Marshaller    *encoding.Marshal
-	PublicAddress string
+	DNS          []*dns.Server
+	DoH          []*http.Server
+	Zones        []string
+	Defaults     map[string]*defaultProfile
+	ReverseZones []*reverseZone
+	Signers      []*signer
+	// TSIGAlgorithms maps the names of keys that may update zones
+	// to the algorithm of the key
+	TSIGAlgorithms map[string]string
+	TSIGSecrets    map[string]string
+	Transfer       *transferPolicy
+	RateLimit      *rateLimiter
+	PollingServer  *polling.PollingServer
+	Marshaller     *encoding.Marshal
+	PublicAddress  string
 }
 
 // newServer takes a specification and returns a new dns.server
 func newServer(specs *BindConfig) *server {
 	var dnsServers []*dns.Server
+	var dohServers []*http.Server
+
+	tsigSecrets, tsigAlgorithms, err := newTSIGKeys(specs.TSIG)
+	if err != nil {
+		log.Fatal().Msgf("Cannot load TSIG keys: %v", err)
+	}
 
 	for _, c := range specs.Configs {
+		if c.Net != nil && *c.Net == dohNet {
+			var path string
+			if c.Path != nil {
+				path = *c.Path
+			}
+			svr := newDoHServer(fmt.Sprintf("%s:%d", *c.Address, *c.Port), path, dns.DefaultServeMux)
+			if c.TLS != nil {
+				svr.TLSConfig = newTLSConfig(c.TLS)
+			}
+			dohServers = append(dohServers, svr)
+			continue
+		}
+
 		switch c.TLS {
 		case nil:
 			dnsServers = append(dnsServers, &dns.Server{
-				Net:       *c.Net,
-				Addr:      fmt.Sprintf("%s:%d", *c.Address, *c.Port),
-				ReusePort: true,
+				Net:           *c.Net,
+				Addr:          fmt.Sprintf("%s:%d", *c.Address, *c.Port),
+				ReusePort:     true,
+				TsigSecret:    tsigSecrets,
+				MsgAcceptFunc: msgAcceptFunc,
 				NotifyStartedFunc: func() {
 					log.Info().Msg("DNS server started")
 				},
 			})
 		default:
-			cert, err := tls.LoadX509KeyPair(*c.TLS.CertFile, *c.TLS.KeyFile)
-			if err != nil {
-				log.Fatal().Msgf("Cannot load KeyPair: %v", err)
-			}
 			c.Net = util.StrToPtr("tcp-tls") // overwrite setting
 			dnsServers = append(dnsServers, &dns.Server{
-				Net:       *c.Net,
-				Addr:      fmt.Sprintf("%s:%d", *c.Address, *c.Port),
-				ReusePort: true,
+				Net:           *c.Net,
+				Addr:          fmt.Sprintf("%s:%d", *c.Address, *c.Port),
+				ReusePort:     true,
+				TsigSecret:    tsigSecrets,
+				MsgAcceptFunc: msgAcceptFunc,
 				NotifyStartedFunc: func() {
 					log.Info().Msg("DNS server started")
 				},
-				TLSConfig: &tls.Config{
-					Certificates: []tls.Certificate{cert},
-				},
+				TLSConfig: newTLSConfig(c.TLS),
 			})
 		}
 	}
 
+	defaults, err := newDefaultProfiles(specs.Defaults)
+	if err != nil {
+		log.Fatal().Msgf("Cannot load default profiles: %v", err)
+	}
+
+	reverseZones, err := newReverseZones(specs.ReverseZones, specs.Zones)
+	if err != nil {
+		log.Fatal().Msgf("Cannot load reverse zones: %v", err)
+	}
+
+	var signers []*signer
+	for _, cfg := range specs.DNSSEC {
+		sg, err := newSigner(cfg)
+		if err != nil {
+			log.Fatal().Msgf("Cannot load DNSSEC key: %v", err)
+		}
+		signers = append(signers, sg)
+	}
+
+	transfer, err := newTransferPolicy(specs.Transfer, tsigAlgorithms)
+	if err != nil {
+		log.Fatal().Msgf("Cannot load transfer policy: %v", err)
+	}
+
+	rateLimit, err := newRateLimiter(specs.RateLimit)
+	if err != nil {
+		log.Fatal().Msgf("Cannot load rate limit: %v", err)
+	}
+
 	return &server{
-		DNS:           dnsServers,
-		Zones:         specs.Zones,
-		PollingServer: specs.PollingManager,
-		Marshaller:    encoding.NewMarshaller(encoding.Format("burp")),
-		PublicAddress: specs.PublicAddress,
+		DNS:            dnsServers,
+		DoH:            dohServers,
+		Zones:          specs.Zones,
+		Defaults:       defaults,
+		ReverseZones:   reverseZones,
+		Signers:        signers,
+		TSIGAlgorithms: tsigAlgorithms,
+		TSIGSecrets:    tsigSecrets,
+		Transfer:       transfer,
+		RateLimit:      rateLimit,
+		PollingServer:  specs.PollingManager,
+		Marshaller:     encoding.NewMarshaller(encoding.Format("burp")),
+		PublicAddress:  specs.PublicAddress,
 	}
 }
 
+// newTLSConfig loads the key pair of a listener unless the
+// certificates are provided by GetCertificate
+func newTLSConfig(c *TLSConfig) *tls.Config {
+	if c.GetCertificate != nil {
+		return &tls.Config{GetCertificate: c.GetCertificate}
+	}
+
+	cert, err := tls.LoadX509KeyPair(*c.CertFile, *c.KeyFile)
+	if err != nil {
+		log.Fatal().Msgf("Cannot load KeyPair: %v", err)
+	}
+	return &tls.Config{Certificates: []tls.Certificate{cert}}
+}
+
 // startListeners registers handlers and listeners
 func (s *server) startListeners() {
 	// register handler for each zone
 	for _, z := range s.Zones {
 		dns.HandleFunc(dns.Fqdn(z), s.routeHandler)
 	}
+	for _, rz := range s.ReverseZones {
+		dns.HandleFunc(rz.arpa, s.routeHandler)
+	}
 
-	if len(s.DNS) == 0 {
+	if len(s.DNS) == 0 && len(s.DoH) == 0 {
 		// Create a default listener?
 		log.Fatal().Msg("")
 	}
@@ -103,6 +185,25 @@ func (s *server) startListeners() {
 			}
 		}(s.DNS[i])
 	}
+
+	if s.Transfer != nil && len(s.Transfer.notify) > 0 {
+		go s.notifySecondaries()
+	}
+
+	for i := range s.DoH {
+		log.Info().Msgf("Starting DNS %v listener...", dohNet)
+		go func(svr *http.Server) {
+			var err error
+			if svr.TLSConfig != nil {
+				err = svr.ListenAndServeTLS("", "")
+			} else {
+				err = svr.ListenAndServe()
+			}
+			if err != nil && err != http.ErrServerClosed {
+				log.Fatal().Msgf("%v", err)
+			}
+		}(s.DoH[i])
+	}
 }
 
 // stopListeners gracefully shuts down the server
@@ -112,17 +213,82 @@ func (s *server) stopListeners() {
 	for i := range s.DNS {
 		s.DNS[i].ShutdownContext(ctx)
 	}
+	for i := range s.DoH {
+		s.DoH[i].Shutdown(ctx)
+	}
+	if s.Transfer != nil {
+		close(s.Transfer.done)
+	}
 }
 
 func (s *server) routeHandler(w dns.ResponseWriter, r *dns.Msg) {
-	if rr, err := findRecordInZone(&Record{FQDN: &r.Question[0].Name}); err == nil {
-		s.zoneHandler(w, r, rr)
+	// limited queries are not routed to avoid amplifying floods
+	if s.RateLimit != nil && w.RemoteAddr().Network() == "udp" {
+		if action := s.RateLimit.check(w.RemoteAddr(), time.Now()); action != rrlAllow {
+			s.rateLimitHandler(w, r, action)
+			return
+		}
+	}
+
+	if r.Opcode == dns.OpcodeUpdate {
+		s.updateHandler(w, r)
+		return
+	}
+
+	// transfers are never signed online
+	if qtype := r.Question[0].Qtype; qtype == dns.TypeAXFR || qtype == dns.TypeIXFR {
+		s.transferHandler(w, r)
+		return
+	}
+
+	// the signing writer wraps the shaping writer, so answers are
+	// shaped after they are signed
+	if sh, ok := findShaping(r.Question[0]); ok {
+		w = &shapingWriter{ResponseWriter: w, shaping: sh}
+	}
+
+	// answers in signed zones are signed when the client sets the DO bit
+	if sg, ok := s.signerForName(r.Question[0].Name); ok {
+		if opt := r.IsEdns0(); opt != nil && opt.Do() {
+			w = &signingWriter{ResponseWriter: w, signer: sg, request: r}
+		}
+		if rrs, ok := sg.apexAnswer(r.Question[0]); ok {
+			s.dnssecHandler(w, r, rrs)
+			return
+		}
+	}
+
+	if r.Question[0].Qtype == dns.TypeSOA {
+		if zone, ok := s.apexZone(r.Question[0].Name); ok {
+			s.soaHandler(w, r, zone)
+			return
+		}
+	}
+
+	if p, ok := findPolicy(r, w.RemoteAddr()); ok {
+		s.policyHandler(w, r, p)
+		return
+	}
+
+	if r.Question[0].Qtype == dns.TypeTXT {
+		if txt, found, ok := findStagedAnswer(r.Question[0].Name); found {
+			s.stagingHandler(w, r, txt, ok)
+			return
+		}
+	}
+
+	if cut, ns, ok := s.findDelegation(r.Question[0].Name); ok {
+		s.referralHandler(w, r, cut, ns)
+	} else if rrs, ok := zoneAnswer(r.Question[0]); ok {
+		s.zoneHandler(w, r, rrs)
+	} else if rz, ok := s.reverseZoneForName(r.Question[0].Name); ok {
+		s.reverseHandler(w, r, rz)
 	} else {
 		s.defaultHandler(w, r)
 	}
 }
 
-func (s *server) zoneHandler(w dns.ResponseWriter, r *dns.Msg, rrs zoneRRS) {
+func (s *server) zoneHandler(w dns.ResponseWriter, r *dns.Msg, rrs []dns.RR) {
 	m := new(dns.Msg)
 	m.SetReply(r)
 
@@ -131,8 +297,65 @@ func (s *server) zoneHandler(w dns.ResponseWriter, r *dns.Msg, rrs zoneRRS) {
 
 	log.Debug().Msgf("received request for %v from %v", m.Question, w.RemoteAddr())
 
-	m.Answer = append(m.Answer, rrs.Record.([]dns.RR)...)
-	go s.interactionHandler(r, m, w.RemoteAddr().String())
+	m.Answer = append(m.Answer, rrs...)
+	go s.interactionHandler(r, m, w.RemoteAddr())
+	if err := w.WriteMsg(m); err != nil {
+		log.Error().Msgf("failed to response to DNS query: %v", m)
+	}
+}
+
+// findDelegation returns the name and NS records of the delegation
+// that contains name. NS records at the apex of a zone are the zone's
+// own nameservers and do not delegate it
+func (s *server) findDelegation(name string) (string, []dns.RR, bool) {
+	name = zoneKey(name)
+
+	var cut string
+	var ns []dns.RR
+	// the delegation closest to the apex is the one the zone serves
+	for off, end := 0, false; !end; off, end = dns.NextLabel(name, off) {
+		if _, ok := s.apexZone(name[off:]); ok {
+			break
+		}
+		if rrs, ok := findRRSet(name[off:], dns.TypeNS); ok {
+			cut, ns = name[off:], rrs
+		}
+	}
+	return cut, ns, cut != ""
+}
+
+// referralHandler refers questions for names at or below a delegation
+// to its nameservers. The DS records of the delegation belong to the
+// parent, so DS questions for the delegated name are answered
+func (s *server) referralHandler(w dns.ResponseWriter, r *dns.Msg, cut string, ns []dns.RR) {
+	m := new(dns.Msg)
+	m.SetReply(r)
+
+	m.RecursionAvailable = true
+
+	ds, _ := findRRSet(cut, dns.TypeDS)
+	if q := r.Question[0]; q.Qtype == dns.TypeDS && zoneKey(q.Name) == cut {
+		m.Authoritative = true
+		m.Answer = append(m.Answer, ds...)
+	} else {
+		m.Ns = append(m.Ns, ns...)
+		m.Ns = append(m.Ns, ds...)
+
+		// nameservers below the delegation need glue addresses
+		for _, rr := range ns {
+			target := rr.(*dns.NS).Ns
+			if !dns.IsSubDomain(cut, zoneKey(target)) {
+				continue
+			}
+			for _, rrtype := range []uint16{dns.TypeA, dns.TypeAAAA} {
+				glue, _ := findRRSet(target, rrtype)
+				m.Extra = append(m.Extra, glue...)
+			}
+		}
+	}
+	log.Debug().Msgf("referred question %v to delegation %s", m.Question, cut)
+
+	go s.interactionHandler(r, m, w.RemoteAddr())
 	if err := w.WriteMsg(m); err != nil {
 		log.Error().Msgf("failed to response to DNS query: %v", m)
 	}
@@ -152,36 +375,24 @@ func (s *server) defaultHandler(w dns.ResponseWriter, r *dns.Msg) {
 		localIP = s.PublicAddress
 	}
 
-	switch r.Question[0].Qtype {
-	case dns.TypeA:
-		aDefaultRRS[0].Header().Name = r.Question[0].Name
-		aDefaultRRS[0].(*dns.A).A = net.ParseIP(localIP)
-		m.Answer = append(m.Answer, aDefaultRRS...)
-	case dns.TypeAAAA:
-		aaaaDefaultRRS[0].Header().Name = r.Question[0].Name
-		m.Answer = append(m.Answer, aaaaDefaultRRS...)
-	case dns.TypeCNAME:
-		cnameDefaultRRS.Header().Name = r.Question[0].Name
-		cnameDefaultRRS.Target = r.Question[0].Name
-		m.Answer = append(m.Answer, cnameDefaultRRS)
-	case dns.TypeTXT:
-		txtDefaultRRS.Header().Name = r.Question[0].Name
-		m.Answer = append(m.Answer, txtDefaultRRS)
-	case dns.TypeMX:
-		mxDefaultRRS[0].Header().Name = r.Question[0].Name
-		mxDefaultRRS[0].(*dns.MX).Mx = r.Question[0].Name
-		m.Answer = append(m.Answer, mxDefaultRRS...)
-	case dns.TypeIXFR, dns.TypeAXFR:
-		log.Warn().Msgf("received zone transfer request: \n\t%v : %v",
-			w.RemoteAddr().String(),
-			m.Question,
-		)
-		m.SetRcode(r, dns.RcodeRefused)
-	case dns.TypeSRV:
-		svrDefaultRRS[0].Header().Name = r.Question[0].Name
-		svrDefaultRRS[0].(*dns.SRV).Target = r.Question[0].Name
-		m.Answer = append(m.Answer, svrDefaultRRS...)
-	default:
+	// encoded-IP names resolve to the address in the label instead of
+	// the default records
+	if rrs, ok := encodedIPAnswer(r.Question[0], s.Zones); ok {
+		m.Answer = append(m.Answer, rrs...)
+		log.Debug().Msgf("replied to encoded IP question %v with answer %v", m.Question, m.Answer)
+		go s.interactionHandler(r, m, w.RemoteAddr())
+		if err := w.WriteMsg(m); err != nil {
+			log.Error().Msgf("failed to response to DNS query: %v", m)
+		}
+		return
+	}
+
+	// RRs are constructed per query so concurrent queries never
+	// modify the answer of another query
+	profile, zone := s.profileForName(r.Question[0].Name)
+	if rrs, ok := profile.answer(r.Question[0], zone, net.ParseIP(localIP)); ok {
+		m.Answer = append(m.Answer, rrs...)
+	} else {
 		log.Warn().Msgf("received an unhandled RR type: %v", m.Question[0].Qtype)
 		m.SetRcode(r, dns.RcodeNotImplemented)
 	}
@@ -191,26 +402,44 @@ func (s *server) defaultHandler(w dns.ResponseWriter, r *dns.Msg) {
 	log.Debug().Msgf("replied to question %v with answer %v [status: %v]", m.Question, m.Answer, m.Rcode)
 
 	//go s.PollingServer.Publish(fmt.Sprintf("%v:%v", r.Question[0].Name, m.Answer))
-	go s.interactionHandler(r, m, w.RemoteAddr().String())
+	go s.interactionHandler(r, m, w.RemoteAddr())
 	if err := w.WriteMsg(m); err != nil {
 		log.Error().Msgf("failed to response to DNS query: %v", m)
 	}
 }
 
-func (s *server) interactionHandler(q, a *dns.Msg, clientIP string) {
+func (s *server) interactionHandler(q, a *dns.Msg, remoteAddr net.Addr) {
+	// group chunked names by interaction ID for reassembly
+	recordExfil(q.Question[0].Name, remoteAddr.String(), s.Zones)
+
+	s.publishInteraction(newDNSInput(q, a, remoteAddr))
+}
+
+// newDNSInput returns the interaction data for the question and answer
+func newDNSInput(q, a *dns.Msg, remoteAddr net.Addr) *encoding.DNSInput {
 	input := &encoding.DNSInput{
 		SubdomainQuestion: q.Question[0].Name,
 		RawRequest:        q.Question[0].String(),
 		RequestType:       q.Question[0].Qtype,
 		Answer:            "", // Default
 		OpCode:            a.Opcode,
-		ClientIP:          clientIP,
+		ClientIP:          remoteAddr.String(),
+		Transport:         remoteAddr.Network(),
 	}
 
-	if a.Rcode < 1 {
+	// DoH clients also send the HTTP request
+	if addr, ok := remoteAddr.(*dohAddr); ok {
+		input.HTTPRequest = addr.request
+	}
+
+	if a.Rcode < 1 && len(a.Answer) > 0 {
 		input.Answer = a.Answer[0].Header().Name
 	}
+	return input
+}
 
+// publishInteraction sends the interaction to the polling server
+func (s *server) publishInteraction(input *encoding.DNSInput) {
 	jsonData, err := s.Marshaller.MarshalToJSON(input)
 
 	if err != nil {
@@ -0,0 +1,491 @@
+package bind
+
+import (
+	"crypto"
+	"encoding/base32"
+	"fmt"
+	"math/big"
+	"net"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/miekg/dns"
+	"github.com/rs/zerolog/log"
+)
+
+// Signature validity. Signatures are backdated to allow for clock skew
+const (
+	signatureInception  = time.Hour
+	signatureExpiration = 7 * 24 * time.Hour
+	dnskeyTTL           = 3600
+	defaultKeyAlgorithm = "ECDSAP256SHA256"
+)
+
+var (
+	invalidDNSSECConfig error = fmt.Errorf("Invalid DNSSEC configuration")
+	invalidKeyAlgorithm error = fmt.Errorf("Invalid DNSSEC key algorithm")
+	invalidSigningKey   error = fmt.Errorf("Invalid DNSSEC signing key")
+)
+
+// keyBits is the key size used when generating a key for the algorithm
+var keyBits = map[uint8]int{
+	dns.RSASHA256:       2048,
+	dns.RSASHA512:       2048,
+	dns.ECDSAP256SHA256: 256,
+	dns.ECDSAP384SHA384: 384,
+	dns.ED25519:         256,
+}
+
+// DNSSECConfig enables online signing of all answers in a zone
+type DNSSECConfig struct {
+	Zone *string
+	// KeyFile is the path of a BIND style key pair without the .key
+	// and .private extensions, e.g. keys/Kexample.com.+013+12345.
+	// A key pair is generated at the path if it does not exist
+	KeyFile *string
+	// Algorithm of a generated key. Defaults to ECDSAP256SHA256
+	Algorithm *string
+	// NSEC3 denies existence with NSEC3 instead of NSEC
+	NSEC3 bool
+}
+
+// signer holds the combined signing key of a zone
+type signer struct {
+	zone    string
+	key     *dns.DNSKEY
+	private crypto.Signer
+	nsec3   bool
+}
+
+// newSigner imports the key pair for the zone or generates one
+func newSigner(cfg DNSSECConfig) (*signer, error) {
+	if cfg.Zone == nil || !validateFQDN(*cfg.Zone) {
+		return nil, invalidDomainName
+	}
+	if cfg.KeyFile == nil || *cfg.KeyFile == "" {
+		return nil, invalidDNSSECConfig
+	}
+
+	s := &signer{
+		zone:  strings.ToLower(dns.Fqdn(*cfg.Zone)),
+		nsec3: cfg.NSEC3,
+	}
+
+	var err error
+	if _, statErr := os.Stat(*cfg.KeyFile + ".private"); statErr == nil {
+		err = s.importKey(*cfg.KeyFile)
+	} else {
+		algorithm := defaultKeyAlgorithm
+		if cfg.Algorithm != nil && *cfg.Algorithm != "" {
+			algorithm = *cfg.Algorithm
+		}
+		err = s.generateKey(*cfg.KeyFile, algorithm)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// importKey reads a key pair in the format written by dnssec-keygen
+func (s *signer) importKey(path string) error {
+	pub, err := os.Open(path + ".key")
+	if err != nil {
+		return err
+	}
+	defer pub.Close()
+
+	rr, err := dns.ReadRR(pub, path+".key")
+	if err != nil {
+		return err
+	}
+	key, ok := rr.(*dns.DNSKEY)
+	if !ok || !strings.EqualFold(key.Hdr.Name, s.zone) {
+		return invalidSigningKey
+	}
+
+	priv, err := os.Open(path + ".private")
+	if err != nil {
+		return err
+	}
+	defer priv.Close()
+
+	privateKey, err := key.ReadPrivateKey(priv, path+".private")
+	if err != nil {
+		return err
+	}
+	signingKey, ok := privateKey.(crypto.Signer)
+	if !ok {
+		return invalidSigningKey
+	}
+
+	s.key = key
+	s.private = signingKey
+	log.Info().Msgf("Imported DNSSEC key %d for %s", key.KeyTag(), s.zone)
+	return nil
+}
+
+// generateKey creates a key pair and writes it to path
+func (s *signer) generateKey(path, algorithm string) error {
+	alg, ok := dns.StringToAlgorithm[strings.ToUpper(algorithm)]
+	if !ok {
+		return invalidKeyAlgorithm
+	}
+	bits, ok := keyBits[alg]
+	if !ok {
+		return invalidKeyAlgorithm
+	}
+
+	// a single key is used as both the KSK and ZSK
+	key := &dns.DNSKEY{
+		Hdr: dns.RR_Header{
+			Name:   s.zone,
+			Rrtype: dns.TypeDNSKEY,
+			Class:  dns.ClassINET,
+			Ttl:    dnskeyTTL,
+		},
+		Flags:     dns.ZONE | dns.SEP,
+		Protocol:  3,
+		Algorithm: alg,
+	}
+	privateKey, err := key.Generate(bits)
+	if err != nil {
+		return err
+	}
+
+	if err := os.WriteFile(path+".key", []byte(key.String()+"\n"), 0644); err != nil {
+		return err
+	}
+	if err := os.WriteFile(path+".private", []byte(key.PrivateKeyString(privateKey)), 0600); err != nil {
+		return err
+	}
+
+	s.key = key
+	s.private = privateKey.(crypto.Signer)
+	log.Info().Msgf("Generated DNSSEC key %d for %s at %s", key.KeyTag(), s.zone, path)
+	return nil
+}
+
+// ds returns the DS record to publish at the parent zone
+func (s *signer) ds() *dns.DS {
+	return s.key.ToDS(dns.SHA256)
+}
+
+// soa returns the synthesized SOA of the zone
+func (s *signer) soa() *dns.SOA {
+	return zoneSOA(s.zone)
+}
+
+// nsec3param returns the NSEC3 parameters. Hashes use no salt and
+// no extra iterations as recommended by RFC 9276
+func (s *signer) nsec3param() *dns.NSEC3PARAM {
+	return &dns.NSEC3PARAM{
+		Hdr: dns.RR_Header{
+			Name:   s.zone,
+			Rrtype: dns.TypeNSEC3PARAM,
+			Class:  dns.ClassINET,
+		},
+		Hash: dns.SHA1,
+	}
+}
+
+// apexAnswer returns the zone data that only exists at the apex.
+// The returned bool is false for other names and types
+func (s *signer) apexAnswer(q dns.Question) ([]dns.RR, bool) {
+	if !strings.EqualFold(q.Name, s.zone) {
+		return nil, false
+	}
+
+	switch q.Qtype {
+	case dns.TypeSOA:
+		return []dns.RR{s.soa()}, true
+	case dns.TypeDNSKEY:
+		return []dns.RR{dns.Copy(s.key)}, true
+	case dns.TypeNSEC3PARAM:
+		if s.nsec3 {
+			return []dns.RR{s.nsec3param()}, true
+		}
+		return []dns.RR{}, true
+	}
+	return nil, false
+}
+
+// sign returns the RRSIGs for each RRset in rrs that is in the zone
+func (s *signer) sign(rrs []dns.RR, now time.Time) ([]dns.RR, error) {
+	var order []string
+	rrsets := make(map[string][]dns.RR)
+	for _, rr := range rrs {
+		h := rr.Header()
+		if h.Rrtype == dns.TypeRRSIG || h.Rrtype == dns.TypeOPT || !dns.IsSubDomain(s.zone, strings.ToLower(h.Name)) {
+			continue
+		}
+
+		key := fmt.Sprintf("%s/%d", strings.ToLower(h.Name), h.Rrtype)
+		if _, ok := rrsets[key]; !ok {
+			order = append(order, key)
+		}
+		rrsets[key] = append(rrsets[key], rr)
+	}
+
+	sigs := make([]dns.RR, 0, len(order))
+	for _, key := range order {
+		rrset := rrsets[key]
+		sig := &dns.RRSIG{
+			Hdr: dns.RR_Header{
+				Ttl: rrset[0].Header().Ttl,
+			},
+			Algorithm:  s.key.Algorithm,
+			KeyTag:     s.key.KeyTag(),
+			SignerName: s.zone,
+			Inception:  uint32(now.Add(-signatureInception).Unix()),
+			Expiration: uint32(now.Add(signatureExpiration).Unix()),
+		}
+		if err := sig.Sign(s.private, rrset); err != nil {
+			return nil, err
+		}
+		sigs = append(sigs, sig)
+	}
+	return sigs, nil
+}
+
+// bitmap returns the types that exist at name, excluding qtype. Every
+// name holds the types that default answers are synthesized for, so
+// that a resolver caching the denial (RFC 8198) does not deny the
+// other types of the name
+func (s *signer) bitmap(name string, qtype uint16) []uint16 {
+	types := append([]uint16{dns.TypeRRSIG}, synthesizedTypes...)
+	if _, ok := findRRSet(name, dns.TypeNS); ok && !strings.EqualFold(name, s.zone) {
+		// delegations only hold the NS records, and the NSEC that
+		// proves they have no DS records
+		types = []uint16{dns.TypeNS}
+		if !s.nsec3 {
+			types = append(types, dns.TypeRRSIG, dns.TypeNSEC)
+		}
+	} else if s.nsec3 {
+		if strings.EqualFold(name, s.zone) {
+			types = append(types, dns.TypeNS, dns.TypeSOA, dns.TypeDNSKEY, dns.TypeNSEC3PARAM)
+		}
+	} else {
+		types = append(types, dns.TypeNSEC)
+		if strings.EqualFold(name, s.zone) {
+			types = append(types, dns.TypeNS, dns.TypeSOA, dns.TypeDNSKEY)
+		}
+	}
+
+	bitmap := make([]uint16, 0, len(types))
+	for _, t := range types {
+		if t != qtype {
+			bitmap = append(bitmap, t)
+		}
+	}
+	// bitmaps must be in ascending order
+	sort.Slice(bitmap, func(i, j int) bool {
+		return bitmap[i] < bitmap[j]
+	})
+	return bitmap
+}
+
+// nsec returns a minimally covering NSEC for name that proves qtype
+// does not exist. NXDOMAIN answers are also denied this way, which
+// turns them into NODATA for validating resolvers
+func (s *signer) nsec(name string, qtype uint16) dns.RR {
+	return &dns.NSEC{
+		Hdr: dns.RR_Header{
+			Name:   name,
+			Rrtype: dns.TypeNSEC,
+			Class:  dns.ClassINET,
+			Ttl:    defaultTTL,
+		},
+		NextDomain: "\\000." + name,
+		TypeBitMap: s.bitmap(name, qtype),
+	}
+}
+
+// nsec3Hash offsets the base32hex hash of name by delta
+func nsec3Hash(name string, delta int64) string {
+	hash := dns.HashName(name, dns.SHA1, 0, "")
+	raw, _ := base32.HexEncoding.DecodeString(hash)
+
+	n := new(big.Int).SetBytes(raw)
+	n.Add(n, big.NewInt(delta))
+	// wrap around the ends of the hash space
+	n.Mod(n, new(big.Int).Lsh(big.NewInt(1), uint(len(raw)*8)))
+
+	offset := make([]byte, len(raw))
+	n.FillBytes(offset)
+	return base32.HexEncoding.EncodeToString(offset)
+}
+
+// nsec3Record returns an NSEC3 from the hash of name offset by delta that
+// ends just after the hash of name
+func (s *signer) nsec3Record(name string, delta int64, bitmap []uint16) dns.RR {
+	return &dns.NSEC3{
+		Hdr: dns.RR_Header{
+			Name:   strings.ToLower(nsec3Hash(name, delta)) + "." + s.zone,
+			Rrtype: dns.TypeNSEC3,
+			Class:  dns.ClassINET,
+			Ttl:    defaultTTL,
+		},
+		Hash:       dns.SHA1,
+		HashLength: 20,
+		NextDomain: nsec3Hash(name, 1),
+		TypeBitMap: bitmap,
+	}
+}
+
+// deny returns the records that prove the question has no answer
+func (s *signer) deny(q dns.Question, rcode int) []dns.RR {
+	name := strings.ToLower(q.Name)
+	if !s.nsec3 {
+		return []dns.RR{s.nsec(name, q.Qtype)}
+	}
+
+	if rcode == dns.RcodeSuccess {
+		// NODATA: an NSEC3 matching the name without the type
+		return []dns.RR{s.nsec3Record(name, 0, s.bitmap(name, q.Qtype))}
+	}
+
+	// NXDOMAIN: the closest encloser proof and the wildcard denial.
+	// Any name that is not denied exists, so the parent is the
+	// closest encloser
+	labels := dns.SplitDomainName(name)
+	encloser := dns.Fqdn(strings.Join(labels[1:], "."))
+	if len(labels) <= dns.CountLabel(s.zone) {
+		encloser = s.zone
+	}
+	return []dns.RR{
+		s.nsec3Record(encloser, 0, s.bitmap(encloser, 0)),
+		s.nsec3Record(name, -1, nil),
+		s.nsec3Record("*."+encloser, -1, nil),
+	}
+}
+
+// signMsg adds the signatures and denial of existence records to m
+func (s *signer) signMsg(r, m *dns.Msg) error {
+	if m.Rcode != dns.RcodeSuccess && m.Rcode != dns.RcodeNameError {
+		return nil
+	}
+
+	now := time.Now()
+	if cut, ok := referral(m); ok {
+		return s.signReferral(m, cut, now)
+	}
+
+	q := r.Question[0]
+	if m.Rcode == dns.RcodeNameError || len(m.Answer) == 0 {
+		m.Ns = append(m.Ns, s.soa())
+		m.Ns = append(m.Ns, s.deny(q, m.Rcode)...)
+		if !s.nsec3 {
+			m.Rcode = dns.RcodeSuccess
+		}
+	}
+
+	sigs, err := s.sign(m.Answer, now)
+	if err != nil {
+		return err
+	}
+	m.Answer = append(m.Answer, sigs...)
+
+	sigs, err = s.sign(m.Ns, now)
+	if err != nil {
+		return err
+	}
+	m.Ns = append(m.Ns, sigs...)
+	return nil
+}
+
+// referral returns the delegated name if m refers to its nameservers
+func referral(m *dns.Msg) (string, bool) {
+	if m.Authoritative || len(m.Answer) > 0 {
+		return "", false
+	}
+	for _, rr := range m.Ns {
+		if rr.Header().Rrtype == dns.TypeNS {
+			return strings.ToLower(rr.Header().Name), true
+		}
+	}
+	return "", false
+}
+
+// signReferral signs the DS records of the delegation in m or adds
+// the proof that it has none. The NS records belong to the delegated
+// zone and are not signed
+func (s *signer) signReferral(m *dns.Msg, cut string, now time.Time) error {
+	var ds []dns.RR
+	for _, rr := range m.Ns {
+		if rr.Header().Rrtype == dns.TypeDS {
+			ds = append(ds, rr)
+		}
+	}
+	if len(ds) == 0 {
+		ds = s.deny(dns.Question{Name: cut, Qtype: dns.TypeDS}, dns.RcodeSuccess)
+		m.Ns = append(m.Ns, ds...)
+	}
+
+	sigs, err := s.sign(ds, now)
+	if err != nil {
+		return err
+	}
+	m.Ns = append(m.Ns, sigs...)
+	return nil
+}
+
+// signerForName returns the signer of the zone that contains name
+func (s *server) signerForName(name string) (*signer, bool) {
+	var match *signer
+	for _, sg := range s.Signers {
+		if dns.IsSubDomain(sg.zone, strings.ToLower(name)) && (match == nil || len(sg.zone) > len(match.zone)) {
+			match = sg
+		}
+	}
+	return match, match != nil
+}
+
+// signingWriter signs messages before they are written. It is only
+// used for requests that set the DNSSEC OK bit
+type signingWriter struct {
+	dns.ResponseWriter
+	signer  *signer
+	request *dns.Msg
+}
+
+// WriteMsg signs m and truncates it to the size the client accepts.
+// m is copied since it is also published as an interaction
+func (w *signingWriter) WriteMsg(m *dns.Msg) error {
+	m = m.Copy()
+	if err := w.signer.signMsg(w.request, m); err != nil {
+		log.Error().Msgf("failed to sign DNS answer: %v", err)
+		m.Answer, m.Ns = nil, nil
+		m.Rcode = dns.RcodeServerFailure
+	}
+
+	size := dns.MinMsgSize
+	if opt := w.request.IsEdns0(); opt != nil {
+		size = int(opt.UDPSize())
+		m.SetEdns0(opt.UDPSize(), true)
+	}
+	if _, ok := w.RemoteAddr().(*net.UDPAddr); ok {
+		m.Truncate(size)
+	}
+
+	return w.ResponseWriter.WriteMsg(m)
+}
+
+// dnssecHandler answers the apex records of a signed zone
+func (s *server) dnssecHandler(w dns.ResponseWriter, r *dns.Msg, rrs []dns.RR) {
+	m := new(dns.Msg)
+	m.SetReply(r)
+
+	m.Authoritative = true
+
+	m.Answer = append(m.Answer, rrs...)
+	log.Debug().Msgf("replied to apex question %v with answer %v", m.Question, m.Answer)
+
+	go s.interactionHandler(r, m, w.RemoteAddr())
+	if err := w.WriteMsg(m); err != nil {
+		log.Error().Msgf("failed to response to DNS query: %v", m)
+	}
+}
@@ -0,0 +1,290 @@
+package bind
+
+import (
+	"fmt"
+	"net"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"github.com/tmoneypenny/conspirator/internal/pkg/encoding"
+	"github.com/tmoneypenny/conspirator/internal/pkg/polling"
+	"github.com/tmoneypenny/conspirator/internal/pkg/util"
+)
+
+// newTestSigner generates a key in a temporary directory
+func newTestSigner(t *testing.T, nsec3 bool) *signer {
+	sg, err := newSigner(DNSSECConfig{
+		Zone:    util.StrToPtr("src.properties"),
+		KeyFile: util.StrToPtr(filepath.Join(t.TempDir(), "Ksrc.properties")),
+		NSEC3:   nsec3,
+	})
+	assert.NoError(t, err)
+	return sg
+}
+
+// verify checks every RRSIG in rrs against the RRset it covers
+func verify(t *testing.T, sg *signer, rrs []dns.RR) int {
+	verified := 0
+	for _, rr := range rrs {
+		sig, ok := rr.(*dns.RRSIG)
+		if !ok {
+			continue
+		}
+
+		var rrset []dns.RR
+		for _, covered := range rrs {
+			if covered.Header().Rrtype == sig.TypeCovered && strings.EqualFold(covered.Header().Name, sig.Hdr.Name) {
+				rrset = append(rrset, covered)
+			}
+		}
+		assert.NoError(t, sig.Verify(sg.key, rrset), sig.String())
+		assert.True(t, sig.ValidityPeriod(time.Now()))
+		verified++
+	}
+	return verified
+}
+
+func TestSignerKeys(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "Ksrc.properties")
+	cfg := DNSSECConfig{
+		Zone:      util.StrToPtr("src.properties"),
+		KeyFile:   &path,
+		Algorithm: util.StrToPtr("ED25519"),
+	}
+
+	generated, err := newSigner(cfg)
+	assert.NoError(t, err)
+	assert.Equal(t, uint8(dns.ED25519), generated.key.Algorithm)
+	assert.Equal(t, uint16(dns.ZONE|dns.SEP), generated.key.Flags)
+
+	// the existing key pair is imported instead of replaced
+	imported, err := newSigner(cfg)
+	assert.NoError(t, err)
+	assert.Equal(t, generated.key.KeyTag(), imported.key.KeyTag())
+	assert.Equal(t, generated.ds().String(), imported.ds().String())
+	assert.Equal(t, uint8(dns.SHA256), imported.ds().DigestType)
+
+	ds, err := DS(cfg)
+	assert.NoError(t, err)
+	assert.Equal(t, generated.ds().String(), ds)
+
+	// keys must belong to the zone
+	cfg.Zone = util.StrToPtr("other.properties")
+	_, err = newSigner(cfg)
+	assert.Error(t, err)
+
+	_, err = newSigner(DNSSECConfig{
+		Zone:      util.StrToPtr("src.properties"),
+		KeyFile:   util.StrToPtr(filepath.Join(t.TempDir(), "Ksrc.properties")),
+		Algorithm: util.StrToPtr("MD5"),
+	})
+	assert.Error(t, err)
+}
+
+func TestSignAnswer(t *testing.T) {
+	sg := newTestSigner(t, false)
+
+	r := new(dns.Msg)
+	r.SetQuestion("abc.src.properties.", dns.TypeA)
+	m := new(dns.Msg)
+	m.SetReply(r)
+	m.Answer, _ = builtinProfile.answer(r.Question[0], "src.properties.", nil)
+
+	assert.NoError(t, sg.signMsg(r, m))
+	assert.Len(t, m.Answer, 2)
+	assert.Equal(t, 1, verify(t, sg, m.Answer))
+
+	rrs, ok := sg.apexAnswer(dns.Question{Name: "SRC.properties.", Qtype: dns.TypeDNSKEY})
+	assert.True(t, ok)
+	sigs, err := sg.sign(rrs, time.Now())
+	assert.NoError(t, err)
+	assert.Equal(t, 1, verify(t, sg, append(rrs, sigs...)))
+
+	// names outside of the zone are not signed
+	sigs, err = sg.sign([]dns.RR{&dns.A{Hdr: dns.RR_Header{Name: "other.properties.", Rrtype: dns.TypeA, Class: dns.ClassINET}}}, time.Now())
+	assert.NoError(t, err)
+	assert.Empty(t, sigs)
+}
+
+func TestSignNSEC(t *testing.T) {
+	sg := newTestSigner(t, false)
+
+	r := new(dns.Msg)
+	r.SetQuestion("abc.src.properties.", dns.TypeDS)
+	m := new(dns.Msg)
+	m.SetReply(r)
+	m.SetRcode(r, dns.RcodeNameError)
+
+	// NXDOMAIN is denied as NODATA
+	assert.NoError(t, sg.signMsg(r, m))
+	assert.Equal(t, dns.RcodeSuccess, m.Rcode)
+	assert.Equal(t, 2, verify(t, sg, m.Ns))
+
+	var nsec *dns.NSEC
+	for _, rr := range m.Ns {
+		if n, ok := rr.(*dns.NSEC); ok {
+			nsec = n
+		}
+	}
+	assert.Equal(t, "abc.src.properties.", nsec.Hdr.Name)
+	assert.Equal(t, "\\000.abc.src.properties.", nsec.NextDomain)
+	assert.Contains(t, nsec.TypeBitMap, dns.TypeNSEC)
+	assert.NotContains(t, nsec.TypeBitMap, dns.TypeDS)
+	assert.NotContains(t, nsec.TypeBitMap, dns.TypeNS)
+
+	// the denial of one type must not deny the synthesized types
+	nsec = sg.nsec("abc.src.properties.", dns.TypeMX).(*dns.NSEC)
+	assert.NotContains(t, nsec.TypeBitMap, dns.TypeMX)
+	for _, qtype := range []uint16{dns.TypeA, dns.TypeAAAA, dns.TypeTXT, dns.TypeHTTPS} {
+		assert.Contains(t, nsec.TypeBitMap, qtype, dns.TypeToString[qtype])
+	}
+	assert.NotContains(t, nsec.TypeBitMap, dns.TypeCNAME)
+	assert.IsIncreasing(t, nsec.TypeBitMap)
+}
+
+func TestSignNSEC3(t *testing.T) {
+	sg := newTestSigner(t, true)
+
+	r := new(dns.Msg)
+	r.SetQuestion("abc.def.src.properties.", dns.TypeA)
+	m := new(dns.Msg)
+	m.SetReply(r)
+	m.SetRcode(r, dns.RcodeNameError)
+
+	assert.NoError(t, sg.signMsg(r, m))
+	assert.Equal(t, dns.RcodeNameError, m.Rcode)
+	assert.Equal(t, 4, verify(t, sg, m.Ns))
+
+	var nsec3 []*dns.NSEC3
+	for _, rr := range m.Ns {
+		if n, ok := rr.(*dns.NSEC3); ok {
+			nsec3 = append(nsec3, n)
+		}
+	}
+	assert.Len(t, nsec3, 3)
+	assert.True(t, nsec3[0].Match("def.src.properties."))
+	assert.True(t, nsec3[1].Cover("abc.def.src.properties."))
+	assert.True(t, nsec3[2].Cover("*.def.src.properties."))
+	// the proofs must not deny the existence of other names
+	assert.False(t, nsec3[1].Cover("xyz.def.src.properties."))
+
+	// NODATA matches the name without the type
+	r.SetQuestion("abc.src.properties.", dns.TypeAAAA)
+	m = new(dns.Msg)
+	m.SetReply(r)
+
+	assert.NoError(t, sg.signMsg(r, m))
+	assert.Equal(t, dns.RcodeSuccess, m.Rcode)
+	nsec3 = nil
+	for _, rr := range m.Ns {
+		if n, ok := rr.(*dns.NSEC3); ok {
+			nsec3 = append(nsec3, n)
+		}
+	}
+	assert.Len(t, nsec3, 1)
+	assert.True(t, nsec3[0].Match("abc.src.properties."))
+	assert.NotContains(t, nsec3[0].TypeBitMap, dns.TypeAAAA)
+	assert.Contains(t, nsec3[0].TypeBitMap, dns.TypeA)
+	assert.Contains(t, nsec3[0].TypeBitMap, dns.TypeTXT)
+
+	rrs, ok := sg.apexAnswer(dns.Question{Name: "src.properties.", Qtype: dns.TypeNSEC3PARAM})
+	assert.True(t, ok)
+	assert.Len(t, rrs, 1)
+}
+
+// msgWriter keeps the written message of a UDP client
+type msgWriter struct {
+	dns.ResponseWriter
+	msg *dns.Msg
+}
+
+func (w *msgWriter) LocalAddr() net.Addr {
+	return &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 53}
+}
+
+func (w *msgWriter) RemoteAddr() net.Addr {
+	return &net.UDPAddr{IP: net.IPv4(127, 0, 0, 2), Port: 5353}
+}
+
+func (w *msgWriter) WriteMsg(m *dns.Msg) error {
+	w.msg = m
+	return nil
+}
+
+// TestSignedAnswerInteraction verifies signing does not change the
+// answer published as an interaction. Run with -race
+func TestSignedAnswerInteraction(t *testing.T) {
+	pm := polling.New(&polling.PollingConfig{MaxBufferSize: 100, DeleteAfter: true}).Start()
+	defer pm.Stop()
+
+	sg := newTestSigner(t, false)
+	s := &server{
+		Zones:         []string{"src.properties"},
+		Defaults:      map[string]*defaultProfile{},
+		Signers:       []*signer{sg},
+		PollingServer: pm,
+		Marshaller:    encoding.NewMarshaller(encoding.Format("burp")),
+		PublicAddress: "127.0.0.1",
+	}
+
+	for i := 0; i < 20; i++ {
+		for _, qtype := range []uint16{dns.TypeA, dns.TypeDS} {
+			r := new(dns.Msg)
+			r.SetQuestion(fmt.Sprintf("q%d.src.properties.", i), qtype)
+			r.SetEdns0(dns.DefaultMsgSize, true)
+
+			w := &msgWriter{}
+			s.routeHandler(w, r)
+			assert.NotZero(t, verify(t, sg, append(w.msg.Answer, w.msg.Ns...)), r.Question[0].String())
+		}
+	}
+
+	published := 0
+	assert.Eventually(t, func() bool {
+		published += len(pm.ReadAll())
+		return published == 40
+	}, time.Second, 10*time.Millisecond)
+}
+
+func TestSignReferral(t *testing.T) {
+	sg := newTestSigner(t, false)
+
+	delegation := &Record{FQDN: util.StrToPtr("sub.src.properties"), RecordType: util.StrToPtr("NS"), TTL: util.Uint32ToPtr(30), Value: "ns.other.src"}
+	assert.NoError(t, upsertRRS(delegation))
+	defer deleteRecord(delegation)
+	ns, _ := findRRSet("sub.src.properties.", dns.TypeNS)
+
+	r := new(dns.Msg)
+	r.SetQuestion("a.sub.src.properties.", dns.TypeA)
+	m := new(dns.Msg)
+	m.SetReply(r)
+	m.Ns = append(m.Ns, ns...)
+
+	// the NS records are not signed and the NSEC proves there is no DS
+	assert.NoError(t, sg.signMsg(r, m))
+	assert.Equal(t, 1, verify(t, sg, m.Ns))
+	var nsec *dns.NSEC
+	for _, rr := range m.Ns {
+		if n, ok := rr.(*dns.NSEC); ok {
+			nsec = n
+		}
+	}
+	assert.Equal(t, "sub.src.properties.", nsec.Hdr.Name)
+	assert.Equal(t, []uint16{dns.TypeNS, dns.TypeRRSIG, dns.TypeNSEC}, nsec.TypeBitMap)
+
+	// the DS records are signed instead
+	assert.NoError(t, upsertRRS(&Record{FQDN: util.StrToPtr("sub.src.properties"), RecordType: util.StrToPtr("DS"), TTL: util.Uint32ToPtr(30), Value: "60485 5 1 2BB183AF5F22588179A53B0A98631FAD1A292118"}))
+	ds, _ := findRRSet("sub.src.properties.", dns.TypeDS)
+	m = new(dns.Msg)
+	m.SetReply(r)
+	m.Ns = append(append(m.Ns, ns...), ds...)
+
+	assert.NoError(t, sg.signMsg(r, m))
+	assert.Len(t, m.Ns, 3)
+	assert.Equal(t, 1, verify(t, sg, m.Ns))
+	assert.Equal(t, dns.TypeDS, m.Ns[2].(*dns.RRSIG).TypeCovered)
+}
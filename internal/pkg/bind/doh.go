@@ -0,0 +1,168 @@
+package bind
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/miekg/dns"
+	"github.com/rs/zerolog/log"
+	httpEncoding "github.com/tmoneypenny/conspirator/internal/pkg/encoding/http"
+)
+
+// DoH defaults from RFC 8484
+const (
+	dohNet         = "doh"
+	dohPath        = "/dns-query"
+	dohContentType = "application/dns-message"
+)
+
+// dohAddr is the address of a DoH client. It carries the HTTP request
+// so that it can be recorded with the interaction
+type dohAddr struct {
+	addr    string
+	request []byte
+}
+
+// Network returns the transport name recorded with interactions
+func (a *dohAddr) Network() string { return dohNet }
+
+func (a *dohAddr) String() string { return a.addr }
+
+// dohResponseWriter implements dns.ResponseWriter for a single DoH
+// request. The message written by the handler is kept until the
+// HTTP response is sent
+type dohResponseWriter struct {
+	localAddr  net.Addr
+	remoteAddr *dohAddr
+	msg        *dns.Msg
+}
+
+func (w *dohResponseWriter) LocalAddr() net.Addr  { return w.localAddr }
+func (w *dohResponseWriter) RemoteAddr() net.Addr { return w.remoteAddr }
+
+func (w *dohResponseWriter) WriteMsg(m *dns.Msg) error {
+	w.msg = m
+	return nil
+}
+
+func (w *dohResponseWriter) Write(b []byte) (int, error) {
+	m := new(dns.Msg)
+	if err := m.Unpack(b); err != nil {
+		return 0, err
+	}
+	w.msg = m
+	return len(b), nil
+}
+
+func (w *dohResponseWriter) Close() error { return nil }
+
+// TsigStatus always fails since TSIG is not verified over DoH
+func (w *dohResponseWriter) TsigStatus() error { return dns.ErrAuth }
+
+func (w *dohResponseWriter) TsigTimersOnly(bool) {}
+func (w *dohResponseWriter) Hijack()             {}
+
+// newDoHServer returns an HTTP server that answers DoH queries at path
+func newDoHServer(addr, path string, handler dns.Handler) *http.Server {
+	if path == "" {
+		path = dohPath
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc(path, func(rw http.ResponseWriter, req *http.Request) {
+		dohHandler(rw, req, handler)
+	})
+
+	return &http.Server{
+		Addr:    addr,
+		Handler: mux,
+	}
+}
+
+// readDoHQuery returns the DNS query in a GET or POST request
+func readDoHQuery(req *http.Request) ([]byte, int, error) {
+	switch req.Method {
+	case http.MethodGet:
+		query, err := base64.RawURLEncoding.DecodeString(req.URL.Query().Get("dns"))
+		if err != nil || len(query) == 0 {
+			return nil, http.StatusBadRequest, fmt.Errorf("invalid dns parameter")
+		}
+		return query, http.StatusOK, nil
+	case http.MethodPost:
+		if !strings.EqualFold(req.Header.Get("Content-Type"), dohContentType) {
+			return nil, http.StatusUnsupportedMediaType, fmt.Errorf("unsupported content type")
+		}
+		query, err := ioutil.ReadAll(io.LimitReader(req.Body, dns.MaxMsgSize+1))
+		if err != nil || len(query) == 0 || len(query) > dns.MaxMsgSize {
+			return nil, http.StatusBadRequest, fmt.Errorf("invalid request body")
+		}
+		// restore the body so it is included in the recorded request
+		req.Body = ioutil.NopCloser(bytes.NewReader(query))
+		return query, http.StatusOK, nil
+	}
+	return nil, http.StatusMethodNotAllowed, fmt.Errorf("method not allowed")
+}
+
+// dohHandler unpacks the query and routes it to the DNS handler
+func dohHandler(rw http.ResponseWriter, req *http.Request, handler dns.Handler) {
+	query, status, err := readDoHQuery(req)
+	if err != nil {
+		http.Error(rw, err.Error(), status)
+		return
+	}
+
+	r := new(dns.Msg)
+	if err := r.Unpack(query); err != nil || len(r.Question) != 1 {
+		http.Error(rw, "invalid DNS message", http.StatusBadRequest)
+		return
+	}
+
+	w := &dohResponseWriter{
+		remoteAddr: &dohAddr{
+			addr:    req.RemoteAddr,
+			request: httpEncoding.WriteRequest(req),
+		},
+	}
+	if addr, ok := req.Context().Value(http.LocalAddrContextKey).(net.Addr); ok {
+		w.localAddr = addr
+	}
+
+	handler.ServeDNS(w, r)
+	if w.msg == nil {
+		http.Error(rw, "no answer", http.StatusInternalServerError)
+		return
+	}
+
+	answer, err := w.msg.Pack()
+	if err != nil {
+		log.Error().Msgf("failed to pack DoH answer: %v", err)
+		http.Error(rw, "invalid answer", http.StatusInternalServerError)
+		return
+	}
+
+	rw.Header().Set("Content-Type", dohContentType)
+	rw.Header().Set("Cache-Control", fmt.Sprintf("max-age=%d", minTTL(w.msg)))
+	rw.Write(answer)
+}
+
+// minTTL is the freshness lifetime of the answer as defined in
+// RFC 8484 section 5.1
+func minTTL(m *dns.Msg) uint32 {
+	var ttl uint32
+	first := true
+	for _, section := range [][]dns.RR{m.Answer, m.Ns} {
+		for _, rr := range section {
+			if first || rr.Header().Ttl < ttl {
+				ttl = rr.Header().Ttl
+				first = false
+			}
+		}
+	}
+	return ttl
+}
@@ -0,0 +1,74 @@
+package bind
+
+import (
+	"bytes"
+	"encoding/base64"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDoHHandler(t *testing.T) {
+	var remote dns.ResponseWriter
+	mux := dns.NewServeMux()
+	mux.HandleFunc("src.properties.", func(w dns.ResponseWriter, r *dns.Msg) {
+		remote = w
+		m := new(dns.Msg)
+		m.SetReply(r)
+		m.Answer, _ = builtinProfile.answer(r.Question[0], "src.properties.", nil)
+		w.WriteMsg(m)
+	})
+
+	svr := httptest.NewServer(newDoHServer("", "", mux).Handler)
+	defer svr.Close()
+
+	q := new(dns.Msg)
+	q.SetQuestion("abc.src.properties.", dns.TypeTXT)
+	query, _ := q.Pack()
+
+	get := func(param string) *http.Response {
+		resp, err := http.Get(svr.URL + dohPath + "?dns=" + param)
+		assert.NoError(t, err)
+		return resp
+	}
+	post := func(contentType string, body []byte) *http.Response {
+		resp, err := http.Post(svr.URL+dohPath, contentType, bytes.NewReader(body))
+		assert.NoError(t, err)
+		return resp
+	}
+
+	for _, resp := range []*http.Response{
+		get(base64.RawURLEncoding.EncodeToString(query)),
+		post(dohContentType, query),
+	} {
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Equal(t, dohContentType, resp.Header.Get("Content-Type"))
+		assert.Equal(t, "max-age=30", resp.Header.Get("Cache-Control"))
+
+		body, _ := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		m := new(dns.Msg)
+		assert.NoError(t, m.Unpack(body))
+		assert.Equal(t, q.Id, m.Id)
+		assert.Len(t, m.Answer, 1)
+
+		assert.Equal(t, "doh", remote.RemoteAddr().Network())
+		assert.Contains(t, string(remote.RemoteAddr().(*dohAddr).request), dohPath)
+	}
+
+	// the POST body is kept in the recorded request
+	assert.True(t, bytes.HasSuffix(remote.RemoteAddr().(*dohAddr).request, query))
+
+	assert.Equal(t, http.StatusBadRequest, get("not-base64!").StatusCode)
+	assert.Equal(t, http.StatusBadRequest, get(base64.RawURLEncoding.EncodeToString([]byte{0, 1})).StatusCode)
+	assert.Equal(t, http.StatusUnsupportedMediaType, post("text/plain", query).StatusCode)
+
+	req, _ := http.NewRequest(http.MethodPut, svr.URL+dohPath, bytes.NewReader(query))
+	resp, err := http.DefaultClient.Do(req)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusMethodNotAllowed, resp.StatusCode)
+}
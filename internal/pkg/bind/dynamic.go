@@ -0,0 +1,109 @@
+package bind
+
+import (
+	"encoding/hex"
+	"net"
+	"strings"
+
+	"github.com/miekg/dns"
+)
+
+// Labels used to request an encoded-IP answer. The label must sit
+// directly below the zone apex, e.g. 10-0-0-1.ip.<zone> or
+// 0a000001.hex.<zone>. Any labels to the left of the encoded
+// address are ignored so interaction IDs can still be prefixed.
+const (
+	dottedIPLabel = "ip"
+	hexIPLabel    = "hex"
+)
+
+// zoneForName returns the longest configured zone that contains name
+func zoneForName(name string, zones []string) (string, bool) {
+	var match string
+	for _, z := range zones {
+		z = dns.Fqdn(z)
+		if dns.IsSubDomain(z, name) && len(z) > len(match) {
+			match = z
+		}
+	}
+	return match, match != ""
+}
+
+// resolveEncodedIP checks if the question name contains an IP address
+// encoded in the label preceding the ip or hex label. The address is
+// returned along with true if a valid address was found
+func resolveEncodedIP(name string, zones []string) (net.IP, bool) {
+	name = strings.ToLower(dns.Fqdn(name))
+	zone, ok := zoneForName(name, zones)
+	if !ok {
+		return nil, false
+	}
+
+	labels := dns.SplitDomainName(strings.TrimSuffix(name, strings.ToLower(zone)))
+	if len(labels) < 2 {
+		return nil, false
+	}
+
+	encoded := labels[len(labels)-2]
+	switch labels[len(labels)-1] {
+	case dottedIPLabel:
+		// dotted form: app.10.0.0.1.ip.<zone>
+		if len(labels) >= 5 {
+			if ip := net.ParseIP(strings.Join(labels[len(labels)-5:len(labels)-1], ".")).To4(); ip != nil {
+				return ip, true
+			}
+		}
+		// dashed form: 10-0-0-1.ip.<zone> or 2001-db8--1.ip.<zone>
+		if ip := net.ParseIP(strings.ReplaceAll(encoded, "-", ".")).To4(); ip != nil {
+			return ip, true
+		}
+		if ip := net.ParseIP(strings.ReplaceAll(encoded, "-", ":")); ip != nil {
+			return ip, true
+		}
+	case hexIPLabel:
+		raw, err := hex.DecodeString(encoded)
+		if err != nil {
+			return nil, false
+		}
+		switch len(raw) {
+		case net.IPv4len:
+			return net.IP(raw).To4(), true
+		case net.IPv6len:
+			return net.IP(raw), true
+		}
+	}
+
+	return nil, false
+}
+
+// encodedIPAnswer builds the answer for an encoded-IP question. The
+// returned bool is false if the name is not an encoded-IP name or the
+// question type is not A or AAAA. An empty answer is returned when the
+// address family does not match the question type (NODATA)
+func encodedIPAnswer(q dns.Question, zones []string) ([]dns.RR, bool) {
+	if q.Qtype != dns.TypeA && q.Qtype != dns.TypeAAAA {
+		return nil, false
+	}
+
+	ip, ok := resolveEncodedIP(q.Name, zones)
+	if !ok {
+		return nil, false
+	}
+
+	header := dns.RR_Header{
+		Name:   q.Name,
+		Rrtype: q.Qtype,
+		Class:  dns.ClassINET,
+		Ttl:    30,
+	}
+
+	v4 := ip.To4()
+	switch {
+	case q.Qtype == dns.TypeA && v4 != nil:
+		return []dns.RR{&dns.A{Hdr: header, A: v4}}, true
+	case q.Qtype == dns.TypeAAAA && v4 == nil:
+		return []dns.RR{&dns.AAAA{Hdr: header, AAAA: ip}}, true
+	}
+
+	return []dns.RR{}, true
+}
@@ -0,0 +1,71 @@
+package bind
+
+import (
+	"net"
+	"testing"
+
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestResolveEncodedIP(t *testing.T) {
+	zones := []string{"test.example.company", "example.company"}
+
+	testCases := []struct {
+		input    string
+		expected net.IP
+		found    bool
+	}{
+		{"10-0-0-1.ip.test.example.company.", net.ParseIP("10.0.0.1"), true},
+		{"abc123.10-0-0-1.ip.test.example.company.", net.ParseIP("10.0.0.1"), true},
+		{"app.192.168.1.20.ip.test.example.company", net.ParseIP("192.168.1.20"), true},
+		{"0a000001.hex.test.example.company.", net.ParseIP("10.0.0.1"), true},
+		{"fd000000000000000000000000000001.hex.example.company.", net.ParseIP("fd00::1"), true},
+		{"fd00--1.ip.example.company.", net.ParseIP("fd00::1"), true},
+		{"10-0-0-1.IP.TEST.example.company.", net.ParseIP("10.0.0.1"), true},
+		{"10-0-0.ip.test.example.company.", nil, false},
+		{"0a0000.hex.test.example.company.", nil, false},
+		{"zz000001.hex.test.example.company.", nil, false},
+		{"10-0-0-1.test.example.company.", nil, false},
+		{"ip.test.example.company.", nil, false},
+		{"10-0-0-1.ip.other.company.", nil, false},
+	}
+
+	for _, tc := range testCases {
+		ip, found := resolveEncodedIP(tc.input, zones)
+		assert.Equal(t, tc.found, found, tc.input)
+		if tc.found {
+			assert.True(t, tc.expected.Equal(ip), tc.input)
+		}
+	}
+}
+
+func TestEncodedIPAnswer(t *testing.T) {
+	zones := []string{"test.example.company"}
+
+	rrs, ok := encodedIPAnswer(dns.Question{
+		Name:   "10-0-0-1.ip.test.example.company.",
+		Qtype:  dns.TypeA,
+		Qclass: dns.ClassINET,
+	}, zones)
+	assert.True(t, ok)
+	assert.Len(t, rrs, 1)
+	assert.Equal(t, "10.0.0.1", rrs[0].(*dns.A).A.String())
+
+	// address family mismatch returns NODATA
+	rrs, ok = encodedIPAnswer(dns.Question{
+		Name:   "10-0-0-1.ip.test.example.company.",
+		Qtype:  dns.TypeAAAA,
+		Qclass: dns.ClassINET,
+	}, zones)
+	assert.True(t, ok)
+	assert.Empty(t, rrs)
+
+	// other types are handled by the defaults
+	_, ok = encodedIPAnswer(dns.Question{
+		Name:   "10-0-0-1.ip.test.example.company.",
+		Qtype:  dns.TypeTXT,
+		Qclass: dns.ClassINET,
+	}, zones)
+	assert.False(t, ok)
+}
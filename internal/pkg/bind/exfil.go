@@ -0,0 +1,182 @@
+package bind
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/miekg/dns"
+	"github.com/tmoneypenny/conspirator/internal/pkg/encoding"
+)
+
+// Limits on the exfil cache to prevent an unbounded number of
+// sessions or chunks from being stored in memory
+const (
+	maxExfilSessions = 256
+	maxExfilChunks   = 4096
+)
+
+// exfilMutex provides a lock for the exfilCache hashmap
+var exfilMutex = &sync.RWMutex{}
+
+// exfilCache maps an interaction ID to the chunks received for it
+var exfilCache = make(map[string]*exfilSession)
+
+// exfilSession stores chunks keyed by sequence so that resolver
+// retries do not duplicate data
+type exfilSession struct {
+	Chunks    map[int]string
+	ClientIPs map[string]struct{}
+	FirstSeen time.Time
+	LastSeen  time.Time
+}
+
+// ExfilPayload is a reassembled exfil session
+type ExfilPayload struct {
+	InteractionID string    `json:"interactionId"`
+	Chunks        int       `json:"chunks"`
+	Missing       []int     `json:"missing"`
+	Encoding      string    `json:"encoding"`
+	Data          []byte    `json:"data"`
+	Error         string    `json:"error,omitempty"`
+	ClientIPs     []string  `json:"clients"`
+	FirstSeen     time.Time `json:"firstSeen"`
+	LastSeen      time.Time `json:"lastSeen"`
+}
+
+// parseExfilName splits a name in the format <seq>.<chunk>.<id>.<zone>
+// into the interaction ID and chunk. Names that do not match the
+// format return false
+func parseExfilName(name string, zones []string) (string, encoding.ExfilChunk, bool) {
+	name = strings.ToLower(dns.Fqdn(name))
+	zone, ok := zoneForName(name, zones)
+	if !ok {
+		return "", encoding.ExfilChunk{}, false
+	}
+
+	labels := dns.SplitDomainName(strings.TrimSuffix(name, strings.ToLower(zone)))
+	if len(labels) < 3 {
+		return "", encoding.ExfilChunk{}, false
+	}
+
+	id := labels[len(labels)-1]
+	chunk := labels[len(labels)-2]
+	seq, err := strconv.Atoi(labels[len(labels)-3])
+	if err != nil || seq < 0 || seq >= maxExfilChunks || !encoding.IsExfilChunk(chunk) {
+		return "", encoding.ExfilChunk{}, false
+	}
+
+	return id, encoding.ExfilChunk{Sequence: seq, Data: chunk}, true
+}
+
+// recordExfil adds the chunk in the question name to the exfil cache
+func recordExfil(name, clientIP string, zones []string) {
+	id, chunk, ok := parseExfilName(name, zones)
+	if !ok {
+		return
+	}
+
+	now := time.Now()
+	exfilMutex.Lock()
+	defer exfilMutex.Unlock()
+
+	session, found := exfilCache[id]
+	if !found {
+		if len(exfilCache) >= maxExfilSessions {
+			evictOldestExfil()
+		}
+		session = &exfilSession{
+			Chunks:    make(map[int]string),
+			ClientIPs: make(map[string]struct{}),
+			FirstSeen: now,
+		}
+		exfilCache[id] = session
+	}
+
+	session.Chunks[chunk.Sequence] = chunk.Data
+	session.ClientIPs[encoding.RemovePortFromClientIP(clientIP)] = struct{}{}
+	session.LastSeen = now
+}
+
+// evictOldestExfil removes the least recently updated session.
+// The caller must hold exfilMutex
+func evictOldestExfil() {
+	var oldest string
+	for id, s := range exfilCache {
+		if oldest == "" || s.LastSeen.Before(exfilCache[oldest].LastSeen) {
+			oldest = id
+		}
+	}
+	delete(exfilCache, oldest)
+}
+
+// reassemble decodes the session into an ExfilPayload. The caller
+// must hold exfilMutex
+func (s *exfilSession) reassemble(id string) *ExfilPayload {
+	chunks := make([]encoding.ExfilChunk, 0, len(s.Chunks))
+	for seq, data := range s.Chunks {
+		chunks = append(chunks, encoding.ExfilChunk{Sequence: seq, Data: data})
+	}
+
+	clients := make([]string, 0, len(s.ClientIPs))
+	for ip := range s.ClientIPs {
+		clients = append(clients, ip)
+	}
+	sort.Strings(clients)
+
+	_, missing := encoding.OrderExfilChunks(chunks)
+	payload := &ExfilPayload{
+		InteractionID: id,
+		Chunks:        len(chunks),
+		Missing:       missing,
+		ClientIPs:     clients,
+		FirstSeen:     s.FirstSeen,
+		LastSeen:      s.LastSeen,
+	}
+
+	data, enc, err := encoding.DecodeExfil(chunks)
+	if err != nil {
+		payload.Error = err.Error()
+		return payload
+	}
+
+	payload.Data = data
+	payload.Encoding = enc
+	return payload
+}
+
+// findExfil returns the reassembled payload for an interaction ID
+func findExfil(id string) (*ExfilPayload, bool) {
+	exfilMutex.RLock()
+	defer exfilMutex.RUnlock()
+
+	session, ok := exfilCache[strings.ToLower(id)]
+	if !ok {
+		return nil, false
+	}
+	return session.reassemble(strings.ToLower(id)), true
+}
+
+// listExfil returns all reassembled payloads ordered by first seen
+func listExfil() []*ExfilPayload {
+	exfilMutex.RLock()
+	defer exfilMutex.RUnlock()
+
+	payloads := make([]*ExfilPayload, 0, len(exfilCache))
+	for id, session := range exfilCache {
+		payloads = append(payloads, session.reassemble(id))
+	}
+	sort.Slice(payloads, func(i, j int) bool {
+		return payloads[i].FirstSeen.Before(payloads[j].FirstSeen)
+	})
+	return payloads
+}
+
+// deleteExfil is a noop if the key is absent
+func deleteExfil(id string) {
+	exfilMutex.Lock()
+	delete(exfilCache, strings.ToLower(id))
+	exfilMutex.Unlock()
+}
@@ -0,0 +1,49 @@
+package bind
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseExfilName(t *testing.T) {
+	zones := []string{"test.example.company"}
+
+	id, chunk, ok := parseExfilName("3.MFRGG.abc123.test.example.company.", zones)
+	assert.True(t, ok)
+	assert.Equal(t, "abc123", id)
+	assert.Equal(t, 3, chunk.Sequence)
+	assert.Equal(t, "mfrgg", chunk.Data)
+
+	for _, name := range []string{
+		"abc123.test.example.company.",
+		"MFRGG.abc123.test.example.company.",
+		"x.MFRGG.abc123.test.example.company.",
+		"1.MF-GG.abc123.test.example.company.",
+		"1.MFRGG.abc123.other.company.",
+	} {
+		_, _, ok := parseExfilName(name, zones)
+		assert.False(t, ok, name)
+	}
+}
+
+func TestRecordExfil(t *testing.T) {
+	zones := []string{"test.example.company"}
+	defer deleteExfil("exfiltest")
+
+	// sent out of order and with a retried chunk
+	recordExfil("1.6f6f.exfiltest.test.example.company.", "10.0.0.1:5353", zones)
+	recordExfil("0.666f.exfiltest.test.example.company.", "10.0.0.2:5353", zones)
+	recordExfil("1.6f6f.exfiltest.test.example.company.", "10.0.0.1:5353", zones)
+
+	payload, found := findExfil("exfiltest")
+	assert.True(t, found)
+	assert.Equal(t, 2, payload.Chunks)
+	assert.Equal(t, "fooo", string(payload.Data))
+	assert.Equal(t, []string{"10.0.0.1", "10.0.0.2"}, payload.ClientIPs)
+	assert.Empty(t, payload.Missing)
+
+	deleteExfil("exfiltest")
+	_, found = findExfil("exfiltest")
+	assert.False(t, found)
+}
@@ -0,0 +1,305 @@
+package bind
+
+import (
+	"fmt"
+	"net"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/miekg/dns"
+	"github.com/rs/zerolog/log"
+)
+
+// Policy actions
+const (
+	PolicyAnswer   = "answer"
+	PolicyNXDomain = "nxdomain"
+	PolicyRefused  = "refused"
+	PolicyServFail = "servfail"
+)
+
+var (
+	invalidPolicyAction  error = fmt.Errorf("Invalid policy action")
+	invalidPolicyCIDR    error = fmt.Errorf("Invalid policy client CIDR")
+	invalidPolicyPattern error = fmt.Errorf("Invalid policy name pattern")
+	invalidPolicyQtype   error = fmt.Errorf("Invalid policy qtype")
+	invalidPolicyTime    error = fmt.Errorf("Invalid policy time window")
+	policyNotFound       error = fmt.Errorf("Policy not found")
+)
+
+// policyMutex provides a lock for the policies slice
+var policyMutex = &sync.RWMutex{}
+
+// policies are kept sorted by priority so the first match wins
+var policies []*policy
+
+// Policy decides the answer for a question based on the client
+// that is asking. Empty match fields match everything
+type Policy struct {
+	ID       string `json:"id"`
+	Priority int    `json:"priority"` // lower values are evaluated first
+	// ClientCIDRs match the source address of the query or the
+	// address in the EDNS client subnet option
+	ClientCIDRs []string   `json:"clientCidrs"`
+	Qtypes      []string   `json:"qtypes"`
+	NamePattern string     `json:"namePattern"` // glob, e.g. *.test.example.com
+	NotBefore   *time.Time `json:"notBefore,omitempty"`
+	NotAfter    *time.Time `json:"notAfter,omitempty"`
+	Action      string     `json:"action"`
+	// RecordType, TTL and Value are used to build the answer
+	// when Action is answer, using the same formats as UpsertRRS
+	RecordType string   `json:"recordType,omitempty"`
+	TTL        uint32   `json:"ttl,omitempty"`
+	Value      []string `json:"value,omitempty"`
+}
+
+// policy is a validated Policy ready to be evaluated
+type policy struct {
+	Policy
+	networks []*net.IPNet
+	qtypes   map[uint16]struct{}
+	pattern  string
+	rrtype   uint16
+	answer   []dns.RR
+	added    time.Time
+}
+
+// newPolicy validates p and builds the answer RRs
+func newPolicy(p Policy) (*policy, error) {
+	compiled := &policy{
+		Policy: p,
+		qtypes: make(map[uint16]struct{}),
+		added:  time.Now(),
+	}
+
+	if compiled.ID == "" {
+		compiled.ID = uuid.NewString()
+	}
+
+	for _, c := range p.ClientCIDRs {
+		if !strings.Contains(c, "/") {
+			if ip := net.ParseIP(c); ip != nil && ip.To4() != nil {
+				c += "/32"
+			} else {
+				c += "/128"
+			}
+		}
+		_, network, err := net.ParseCIDR(c)
+		if err != nil {
+			return nil, invalidPolicyCIDR
+		}
+		compiled.networks = append(compiled.networks, network)
+	}
+
+	for _, q := range p.Qtypes {
+		qtype, ok := dns.StringToType[strings.ToUpper(q)]
+		if !ok {
+			return nil, invalidPolicyQtype
+		}
+		compiled.qtypes[qtype] = struct{}{}
+	}
+
+	if p.NamePattern != "" {
+		compiled.pattern = strings.ToLower(dns.Fqdn(p.NamePattern))
+		if _, err := path.Match(compiled.pattern, ""); err != nil {
+			return nil, invalidPolicyPattern
+		}
+	}
+
+	if p.NotBefore != nil && p.NotAfter != nil && p.NotAfter.Before(*p.NotBefore) {
+		return nil, invalidPolicyTime
+	}
+
+	switch p.Action {
+	case PolicyNXDomain, PolicyRefused, PolicyServFail:
+	case PolicyAnswer:
+		compiled.RecordType = strings.ToUpper(p.RecordType)
+		// the owner name is replaced with the question name when answering
+		owner := "policy."
+		rec, err := buildRRS(&Record{
+			FQDN:       &owner,
+			RecordType: &compiled.RecordType,
+			TTL:        &p.TTL,
+			Value:      p.Value,
+		})
+		if err != nil {
+			return nil, err
+		}
+		compiled.rrtype = dns.StringToType[compiled.RecordType]
+		compiled.answer = rec
+	default:
+		return nil, invalidPolicyAction
+	}
+
+	return compiled, nil
+}
+
+// clientSubnet returns the address in the EDNS client subnet option
+func clientSubnet(r *dns.Msg) net.IP {
+	opt := r.IsEdns0()
+	if opt == nil {
+		return nil
+	}
+
+	for _, o := range opt.Option {
+		if ecs, ok := o.(*dns.EDNS0_SUBNET); ok {
+			return ecs.Address
+		}
+	}
+	return nil
+}
+
+// matches reports whether the policy applies to the question
+func (p *policy) matches(q dns.Question, clients []net.IP, now time.Time) bool {
+	if p.NotBefore != nil && now.Before(*p.NotBefore) {
+		return false
+	}
+	if p.NotAfter != nil && now.After(*p.NotAfter) {
+		return false
+	}
+
+	if len(p.qtypes) > 0 {
+		if _, ok := p.qtypes[q.Qtype]; !ok {
+			return false
+		}
+	}
+
+	if p.pattern != "" {
+		if ok, _ := path.Match(p.pattern, strings.ToLower(q.Name)); !ok {
+			return false
+		}
+	}
+
+	if len(p.networks) == 0 {
+		return true
+	}
+
+	for _, n := range p.networks {
+		for _, ip := range clients {
+			if ip != nil && n.Contains(ip) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// respond sets the answer or rcode of m for the question
+func (p *policy) respond(r, m *dns.Msg) {
+	switch p.Action {
+	case PolicyNXDomain:
+		m.SetRcode(r, dns.RcodeNameError)
+	case PolicyRefused:
+		m.SetRcode(r, dns.RcodeRefused)
+	case PolicyServFail:
+		m.SetRcode(r, dns.RcodeServerFailure)
+	case PolicyAnswer:
+		// a CNAME answers every type, otherwise the types must match
+		if p.rrtype != dns.TypeCNAME && p.rrtype != r.Question[0].Qtype {
+			return
+		}
+		for _, rr := range p.answer {
+			answer := dns.Copy(rr)
+			answer.Header().Name = r.Question[0].Name
+			m.Answer = append(m.Answer, answer)
+		}
+	}
+}
+
+// findPolicy returns the first policy that matches the request
+func findPolicy(r *dns.Msg, remoteAddr net.Addr) (*policy, bool) {
+	policyMutex.RLock()
+	defer policyMutex.RUnlock()
+
+	if len(policies) == 0 {
+		return nil, false
+	}
+
+	clients := []net.IP{clientSubnet(r)}
+	if host, _, err := net.SplitHostPort(remoteAddr.String()); err == nil {
+		clients = append(clients, net.ParseIP(host))
+	}
+
+	now := time.Now()
+	for _, p := range policies {
+		if p.matches(r.Question[0], clients, now) {
+			return p, true
+		}
+	}
+	return nil, false
+}
+
+// upsertPolicy adds the policy, replacing any policy with the same ID
+func upsertPolicy(p Policy) (*Policy, error) {
+	compiled, err := newPolicy(p)
+	if err != nil {
+		return nil, err
+	}
+
+	policyMutex.Lock()
+	defer policyMutex.Unlock()
+
+	for i := range policies {
+		if policies[i].ID == compiled.ID {
+			compiled.added = policies[i].added
+			policies = append(policies[:i], policies[i+1:]...)
+			break
+		}
+	}
+
+	policies = append(policies, compiled)
+	sort.SliceStable(policies, func(i, j int) bool {
+		if policies[i].Priority == policies[j].Priority {
+			return policies[i].added.Before(policies[j].added)
+		}
+		return policies[i].Priority < policies[j].Priority
+	})
+
+	return &compiled.Policy, nil
+}
+
+// deletePolicy removes the policy with the ID
+func deletePolicy(id string) error {
+	policyMutex.Lock()
+	defer policyMutex.Unlock()
+
+	for i := range policies {
+		if policies[i].ID == id {
+			policies = append(policies[:i], policies[i+1:]...)
+			return nil
+		}
+	}
+	return policyNotFound
+}
+
+// listPolicies returns the policies in evaluation order
+func listPolicies() []Policy {
+	policyMutex.RLock()
+	defer policyMutex.RUnlock()
+
+	list := make([]Policy, 0, len(policies))
+	for _, p := range policies {
+		list = append(list, p.Policy)
+	}
+	return list
+}
+
+// policyHandler answers questions that matched a policy
+func (s *server) policyHandler(w dns.ResponseWriter, r *dns.Msg, p *policy) {
+	m := new(dns.Msg)
+	m.SetReply(r)
+
+	m.Authoritative = true
+
+	p.respond(r, m)
+	log.Debug().Msgf("policy %s replied to question %v with answer %v [status: %v]", p.ID, m.Question, m.Answer, m.Rcode)
+
+	go s.interactionHandler(r, m, w.RemoteAddr())
+	if err := w.WriteMsg(m); err != nil {
+		log.Error().Msgf("failed to response to DNS query: %v", m)
+	}
+}
@@ -0,0 +1,119 @@
+package bind
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPolicyEvaluation(t *testing.T) {
+	defer func() { policies = nil }()
+
+	target, err := upsertPolicy(Policy{
+		Priority:    10,
+		ClientCIDRs: []string{"10.1.0.0/16"},
+		Qtypes:      []string{"a"},
+		NamePattern: "*.policy.src",
+		Action:      PolicyAnswer,
+		RecordType:  "A",
+		TTL:         5,
+		Value:       []string{"192.168.1.1"},
+	})
+	assert.NoError(t, err)
+	assert.NotEmpty(t, target.ID)
+
+	_, err = upsertPolicy(Policy{
+		Priority:    20,
+		NamePattern: "*.policy.src",
+		Action:      PolicyAnswer,
+		RecordType:  "A",
+		TTL:         5,
+		Value:       []string{"127.0.0.1"},
+	})
+	assert.NoError(t, err)
+
+	scanner, err := upsertPolicy(Policy{
+		Priority:    0,
+		ClientCIDRs: []string{"203.0.113.7"},
+		Action:      PolicyNXDomain,
+	})
+	assert.NoError(t, err)
+
+	testCases := []struct {
+		client   string
+		ecs      string
+		expected string
+		rcode    int
+	}{
+		{"10.1.2.3:5353", "", "192.168.1.1", dns.RcodeSuccess},
+		{"8.8.8.8:5353", "10.1.9.0", "192.168.1.1", dns.RcodeSuccess},
+		{"8.8.8.8:5353", "", "127.0.0.1", dns.RcodeSuccess},
+		{"203.0.113.7:5353", "", "", dns.RcodeNameError},
+	}
+
+	for _, tc := range testCases {
+		r := new(dns.Msg)
+		r.SetQuestion("abc.policy.src.", dns.TypeA)
+		if tc.ecs != "" {
+			r.SetEdns0(4096, false)
+			r.IsEdns0().Option = append(r.IsEdns0().Option, &dns.EDNS0_SUBNET{
+				Code:          dns.EDNS0SUBNET,
+				Family:        1,
+				SourceNetmask: 24,
+				Address:       net.ParseIP(tc.ecs),
+			})
+		}
+
+		addr, _ := net.ResolveUDPAddr("udp", tc.client)
+		p, ok := findPolicy(r, addr)
+		assert.True(t, ok, tc.client)
+
+		m := new(dns.Msg)
+		m.SetReply(r)
+		p.respond(r, m)
+		assert.Equal(t, tc.rcode, m.Rcode, tc.client)
+		if tc.expected != "" {
+			assert.Equal(t, tc.expected, m.Answer[0].(*dns.A).A.String(), tc.client)
+			assert.Equal(t, "abc.policy.src.", m.Answer[0].Header().Name)
+		}
+	}
+
+	// names outside the pattern fall through to records
+	r := new(dns.Msg)
+	r.SetQuestion("abc.other.src.", dns.TypeA)
+	addr, _ := net.ResolveUDPAddr("udp", "8.8.8.8:53")
+	_, ok := findPolicy(r, addr)
+	assert.False(t, ok)
+
+	assert.NoError(t, deletePolicy(scanner.ID))
+	assert.Error(t, deletePolicy(scanner.ID))
+	assert.Len(t, listPolicies(), 2)
+	assert.Equal(t, target.ID, listPolicies()[0].ID)
+}
+
+func TestPolicyTimeWindow(t *testing.T) {
+	past := time.Now().Add(-time.Hour)
+	p, err := newPolicy(Policy{NotAfter: &past, Action: PolicyRefused})
+	assert.NoError(t, err)
+	assert.False(t, p.matches(dns.Question{Name: "a.src.", Qtype: dns.TypeA}, nil, time.Now()))
+
+	future := time.Now().Add(time.Hour)
+	_, err = newPolicy(Policy{NotBefore: &future, NotAfter: &past, Action: PolicyRefused})
+	assert.Error(t, err)
+}
+
+func TestInvalidPolicy(t *testing.T) {
+	for _, p := range []Policy{
+		{Action: "drop-everything"},
+		{Action: PolicyRefused, ClientCIDRs: []string{"10.0.0.0/33"}},
+		{Action: PolicyRefused, Qtypes: []string{"BOGUS"}},
+		{Action: PolicyRefused, NamePattern: "[.src"},
+		{Action: PolicyAnswer, RecordType: "A", Value: []string{"not-an-ip"}},
+	} {
+		_, err := newPolicy(p)
+		assert.Error(t, err, p)
+	}
+}
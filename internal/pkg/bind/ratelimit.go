@@ -0,0 +1,262 @@
+package bind
+
+import (
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/miekg/dns"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/rs/zerolog/log"
+)
+
+// Rate limit defaults
+const (
+	defaultSlip            = 2
+	defaultIPv4PrefixLen   = 24
+	defaultIPv6PrefixLen   = 56
+	defaultMaxPrefixes     = 100000
+	rateLimitSweepInterval = time.Minute
+)
+
+var invalidRateLimitConfig error = fmt.Errorf("Invalid rate limit configuration")
+
+var (
+	rrlDroppedResponses = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "dns_rrl_dropped_responses_total",
+		Help: "Total DNS responses dropped by response rate limiting",
+	})
+
+	rrlSlippedResponses = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "dns_rrl_slipped_responses_total",
+		Help: "Total truncated DNS responses sent by response rate limiting",
+	})
+
+	rrlExcludedInteractions = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "dns_rrl_excluded_interactions_total",
+		Help: "Total rate limited DNS interactions not published to the polling server",
+	})
+)
+
+// RateLimitConfig limits the UDP responses sent to each client prefix.
+// TCP clients cannot spoof their address and are not limited
+type RateLimitConfig struct {
+	ResponsesPerSecond int // Required. Responses per second and prefix
+	Burst              int // Optional. Defaults to ResponsesPerSecond
+	// Slip sends every nth limited response truncated, so that real
+	// clients behind the prefix retry over TCP. 0 drops every limited
+	// response and 1 truncates every limited response. Defaults to 2
+	Slip             *int
+	IPv4PrefixLength int      // Optional. Defaults to 24
+	IPv6PrefixLength int      // Optional. Defaults to 56
+	Exempt           []string // Optional. CIDRs that are never limited
+	// MaxPrefixes limits the prefixes that have their own bucket. Once
+	// reached, new prefixes share a single bucket until buckets are
+	// swept. Defaults to 100000
+	MaxPrefixes int
+	// ExcludeLimited does not publish the interactions of limited
+	// queries to the polling server, e.g. to filter scanner noise
+	ExcludeLimited bool
+}
+
+// rrlAction is the decision for a query
+type rrlAction int
+
+const (
+	rrlAllow rrlAction = iota
+	rrlDrop
+	rrlSlip
+)
+
+// bucket holds the tokens of a client prefix
+type bucket struct {
+	tokens  float64
+	updated time.Time
+	limited int // limited responses since the prefix exceeded the limit
+}
+
+// rateLimiter is a token bucket per client prefix
+type rateLimiter struct {
+	rate           float64
+	burst          float64
+	slip           int
+	ipv4Mask       net.IPMask
+	ipv6Mask       net.IPMask
+	exempt         []*net.IPNet
+	excludeLimited bool
+	maxPrefixes    int
+	mutex          *sync.Mutex
+	buckets        map[string]*bucket
+	// overflow is shared by new prefixes while buckets is full
+	overflow *bucket
+	swept    time.Time
+}
+
+// newRateLimiter parses the config. A nil config disables rate limiting
+func newRateLimiter(cfg *RateLimitConfig) (*rateLimiter, error) {
+	if cfg == nil {
+		return nil, nil
+	}
+	if cfg.ResponsesPerSecond <= 0 || cfg.Burst < 0 || cfg.MaxPrefixes < 0 || (cfg.Slip != nil && *cfg.Slip < 0) {
+		return nil, invalidRateLimitConfig
+	}
+
+	l := &rateLimiter{
+		rate:           float64(cfg.ResponsesPerSecond),
+		burst:          float64(cfg.Burst),
+		slip:           defaultSlip,
+		ipv4Mask:       net.CIDRMask(defaultIPv4PrefixLen, 32),
+		ipv6Mask:       net.CIDRMask(defaultIPv6PrefixLen, 128),
+		excludeLimited: cfg.ExcludeLimited,
+		maxPrefixes:    defaultMaxPrefixes,
+		mutex:          &sync.Mutex{},
+		buckets:        make(map[string]*bucket),
+		swept:          time.Now(),
+	}
+	if l.burst == 0 {
+		l.burst = l.rate
+	}
+	if cfg.Slip != nil {
+		l.slip = *cfg.Slip
+	}
+	if cfg.MaxPrefixes != 0 {
+		l.maxPrefixes = cfg.MaxPrefixes
+	}
+
+	if cfg.IPv4PrefixLength != 0 {
+		if l.ipv4Mask = net.CIDRMask(cfg.IPv4PrefixLength, 32); l.ipv4Mask == nil {
+			return nil, fmt.Errorf("%v: invalid IPv4 prefix length %d", invalidRateLimitConfig, cfg.IPv4PrefixLength)
+		}
+	}
+	if cfg.IPv6PrefixLength != 0 {
+		if l.ipv6Mask = net.CIDRMask(cfg.IPv6PrefixLength, 128); l.ipv6Mask == nil {
+			return nil, fmt.Errorf("%v: invalid IPv6 prefix length %d", invalidRateLimitConfig, cfg.IPv6PrefixLength)
+		}
+	}
+
+	for _, cidr := range cfg.Exempt {
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return nil, fmt.Errorf("%v: %v", invalidRateLimitConfig, err)
+		}
+		l.exempt = append(l.exempt, network)
+	}
+
+	return l, nil
+}
+
+// prefix returns the client prefix of the address or false if the
+// client is exempt
+func (l *rateLimiter) prefix(addr net.Addr) (string, bool) {
+	host, _, err := net.SplitHostPort(addr.String())
+	if err != nil {
+		return "", false
+	}
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return "", false
+	}
+
+	for _, network := range l.exempt {
+		if network.Contains(ip) {
+			return "", false
+		}
+	}
+
+	if ip4 := ip.To4(); ip4 != nil {
+		return ip4.Mask(l.ipv4Mask).String(), true
+	}
+	return ip.Mask(l.ipv6Mask).String(), true
+}
+
+// check takes a token from the bucket of the client prefix and
+// decides whether the response is sent, dropped or truncated
+func (l *rateLimiter) check(addr net.Addr, now time.Time) rrlAction {
+	prefix, ok := l.prefix(addr)
+	if !ok {
+		return rrlAllow
+	}
+
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	l.sweep(now)
+
+	b, ok := l.buckets[prefix]
+	switch {
+	case ok:
+	case len(l.buckets) >= l.maxPrefixes:
+		// floods from spoofed prefixes must not grow the buckets, so
+		// new prefixes are limited together
+		if l.overflow == nil {
+			l.overflow = &bucket{tokens: l.burst, updated: now}
+		}
+		b = l.overflow
+	default:
+		b = &bucket{tokens: l.burst, updated: now}
+		l.buckets[prefix] = b
+	}
+
+	b.tokens += now.Sub(b.updated).Seconds() * l.rate
+	if b.tokens > l.burst {
+		b.tokens = l.burst
+	}
+	b.updated = now
+
+	if b.tokens >= 1 {
+		b.tokens--
+		b.limited = 0
+		return rrlAllow
+	}
+
+	b.limited++
+	if l.slip > 0 && b.limited%l.slip == 0 {
+		return rrlSlip
+	}
+	return rrlDrop
+}
+
+// sweep removes the buckets of prefixes that refilled their tokens,
+// since they are identical to new buckets
+func (l *rateLimiter) sweep(now time.Time) {
+	if now.Sub(l.swept) < rateLimitSweepInterval {
+		return
+	}
+	l.swept = now
+
+	refill := time.Duration(l.burst / l.rate * float64(time.Second))
+	for prefix, b := range l.buckets {
+		if now.Sub(b.updated) >= refill {
+			delete(l.buckets, prefix)
+		}
+	}
+	if l.overflow != nil && now.Sub(l.overflow.updated) >= refill {
+		l.overflow = nil
+	}
+}
+
+// rateLimitHandler drops or truncates the response to a limited query
+func (s *server) rateLimitHandler(w dns.ResponseWriter, r *dns.Msg, action rrlAction) {
+	m := new(dns.Msg)
+	m.SetReply(r)
+	m.Truncated = action == rrlSlip
+
+	if s.RateLimit.excludeLimited {
+		rrlExcludedInteractions.Inc()
+	} else {
+		go s.interactionHandler(r, m, w.RemoteAddr())
+	}
+
+	if action == rrlDrop {
+		rrlDroppedResponses.Inc()
+		log.Debug().Msgf("rate limit dropped response to %v from %v", m.Question, w.RemoteAddr())
+		return
+	}
+
+	rrlSlippedResponses.Inc()
+	if err := w.WriteMsg(m); err != nil {
+		log.Error().Msgf("failed to response to DNS query: %v", m)
+	}
+}
@@ -0,0 +1,141 @@
+package bind
+
+import (
+	"fmt"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRateLimiter(t *testing.T) {
+	l, err := newRateLimiter(&RateLimitConfig{
+		ResponsesPerSecond: 1,
+		Burst:              2,
+		Exempt:             []string{"192.0.2.53/32"},
+	})
+	assert.NoError(t, err)
+
+	now := time.Now()
+	client := &net.UDPAddr{IP: net.ParseIP("198.51.100.1"), Port: 5353}
+	neighbour := &net.UDPAddr{IP: net.ParseIP("198.51.100.200"), Port: 5353}
+
+	// every second limited response slips by default
+	expected := []rrlAction{rrlAllow, rrlAllow, rrlDrop, rrlSlip, rrlDrop, rrlSlip}
+	for i, action := range expected {
+		if i%2 == 0 {
+			assert.Equal(t, action, l.check(client, now), i)
+		} else {
+			assert.Equal(t, action, l.check(neighbour, now), i)
+		}
+	}
+
+	// other prefixes and exempt clients are not limited
+	assert.Equal(t, rrlAllow, l.check(&net.UDPAddr{IP: net.ParseIP("198.51.101.1")}, now))
+	for i := 0; i < 5; i++ {
+		assert.Equal(t, rrlAllow, l.check(&net.UDPAddr{IP: net.ParseIP("192.0.2.53")}, now))
+	}
+
+	// tokens refill over time
+	assert.Equal(t, rrlAllow, l.check(client, now.Add(time.Second)))
+	assert.Equal(t, rrlDrop, l.check(client, now.Add(time.Second)))
+
+	// IPv6 clients are grouped by /56
+	a := &net.UDPAddr{IP: net.ParseIP("2001:db8:0:1::1")}
+	b := &net.UDPAddr{IP: net.ParseIP("2001:db8:0:2::1")}
+	assert.Equal(t, rrlAllow, l.check(a, now))
+	assert.Equal(t, rrlAllow, l.check(b, now))
+	assert.Equal(t, rrlDrop, l.check(a, now))
+
+	// idle buckets are removed
+	l.check(client, now.Add(rateLimitSweepInterval+time.Second))
+	assert.Len(t, l.buckets, 1)
+}
+
+func TestRateLimiterMaxPrefixes(t *testing.T) {
+	l, err := newRateLimiter(&RateLimitConfig{
+		ResponsesPerSecond: 1,
+		MaxPrefixes:        100,
+	})
+	assert.NoError(t, err)
+
+	// a flood from spoofed /56 prefixes does not grow the buckets and
+	// the prefixes past the limit share a single token
+	now := time.Now()
+	allowed := 0
+	for i := 0; i < 1000; i++ {
+		ip := net.ParseIP(fmt.Sprintf("2001:db8:%x:%x00::1", i/256, i%256))
+		if l.check(&net.UDPAddr{IP: ip}, now) == rrlAllow {
+			allowed++
+		}
+	}
+	assert.Len(t, l.buckets, 100)
+	assert.Equal(t, 101, allowed)
+
+	// prefixes with a bucket keep their own tokens
+	assert.Equal(t, rrlAllow, l.check(&net.UDPAddr{IP: net.ParseIP("2001:db8:0:100::1")}, now.Add(time.Second)))
+
+	// the shared bucket is swept with the idle buckets
+	l.check(&net.UDPAddr{IP: net.ParseIP("2001:db8:0:100::1")}, now.Add(rateLimitSweepInterval+time.Second))
+	assert.Nil(t, l.overflow)
+	assert.Len(t, l.buckets, 1)
+
+	_, err = newRateLimiter(&RateLimitConfig{ResponsesPerSecond: 1, MaxPrefixes: -1})
+	assert.Error(t, err)
+}
+
+func TestRateLimitHandler(t *testing.T) {
+	slip := 1
+	l, err := newRateLimiter(&RateLimitConfig{
+		ResponsesPerSecond: 1,
+		Slip:               &slip,
+		ExcludeLimited:     true,
+	})
+	assert.NoError(t, err)
+	addr, pm := startZoneServer(t, "rrl.src", l)
+
+	slipped := testutil.ToFloat64(rrlSlippedResponses)
+	excluded := testutil.ToFloat64(rrlExcludedInteractions)
+
+	m := new(dns.Msg)
+	m.SetQuestion("a.rrl.src.", dns.TypeA)
+	r, _, err := (&dns.Client{Net: "udp"}).Exchange(m, addr)
+	assert.NoError(t, err)
+	assert.False(t, r.Truncated)
+
+	r, _, err = (&dns.Client{Net: "udp"}).Exchange(m, addr)
+	assert.NoError(t, err)
+	assert.True(t, r.Truncated)
+	assert.Equal(t, slipped+1, testutil.ToFloat64(rrlSlippedResponses))
+
+	// TCP clients are not limited
+	r, _, err = (&dns.Client{Net: "tcp"}).Exchange(m, addr)
+	assert.NoError(t, err)
+	assert.False(t, r.Truncated)
+
+	// the limited query is not published
+	assert.Equal(t, excluded+1, testutil.ToFloat64(rrlExcludedInteractions))
+	time.Sleep(100 * time.Millisecond)
+	assert.Len(t, pm.ReadAll(), 2)
+}
+
+func TestNewRateLimiter(t *testing.T) {
+	l, err := newRateLimiter(nil)
+	assert.NoError(t, err)
+	assert.Nil(t, l)
+
+	slip := -1
+	for _, cfg := range []*RateLimitConfig{
+		{},
+		{ResponsesPerSecond: 10, Slip: &slip},
+		{ResponsesPerSecond: 10, IPv4PrefixLength: 33},
+		{ResponsesPerSecond: 10, IPv6PrefixLength: 129},
+		{ResponsesPerSecond: 10, Exempt: []string{"192.0.2.1"}},
+	} {
+		_, err := newRateLimiter(cfg)
+		assert.Error(t, err)
+	}
+}
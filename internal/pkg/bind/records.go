@@ -1,9 +1,9 @@
 package bind
 
 import (
-	"encoding/base64"
 	"fmt"
 	"net"
+	"sort"
 	"strconv"
 	"strings"
 	"sync"
@@ -15,11 +15,12 @@ import (
 // rwMutex provides a lock for the zoneCache hashmap
 var rwMutex = &sync.RWMutex{}
 
-// a.domain.test = zoneRRS{RecordType: "A", TTL: 30, Record: []string{127.0.0.1, 192.168.0.1}}
-// cname.domain.test = zoneRRS{RecordType: "CNAME", TTL: 30, Record: "test3.src"}
-var zoneCache = make(map[string]zoneRRS)
+// zoneCache maps a name to its RRsets by type
+// a.domain.test = {A: zoneRRS{RecordType: "A", TTL: 30, Record: []dns.RR{127.0.0.1, 192.168.0.1}}}
+// cname.domain.test = {CNAME: zoneRRS{RecordType: "CNAME", TTL: 30, Record: []dns.RR{test3.src}}}
+var zoneCache = make(map[string]map[uint16]zoneRRS)
 
-// zoneRRS stores the RR in the cache, mapped by DomainName
+// zoneRRS stores the RR in the cache, mapped by DomainName and type
 type zoneRRS struct {
 	RecordType string
 	TTL        uint32 // See RFC 1034 & 2181
@@ -35,51 +36,6 @@ var (
 	typeNotImplemented error = fmt.Errorf("RcodeNotImplemented")
 )
 
-// Default records
-var (
-	// a
-	aDefaultHdr = dns.RR_Header{Rrtype: dns.TypeA,
-		Class: dns.ClassINET, Ttl: 30}
-	aDefaultRRS = []dns.RR{&dns.A{
-		Hdr: aDefaultHdr,
-		A:   net.IPv4(127, 0, 0, 1)}}
-	// aaaa
-	aaaaDefaultHdr = dns.RR_Header{Rrtype: dns.TypeAAAA,
-		Class: dns.ClassINET, Ttl: 30}
-	aaaaDefaultRRS = []dns.RR{&dns.AAAA{
-		Hdr:  aaaaDefaultHdr,
-		AAAA: net.IPv6loopback}}
-	// cname
-	cnameDefaultHdr = dns.RR_Header{Rrtype: dns.TypeCNAME,
-		Class: dns.ClassINET, Ttl: 30}
-	cnameDefaultRRS = &dns.CNAME{
-		Hdr:    cnameDefaultHdr,
-		Target: "default"}
-	// txt
-	txtDefaultHdr = dns.RR_Header{Rrtype: dns.TypeTXT,
-		Class: dns.ClassINET, Ttl: 30}
-	txtDefaultRRS = &dns.TXT{
-		Hdr: txtDefaultHdr,
-		Txt: []string{base64.StdEncoding.EncodeToString(seed.Bytes())}}
-	// mx
-	mxDefaultHdr = dns.RR_Header{Rrtype: dns.TypeMX,
-		Class: dns.ClassINET, Ttl: 30}
-	mxDefaultRRS = []dns.RR{&dns.MX{
-		Hdr:        mxDefaultHdr,
-		Preference: 10,
-		Mx:         "default"}}
-	// svr
-	svrDefaultHdr = dns.RR_Header{Rrtype: dns.TypeSRV,
-		Class: dns.ClassINET, Ttl: 30}
-	svrDefaultRRS = []dns.RR{&dns.SRV{
-		Hdr:      svrDefaultHdr,
-		Priority: 10,
-		Weight:   90,
-		Port:     443,
-		Target:   "default",
-	}}
-)
-
 // validateIPRecord checks if the IPv4, IPv4-mapped IPv6, or IPv6 address
 // in the RR is well-formed and returns the parsed IP
 func validateIPRecord(record ...string) (*[]net.IP, bool) {
@@ -140,10 +96,15 @@ func validateSRV(record ...string) ([]*dns.SRV, bool) {
 			}
 		}
 
+		if !validateFQDN(srvSplit[3]) {
+			return []*dns.SRV{}, false
+		}
+
 		srvRecs = append(srvRecs, &dns.SRV{
 			Priority: uint16(srvFields["priority"]),
 			Weight:   uint16(srvFields["weight"]),
 			Port:     uint16(srvFields["port"]),
+			Target:   dns.Fqdn(srvSplit[3]),
 		})
 	}
 	return srvRecs, true
@@ -179,10 +140,47 @@ func validateMX(record ...string) ([]*dns.MX, bool) {
 	return mxRecs, true
 }
 
-// findRecordInZone is used to find a RRS in the cache
+// validateRData parses each record as the presentation format of the
+// RDATA for the type in header, e.g. <flags> <tag> <value> for CAA or
+// <priority> <target> <params> for HTTPS. If any record is invalid an
+// empty set and bool will be set to false
+func validateRData(header dns.RR_Header, record ...string) ([]dns.RR, bool) {
+	var rrs []dns.RR
+	for i := range record {
+		if strings.Contains(record[i], "\n") {
+			return []dns.RR{}, false
+		}
+
+		rr, err := dns.NewRR(fmt.Sprintf("%s %d %s %s %s",
+			header.Name,
+			header.Ttl,
+			dns.ClassToString[header.Class],
+			dns.TypeToString[header.Rrtype],
+			record[i],
+		))
+		if err != nil || rr == nil || rr.Header().Rrtype != header.Rrtype {
+			log.Debug().Msgf("rdata error: %v", err)
+			return []dns.RR{}, false
+		}
+		rrs = append(rrs, rr)
+	}
+	return rrs, true
+}
+
+// zoneKey returns the key of the name in the zoneCache
+func zoneKey(name string) string {
+	return strings.ToLower(dns.Fqdn(name))
+}
+
+// findRecordInZone is used to find the RRS of the record type in the
+// cache
 func findRecordInZone(record *Record) (zoneRRS, error) {
+	if record.RecordType == nil {
+		return zoneRRS{}, rrNotFound
+	}
+
 	rwMutex.RLock()
-	rec, ok := zoneCache[dns.Fqdn(*record.FQDN)]
+	rec, ok := zoneCache[zoneKey(*record.FQDN)][dns.StringToType[*record.RecordType]]
 	rwMutex.RUnlock()
 
 	if !ok {
@@ -192,17 +190,140 @@ func findRecordInZone(record *Record) (zoneRRS, error) {
 	return rec, nil
 }
 
-// deleteRecord is a noop if the key is absent
-func deleteRecord(record *Record) {
+// findRRSet returns the stored RRs of the type at name
+func findRRSet(name string, rrtype uint16) ([]dns.RR, bool) {
+	rwMutex.RLock()
+	rec, ok := zoneCache[zoneKey(name)][rrtype]
+	rwMutex.RUnlock()
+
+	if !ok {
+		return nil, false
+	}
+	return rec.Record.([]dns.RR), true
+}
+
+// zoneAnswer returns the stored RRs that answer the question: the
+// RRset of the type, the CNAME of the name or every RRset for ANY.
+// The returned bool is false if none are stored
+func zoneAnswer(q dns.Question) ([]dns.RR, bool) {
+	rwMutex.RLock()
+	defer rwMutex.RUnlock()
+
+	rrsets, ok := zoneCache[zoneKey(q.Name)]
+	if !ok {
+		return nil, false
+	}
+
+	if q.Qtype == dns.TypeANY {
+		var rrs []dns.RR
+		for _, rrtype := range sortedTypes(rrsets) {
+			rrs = append(rrs, rrsets[rrtype].Record.([]dns.RR)...)
+		}
+		return rrs, true
+	}
+	if rec, ok := rrsets[q.Qtype]; ok {
+		return rec.Record.([]dns.RR), true
+	}
+	if rec, ok := rrsets[dns.TypeCNAME]; ok {
+		return rec.Record.([]dns.RR), true
+	}
+	return nil, false
+}
+
+// sortedTypes returns the types of the RRsets in ascending order
+func sortedTypes(rrsets map[uint16]zoneRRS) []uint16 {
+	types := make([]uint16, 0, len(rrsets))
+	for rrtype := range rrsets {
+		types = append(types, rrtype)
+	}
+	sort.Slice(types, func(i, j int) bool {
+		return types[i] < types[j]
+	})
+	return types
+}
+
+// storeRRS sets the RRset of its type at name. A CNAME cannot exist
+// with other data, so it replaces every RRset of the name and is
+// replaced by any other type. The caller must hold rwMutex
+func storeRRS(name string, rec zoneRRS) {
+	key := zoneKey(name)
+	rrtype := dns.StringToType[rec.RecordType]
+
+	if rrtype == dns.TypeCNAME || zoneCache[key] == nil {
+		zoneCache[key] = make(map[uint16]zoneRRS)
+	}
+	delete(zoneCache[key], dns.TypeCNAME)
+	zoneCache[key][rrtype] = rec
+}
+
+// removeRRS deletes the RRset of the type at name. The caller must
+// hold rwMutex
+func removeRRS(name string, rrtype uint16) {
+	key := zoneKey(name)
+	delete(zoneCache[key], rrtype)
+	if len(zoneCache[key]) == 0 {
+		delete(zoneCache, key)
+	}
+}
+
+// deleteRecord removes the records of every type and the shaping of
+// the name. The returned bool is false if the name had neither
+func deleteRecord(record *Record) bool {
+	shaped := deleteShaping(*record.FQDN)
+	key := zoneKey(*record.FQDN)
+
 	rwMutex.Lock()
-	delete(zoneCache, *record.FQDN)
+	_, exists := zoneCache[key]
+	delete(zoneCache, key)
 	rwMutex.Unlock()
+
+	if exists {
+		recordChange()
+	}
+	return exists || shaped
 }
 
-// upsertRRS adds the RRS to the cache for future retrieval
+// upsertRRS adds the RRS to the cache for future retrieval. The RRS
+// replace the records of the same type at the name, so a name can
+// hold e.g. both the NS and DS records of a delegation
 func upsertRRS(record *Record) error {
+	if record.Shaping != nil {
+		if err := validateShaping(record.Shaping); err != nil {
+			return err
+		}
+
+		// names without records are shaped for every type
+		if record.RecordType == nil {
+			if !validateFQDN(*record.FQDN) {
+				return invalidDomainName
+			}
+			setShaping(*record.FQDN, 0, record.Shaping)
+			return nil
+		}
+	}
+
+	rec, err := buildRRS(record)
+	if err != nil {
+		return err
+	}
+
+	rwMutex.Lock()
+	storeRRS(*record.FQDN, zoneRRS{
+		RecordType: *record.RecordType,
+		TTL:        *record.TTL,
+		Record:     rec,
+	})
+	rwMutex.Unlock()
+	setShaping(*record.FQDN, dns.StringToType[*record.RecordType], record.Shaping)
+	recordChange()
+
+	return nil
+}
+
+// buildRRS validates the record and converts the value into RRs
+func buildRRS(record *Record) ([]dns.RR, error) {
 	if !validateFQDN(*record.FQDN) {
-		return invalidDomainName
+		return nil, invalidDomainName
 	}
 
 	var rec []dns.RR
@@ -223,15 +344,15 @@ func upsertRRS(record *Record) error {
 		case string:
 			ipAddresses, valid = validateIPRecord(record.Value.(string))
 			if !valid {
-				return invalidRR
+				return nil, invalidRR
 			}
 		case []string:
 			ipAddresses, valid = validateIPRecord(record.Value.([]string)...)
 			if !valid {
-				return invalidRR
+				return nil, invalidRR
 			}
 		default:
-			return invalidType
+			return nil, invalidType
 		}
 
 		for _, v := range *ipAddresses {
@@ -249,15 +370,15 @@ func upsertRRS(record *Record) error {
 		case string:
 			ipAddresses, valid = validateIPRecord(record.Value.(string))
 			if !valid {
-				return invalidRR
+				return nil, invalidRR
 			}
 		case []string:
 			ipAddresses, valid = validateIPRecord(record.Value.([]string)...)
 			if !valid {
-				return invalidRR
+				return nil, invalidRR
 			}
 		default:
-			return invalidType
+			return nil, invalidType
 		}
 
 		for _, v := range *ipAddresses {
@@ -272,10 +393,10 @@ func upsertRRS(record *Record) error {
 		switch record.Value.(type) {
 		case string:
 			if !validateFQDN(record.Value.(string)) {
-				return invalidRR
+				return nil, invalidRR
 			}
 		default:
-			return invalidRR
+			return nil, invalidRR
 		}
 
 		rec = append(rec, &dns.CNAME{
@@ -298,7 +419,7 @@ func upsertRRS(record *Record) error {
 				Txt: record.Value.([]string),
 			})
 		default:
-			return invalidRR
+			return nil, invalidRR
 		}
 
 	case dns.TypeMX:
@@ -308,16 +429,16 @@ func upsertRRS(record *Record) error {
 		case string:
 			mxAddresses, valid = validateMX(record.Value.(string))
 			if !valid {
-				return invalidRR
+				return nil, invalidRR
 			}
 		case []string:
 			mxAddresses, valid = validateMX(record.Value.([]string)...)
 			if !valid {
 				log.Debug().Msg("Invalid MX")
-				return invalidRR
+				return nil, invalidRR
 			}
 		default:
-			return invalidRR
+			return nil, invalidRR
 		}
 
 		for i := range mxAddresses {
@@ -331,34 +452,85 @@ func upsertRRS(record *Record) error {
 		case string:
 			srvTargets, valid = validateSRV(record.Value.(string))
 			if !valid {
-				return invalidRR
+				return nil, invalidRR
 			}
 		case []string:
 			srvTargets, valid = validateSRV(record.Value.([]string)...)
 			if !valid {
 				log.Debug().Msg("Invalid SRV")
-				return invalidRR
+				return nil, invalidRR
 			}
 		default:
-			return invalidRR
+			return nil, invalidRR
 		}
 		for i := range srvTargets {
 			srvTargets[i].Hdr = header
 			rec = append(rec, srvTargets[i])
 		}
-	default:
-		return typeNotImplemented
-	}
+	case dns.TypePTR, dns.TypeNS:
+		header.Rrtype = rType
+		var targets []string
+		switch record.Value.(type) {
+		case string:
+			targets = []string{record.Value.(string)}
+		case []string:
+			targets = record.Value.([]string)
+		default:
+			return nil, invalidRR
+		}
 
-	rwMutex.Lock()
-	zoneCache[dns.Fqdn(*record.FQDN)] = zoneRRS{
-		RecordType: *record.RecordType,
-		TTL:        *record.TTL,
-		Record:     rec,
+		if len(targets) == 0 || !validateFQDN(targets...) {
+			return nil, invalidRR
+		}
+
+		for _, t := range targets {
+			if rType == dns.TypePTR {
+				rec = append(rec, &dns.PTR{Hdr: header, Ptr: dns.Fqdn(t)})
+			} else {
+				rec = append(rec, &dns.NS{Hdr: header, Ns: dns.Fqdn(t)})
+			}
+		}
+	case dns.TypeSPF:
+		header.Rrtype = rType
+
+		switch record.Value.(type) {
+		case string:
+			rec = append(rec, &dns.SPF{
+				Hdr: header,
+				Txt: []string{record.Value.(string)},
+			})
+		case []string:
+			rec = append(rec, &dns.SPF{
+				Hdr: header,
+				Txt: record.Value.([]string),
+			})
+		default:
+			return nil, invalidRR
+		}
+	case dns.TypeCAA, dns.TypeNAPTR, dns.TypeHTTPS, dns.TypeSVCB, dns.TypeDS:
+		header.Rrtype = rType
+		var rdata []dns.RR
+		switch record.Value.(type) {
+		case string:
+			rdata, valid = validateRData(header, record.Value.(string))
+			if !valid {
+				return nil, invalidRR
+			}
+		case []string:
+			rdata, valid = validateRData(header, record.Value.([]string)...)
+			if !valid {
+				log.Debug().Msgf("Invalid %s", *record.RecordType)
+				return nil, invalidRR
+			}
+		default:
+			return nil, invalidRR
+		}
+		rec = append(rec, rdata...)
+	default:
+		return nil, typeNotImplemented
 	}
-	rwMutex.Unlock()
 
-	return nil
+	return rec, nil
 }
 
 // loadZoneIntoCache is called if the flag to import a zone
@@ -370,8 +542,10 @@ func loadZoneIntoCache() {
 // flushCacheToDisk - blocking operation
 func flushCacheToDisk() {
 	rwMutex.RLock()
-	for k, v := range zoneCache {
-		fmt.Println(k, v)
+	for k, rrsets := range zoneCache {
+		for _, v := range rrsets {
+			fmt.Println(k, v)
+		}
 	}
 	rwMutex.RUnlock()
 }
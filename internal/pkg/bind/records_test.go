@@ -2,6 +2,7 @@ package bind
 
 import (
 	"fmt"
+	"strings"
 	"testing"
 
 	"github.com/miekg/dns"
@@ -88,6 +89,78 @@ func TestUpsertRRS(t *testing.T) {
 			},
 			nil,
 		},
+		{
+			&Record{
+				FQDN:       util.StrToPtr(fmt.Sprintf("caa.%s", domain)),
+				RecordType: util.StrToPtr("CAA"),
+				TTL:        util.Uint32ToPtr(30),
+				Value:      []string{`0 issue "letsencrypt.org"`, `0 iodef "mailto:security@src"`},
+			},
+			nil,
+		},
+		{
+			&Record{
+				FQDN:       util.StrToPtr("1.0.0.127.in-addr.arpa"),
+				RecordType: util.StrToPtr("PTR"),
+				TTL:        util.Uint32ToPtr(30),
+				Value:      "ptr.src",
+			},
+			nil,
+		},
+		{
+			&Record{
+				FQDN:       util.StrToPtr(fmt.Sprintf("naptr.%s", domain)),
+				RecordType: util.StrToPtr("NAPTR"),
+				TTL:        util.Uint32ToPtr(30),
+				Value:      `100 10 "S" "SIP+D2U" "" _sip._udp.src.`,
+			},
+			nil,
+		},
+		{
+			&Record{
+				FQDN:       util.StrToPtr(fmt.Sprintf("https.%s", domain)),
+				RecordType: util.StrToPtr("HTTPS"),
+				TTL:        util.Uint32ToPtr(30),
+				Value:      "1 . alpn=h2 ipv4hint=127.0.0.1",
+			},
+			nil,
+		},
+		{
+			&Record{
+				FQDN:       util.StrToPtr(fmt.Sprintf("svcb.%s", domain)),
+				RecordType: util.StrToPtr("SVCB"),
+				TTL:        util.Uint32ToPtr(30),
+				Value:      "0 svc.src.",
+			},
+			nil,
+		},
+		{
+			&Record{
+				FQDN:       util.StrToPtr(fmt.Sprintf("delegated.%s", domain)),
+				RecordType: util.StrToPtr("NS"),
+				TTL:        util.Uint32ToPtr(30),
+				Value:      []string{"ns1.delegated.src", "ns2.delegated.src"},
+			},
+			nil,
+		},
+		{
+			&Record{
+				FQDN:       util.StrToPtr(fmt.Sprintf("delegated.%s", domain)),
+				RecordType: util.StrToPtr("DS"),
+				TTL:        util.Uint32ToPtr(30),
+				Value:      "60485 5 1 2BB183AF5F22588179A53B0A98631FAD1A292118",
+			},
+			nil,
+		},
+		{
+			&Record{
+				FQDN:       util.StrToPtr(fmt.Sprintf("spf.%s", domain)),
+				RecordType: util.StrToPtr("SPF"),
+				TTL:        util.Uint32ToPtr(30),
+				Value:      "v=spf1 -all",
+			},
+			nil,
+		},
 	}
 
 	invalidTestCases := []struct {
@@ -121,6 +194,33 @@ func TestUpsertRRS(t *testing.T) {
 			},
 			fmt.Errorf("Invalid"),
 		},
+		{
+			&Record{
+				FQDN:       util.StrToPtr("test4.src"),
+				RecordType: util.StrToPtr("CAA"),
+				TTL:        util.Uint32ToPtr(30),
+				Value:      "issue letsencrypt.org",
+			},
+			fmt.Errorf("Invalid"),
+		},
+		{
+			&Record{
+				FQDN:       util.StrToPtr("test5.src"),
+				RecordType: util.StrToPtr("HTTPS"),
+				TTL:        util.Uint32ToPtr(30),
+				Value:      "1 . alpn=h2\ntest5.src. 30 IN A 127.0.0.1",
+			},
+			fmt.Errorf("Invalid"),
+		},
+		{
+			&Record{
+				FQDN:       util.StrToPtr("test6.src"),
+				RecordType: util.StrToPtr("PTR"),
+				TTL:        util.Uint32ToPtr(30),
+				Value:      []string{},
+			},
+			fmt.Errorf("Invalid"),
+		},
 	}
 
 	for _, tc := range validTestCases {
@@ -128,6 +228,14 @@ func TestUpsertRRS(t *testing.T) {
 		assert.Nil(t, tc.expected, upsertRRS(tc.input))
 	}
 
+	// each type is stored separately, so the NS and DS records of the
+	// delegation are both still stored after the upserts
+	for _, tc := range validTestCases {
+		rec, err := findRecordInZone(tc.input)
+		assert.NoError(t, err, *tc.input.FQDN)
+		assert.Equal(t, *tc.input.RecordType, rec.RecordType, *tc.input.FQDN)
+	}
+
 	for _, tc := range invalidTestCases {
 		//fmt.Println("Invalid Case:", i)
 		assert.NotNil(t, tc.expected, upsertRRS(tc.input))
@@ -140,3 +248,92 @@ func TestUpsertRRS(t *testing.T) {
 	// quick check to see if it is in the cache
 	flushCacheToDisk()
 }
+
+func TestValidateSRV(t *testing.T) {
+	srv, ok := validateSRV("10 90 443 sip.example.com", "20 80 5060 sip2.example.com.")
+	assert.True(t, ok)
+	assert.Equal(t, "sip.example.com.", srv[0].Target)
+	assert.Equal(t, uint16(443), srv[0].Port)
+	assert.Equal(t, "sip2.example.com.", srv[1].Target)
+
+	_, ok = validateSRV("10 90 443 " + strings.Repeat("a", 64) + ".example.com")
+	assert.False(t, ok)
+}
+
+func TestDelegation(t *testing.T) {
+	addr, _ := startZoneServer(t, "ref.src", nil)
+
+	for _, rec := range []*Record{
+		{FQDN: util.StrToPtr("sub.ref.src"), RecordType: util.StrToPtr("NS"), Value: []string{"ns1.sub.ref.src", "ns.other.src"}},
+		{FQDN: util.StrToPtr("sub.ref.src"), RecordType: util.StrToPtr("DS"), Value: "60485 5 1 2BB183AF5F22588179A53B0A98631FAD1A292118"},
+		{FQDN: util.StrToPtr("ns1.sub.ref.src"), RecordType: util.StrToPtr("A"), Value: "192.0.2.53"},
+		{FQDN: util.StrToPtr("ref.src"), RecordType: util.StrToPtr("NS"), Value: "ns1.ref.src"},
+		{FQDN: util.StrToPtr("a.ref.src"), RecordType: util.StrToPtr("A"), Value: "127.0.0.1"},
+	} {
+		rec.TTL = util.Uint32ToPtr(30)
+		assert.NoError(t, upsertRRS(rec))
+		defer deleteRecord(rec)
+	}
+
+	exchange := func(name string, qtype uint16) *dns.Msg {
+		m := new(dns.Msg)
+		m.SetQuestion(name, qtype)
+		r, _, err := (&dns.Client{Net: "udp"}).Exchange(m, addr)
+		assert.NoError(t, err)
+		return r
+	}
+
+	// names at and below the delegation are referred to its
+	// nameservers with the DS and glue records
+	for _, name := range []string{"sub.ref.src.", "x.y.SUB.ref.src."} {
+		r := exchange(name, dns.TypeA)
+		assert.False(t, r.Authoritative, name)
+		assert.Empty(t, r.Answer, name)
+		assert.Len(t, r.Ns, 3, name)
+		assert.Len(t, r.Extra, 1, name)
+		assert.Equal(t, "ns1.sub.ref.src.", r.Extra[0].Header().Name)
+	}
+
+	// the DS records belong to the parent
+	r := exchange("sub.ref.src.", dns.TypeDS)
+	assert.True(t, r.Authoritative)
+	assert.Len(t, r.Answer, 1)
+	assert.Equal(t, dns.TypeDS, r.Answer[0].Header().Rrtype)
+
+	// NS records at the apex do not delegate the zone
+	r = exchange("ref.src.", dns.TypeNS)
+	assert.True(t, r.Authoritative)
+	assert.Equal(t, "ns1.ref.src.", r.Answer[0].(*dns.NS).Ns)
+
+	// types without records are answered from the defaults
+	r = exchange("a.ref.src.", dns.TypeA)
+	assert.Equal(t, "127.0.0.1", r.Answer[0].(*dns.A).A.String())
+	r = exchange("a.ref.src.", dns.TypeTXT)
+	assert.Equal(t, dns.TypeTXT, r.Answer[0].Header().Rrtype)
+}
+
+func TestCNAMEReplacesRRSets(t *testing.T) {
+	name := "alias.src."
+	defer deleteRecord(&Record{FQDN: &name})
+
+	for _, rec := range []*Record{
+		{FQDN: &name, RecordType: util.StrToPtr("A"), TTL: util.Uint32ToPtr(30), Value: "127.0.0.1"},
+		{FQDN: &name, RecordType: util.StrToPtr("TXT"), TTL: util.Uint32ToPtr(30), Value: "token"},
+	} {
+		assert.NoError(t, upsertRRS(rec))
+	}
+	rrs, ok := zoneAnswer(dns.Question{Name: name, Qtype: dns.TypeANY})
+	assert.True(t, ok)
+	assert.Len(t, rrs, 2)
+
+	// a CNAME cannot exist with other data
+	assert.NoError(t, upsertRRS(&Record{FQDN: &name, RecordType: util.StrToPtr("CNAME"), TTL: util.Uint32ToPtr(30), Value: "target.src"}))
+	rrs, _ = zoneAnswer(dns.Question{Name: name, Qtype: dns.TypeA})
+	assert.Equal(t, dns.TypeCNAME, rrs[0].Header().Rrtype)
+	_, ok = findRRSet(name, dns.TypeTXT)
+	assert.False(t, ok)
+
+	assert.NoError(t, upsertRRS(&Record{FQDN: &name, RecordType: util.StrToPtr("A"), TTL: util.Uint32ToPtr(30), Value: "127.0.0.1"}))
+	_, ok = findRRSet(name, dns.TypeCNAME)
+	assert.False(t, ok)
+}
@@ -0,0 +1,217 @@
+package bind
+
+import (
+	"encoding/hex"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+
+	"github.com/miekg/dns"
+	"github.com/rs/zerolog/log"
+)
+
+// Suffixes of the reverse mapping trees
+const (
+	ipv4ReverseSuffix = "in-addr.arpa."
+	ipv6ReverseSuffix = "ip6.arpa."
+)
+
+var invalidReverseZone error = fmt.Errorf("Invalid reverse zone")
+
+// ReverseZone serves PTR answers for the addresses in a network
+type ReverseZone struct {
+	// Network is the CIDR delegated to the server, e.g. 203.0.113.0/24.
+	// The served in-addr.arpa or ip6.arpa zone is rounded down to the
+	// nearest octet or nibble boundary
+	Network *string
+	// Zone the PTR answers are in. Defaults to the first zone
+	Zone *string
+}
+
+// reverseZone is a validated ReverseZone
+type reverseZone struct {
+	network *net.IPNet
+	arpa    string
+	zone    string
+}
+
+// newReverseZones validates the reverse zones against the served zones
+func newReverseZones(specs []ReverseZone, zones []string) ([]*reverseZone, error) {
+	var reverse []*reverseZone
+	for _, spec := range specs {
+		if spec.Network == nil {
+			return nil, invalidReverseZone
+		}
+
+		_, network, err := net.ParseCIDR(*spec.Network)
+		if err != nil {
+			return nil, fmt.Errorf("%v %s", invalidReverseZone, *spec.Network)
+		}
+
+		rz := &reverseZone{
+			network: network,
+			arpa:    arpaZone(network),
+		}
+
+		switch {
+		case spec.Zone != nil && *spec.Zone != "":
+			if !validateFQDN(*spec.Zone) {
+				return nil, invalidDomainName
+			}
+			rz.zone = strings.ToLower(dns.Fqdn(*spec.Zone))
+		case len(zones) > 0:
+			rz.zone = strings.ToLower(dns.Fqdn(zones[0]))
+		default:
+			return nil, invalidReverseZone
+		}
+
+		reverse = append(reverse, rz)
+	}
+	return reverse, nil
+}
+
+// arpaZone returns the in-addr.arpa or ip6.arpa zone that contains
+// the network. Networks that do not fall on an octet (IPv4) or
+// nibble (IPv6) boundary are served from the enclosing zone
+func arpaZone(network *net.IPNet) string {
+	ones, bits := network.Mask.Size()
+
+	// ignore error since network.IP is always a valid address
+	full, _ := dns.ReverseAddr(network.IP.String())
+	labels := dns.SplitDomainName(full)
+
+	keep := ones / 4
+	if bits == net.IPv4len*8 {
+		keep = ones / 8
+	}
+
+	// the last two labels are the in-addr.arpa or ip6.arpa suffix
+	return dns.Fqdn(strings.Join(labels[len(labels)-2-keep:], "."))
+}
+
+// parseReverseName returns the address in a fully qualified
+// in-addr.arpa or ip6.arpa name
+func parseReverseName(name string) (net.IP, bool) {
+	name = strings.ToLower(dns.Fqdn(name))
+
+	switch {
+	case strings.HasSuffix(name, "."+ipv4ReverseSuffix):
+		labels := dns.SplitDomainName(strings.TrimSuffix(name, "."+ipv4ReverseSuffix))
+		if len(labels) != net.IPv4len {
+			return nil, false
+		}
+
+		ip := make(net.IP, net.IPv4len)
+		for i, l := range labels {
+			octet, err := strconv.ParseUint(l, 10, 8)
+			if err != nil || (len(l) > 1 && l[0] == '0') {
+				return nil, false
+			}
+			ip[net.IPv4len-1-i] = byte(octet)
+		}
+		return ip, true
+	case strings.HasSuffix(name, "."+ipv6ReverseSuffix):
+		labels := dns.SplitDomainName(strings.TrimSuffix(name, "."+ipv6ReverseSuffix))
+		if len(labels) != net.IPv6len*2 {
+			return nil, false
+		}
+
+		var nibbles strings.Builder
+		for i := len(labels) - 1; i >= 0; i-- {
+			if len(labels[i]) != 1 {
+				return nil, false
+			}
+			nibbles.WriteString(labels[i])
+		}
+
+		ip, err := hex.DecodeString(nibbles.String())
+		if err != nil {
+			return nil, false
+		}
+		return net.IP(ip), true
+	}
+
+	return nil, false
+}
+
+// isEmptyNonTerminal reports whether name is in the reverse zone but
+// has fewer labels than an address
+func isEmptyNonTerminal(name string, rz *reverseZone) bool {
+	leaf := net.IPv4len + dns.CountLabel(ipv4ReverseSuffix)
+	if rz.network.IP.To4() == nil {
+		leaf = net.IPv6len*2 + dns.CountLabel(ipv6ReverseSuffix)
+	}
+	return dns.CountLabel(name) < leaf
+}
+
+// ptrTarget returns the name given in the PTR answer for ip. The
+// hex encoded address is used as the interaction ID so that the
+// reverse lookup and any lookups of the returned name are grouped
+func (rz *reverseZone) ptrTarget(ip net.IP) string {
+	if ip4 := ip.To4(); ip4 != nil {
+		ip = ip4
+	}
+	return hex.EncodeToString(ip) + "." + rz.zone
+}
+
+// reverseZoneForName returns the reverse zone that contains name
+func (s *server) reverseZoneForName(name string) (*reverseZone, bool) {
+	var match *reverseZone
+	for _, rz := range s.ReverseZones {
+		if dns.IsSubDomain(rz.arpa, strings.ToLower(name)) && (match == nil || len(rz.arpa) > len(match.arpa)) {
+			match = rz
+		}
+	}
+	return match, match != nil
+}
+
+// reverseHandler answers PTR questions for addresses in the reverse
+// zone. Addresses outside of the configured network are NXDOMAIN
+func (s *server) reverseHandler(w dns.ResponseWriter, r *dns.Msg, rz *reverseZone) {
+	m := new(dns.Msg)
+	m.SetReply(r)
+
+	m.Authoritative = true
+
+	ip, ok := parseReverseName(r.Question[0].Name)
+	switch {
+	case !ok && isEmptyNonTerminal(r.Question[0].Name, rz):
+		// names between the zone and the addresses have no data
+	case !ok || !rz.network.Contains(ip):
+		m.SetRcode(r, dns.RcodeNameError)
+	case r.Question[0].Qtype == dns.TypePTR:
+		m.Answer = append(m.Answer, &dns.PTR{
+			Hdr: dns.RR_Header{
+				Name:   r.Question[0].Name,
+				Rrtype: dns.TypePTR,
+				Class:  dns.ClassINET,
+				Ttl:    defaultTTL,
+			},
+			Ptr: rz.ptrTarget(ip),
+		})
+	}
+
+	log.Debug().Msgf("replied to reverse question %v with answer %v [status: %v]", m.Question, m.Answer, m.Rcode)
+
+	go s.reverseInteractionHandler(r, m, w.RemoteAddr(), ip)
+	if err := w.WriteMsg(m); err != nil {
+		log.Error().Msgf("failed to response to DNS query: %v", m)
+	}
+}
+
+// reverseInteractionHandler records the lookup as an interaction
+// with the ID of the PTR target, associated with the queried address
+func (s *server) reverseInteractionHandler(q, a *dns.Msg, remoteAddr net.Addr, ip net.IP) {
+	input := newDNSInput(q, a, remoteAddr)
+	if ip != nil {
+		input.QueriedIP = ip.String()
+	}
+	if len(a.Answer) > 0 {
+		if ptr, ok := a.Answer[0].(*dns.PTR); ok {
+			input.InteractionName = ptr.Ptr
+		}
+	}
+
+	s.publishInteraction(input)
+}
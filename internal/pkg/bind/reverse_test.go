@@ -0,0 +1,94 @@
+package bind
+
+import (
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tmoneypenny/conspirator/internal/pkg/util"
+)
+
+func TestNewReverseZones(t *testing.T) {
+	zones := []string{"src.properties", "other.properties"}
+
+	testCases := []struct {
+		network string
+		zone    *string
+		arpa    string
+		target  string
+	}{
+		{"192.0.2.0/24", nil, "2.0.192.in-addr.arpa.", "src.properties."},
+		{"10.0.0.0/8", util.StrToPtr("Other.Properties"), "10.in-addr.arpa.", "other.properties."},
+		{"198.51.100.128/25", nil, "100.51.198.in-addr.arpa.", "src.properties."},
+		{"2001:db8::/32", nil, "8.b.d.0.1.0.0.2.ip6.arpa.", "src.properties."},
+		{"2001:db8::/30", nil, "b.d.0.1.0.0.2.ip6.arpa.", "src.properties."},
+	}
+
+	for _, tc := range testCases {
+		rz, err := newReverseZones([]ReverseZone{{Network: &tc.network, Zone: tc.zone}}, zones)
+		assert.NoError(t, err, tc.network)
+		assert.Equal(t, tc.arpa, rz[0].arpa, tc.network)
+		assert.Equal(t, tc.target, rz[0].zone, tc.network)
+	}
+
+	_, err := newReverseZones([]ReverseZone{{Network: util.StrToPtr("192.0.2.1")}}, zones)
+	assert.Error(t, err)
+
+	_, err = newReverseZones([]ReverseZone{{Network: util.StrToPtr("192.0.2.0/24")}}, nil)
+	assert.Error(t, err)
+}
+
+func TestParseReverseName(t *testing.T) {
+	testCases := []struct {
+		input    string
+		expected net.IP
+		ok       bool
+	}{
+		{"1.2.0.192.in-addr.arpa.", net.ParseIP("192.0.2.1"), true},
+		{"1.2.0.192.IN-ADDR.ARPA", net.ParseIP("192.0.2.1"), true},
+		{"1.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.8.b.d.0.1.0.0.2.ip6.arpa.", net.ParseIP("2001:db8::1"), true},
+		{"2.0.192.in-addr.arpa.", nil, false},
+		{"256.2.0.192.in-addr.arpa.", nil, false},
+		{"01.2.0.192.in-addr.arpa.", nil, false},
+		{"x.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.8.b.d.0.1.0.0.2.ip6.arpa.", nil, false},
+		{"8.b.d.0.1.0.0.2.ip6.arpa.", nil, false},
+		{"1.2.0.192.src.properties.", nil, false},
+	}
+
+	for _, tc := range testCases {
+		ip, ok := parseReverseName(tc.input)
+		assert.Equal(t, tc.ok, ok, tc.input)
+		if tc.ok {
+			assert.True(t, tc.expected.Equal(ip), tc.input)
+		}
+	}
+}
+
+func TestReverseZoneForName(t *testing.T) {
+	rzs, err := newReverseZones([]ReverseZone{
+		{Network: util.StrToPtr("10.0.0.0/8")},
+		{Network: util.StrToPtr("10.1.0.0/16"), Zone: util.StrToPtr("other.properties")},
+		{Network: util.StrToPtr("2001:db8::/32")},
+	}, []string{"src.properties"})
+	assert.NoError(t, err)
+	s := &server{ReverseZones: rzs}
+
+	rz, ok := s.reverseZoneForName("4.3.1.10.in-addr.arpa.")
+	assert.True(t, ok)
+	assert.Equal(t, "0a010304.other.properties.", rz.ptrTarget(net.ParseIP("10.1.3.4")))
+
+	rz, ok = s.reverseZoneForName("4.3.2.10.in-addr.arpa.")
+	assert.True(t, ok)
+	assert.Equal(t, "0a020304.src.properties.", rz.ptrTarget(net.ParseIP("10.2.3.4")))
+
+	rz, ok = s.reverseZoneForName("1.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.8.b.d.0.1.0.0.2.ip6.arpa.")
+	assert.True(t, ok)
+	assert.Equal(t, "20010db8000000000000000000000001.src.properties.", rz.ptrTarget(net.ParseIP("2001:db8::1")))
+
+	_, ok = s.reverseZoneForName("4.3.2.11.in-addr.arpa.")
+	assert.False(t, ok)
+
+	// names above the addresses exist without data
+	assert.True(t, isEmptyNonTerminal("2.10.in-addr.arpa.", rzs[0]))
+	assert.False(t, isEmptyNonTerminal("4.3.2.10.in-addr.arpa.", rzs[0]))
+}
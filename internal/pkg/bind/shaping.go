@@ -0,0 +1,142 @@
+package bind
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/miekg/dns"
+	"github.com/rs/zerolog/log"
+)
+
+// maxShapingDelay limits how long a handler waits before answering
+const maxShapingDelay = 30 * time.Second
+
+var invalidShaping error = fmt.Errorf("Invalid response shaping")
+
+// Shaping changes how the answers for a name are sent to test the
+// behaviour of resolvers, e.g. to tell UDP and TCP fetchers apart
+type Shaping struct {
+	Delay time.Duration `json:"delay,omitempty"` // Optional. Answers are sent after the delay
+	// Truncate sets the TC bit on UDP answers and removes the records,
+	// so that resolvers retry over TCP. TCP answers are not changed
+	Truncate bool   `json:"truncate,omitempty"`
+	Rcode    string `json:"rcode,omitempty"` // Optional. e.g. SERVFAIL, REFUSED or NXDOMAIN replaces the answer
+	Drop     bool   `json:"drop,omitempty"`  // Optional. Queries are not answered
+}
+
+// shapingKey maps shaping to a name and question type. A qtype of 0
+// shapes every question for the name
+type shapingKey struct {
+	name  string
+	qtype uint16
+}
+
+// shapingMutex provides a lock for the shapingCache hashmap
+var shapingMutex = &sync.RWMutex{}
+
+var shapingCache = make(map[shapingKey]*Shaping)
+
+// validateShaping checks the delay and the rcode
+func validateShaping(s *Shaping) error {
+	if s.Delay < 0 || s.Delay > maxShapingDelay {
+		return fmt.Errorf("%v: delay must be between 0 and %v", invalidShaping, maxShapingDelay)
+	}
+	if s.Rcode != "" {
+		// extended rcodes need an OPT record and are not supported
+		if rcode, ok := dns.StringToRcode[strings.ToUpper(s.Rcode)]; !ok || rcode > 0xF {
+			return fmt.Errorf("%v: unknown rcode %s", invalidShaping, s.Rcode)
+		}
+	}
+	return nil
+}
+
+// setShaping shapes the answers for the name and record type. A nil
+// shaping removes it
+func setShaping(fqdn string, qtype uint16, s *Shaping) {
+	key := shapingKey{name: strings.ToLower(dns.Fqdn(fqdn)), qtype: qtype}
+
+	shapingMutex.Lock()
+	defer shapingMutex.Unlock()
+
+	if s == nil {
+		delete(shapingCache, key)
+		return
+	}
+	shapingCache[key] = s
+}
+
+// deleteShaping removes the shaping of every type of the name. The
+// returned bool is false if the name was not shaped
+func deleteShaping(fqdn string) bool {
+	name := strings.ToLower(dns.Fqdn(fqdn))
+
+	shapingMutex.Lock()
+	defer shapingMutex.Unlock()
+
+	deleted := false
+	for key := range shapingCache {
+		if key.name == name {
+			delete(shapingCache, key)
+			deleted = true
+		}
+	}
+	return deleted
+}
+
+// findShaping returns the shaping of the question type or the name
+func findShaping(q dns.Question) (*Shaping, bool) {
+	name := strings.ToLower(q.Name)
+
+	shapingMutex.RLock()
+	defer shapingMutex.RUnlock()
+
+	if s, ok := shapingCache[shapingKey{name: name, qtype: q.Qtype}]; ok {
+		return s, true
+	}
+	s, ok := shapingCache[shapingKey{name: name}]
+	return s, ok
+}
+
+// shapingWriter applies the shaping when the answer is written
+type shapingWriter struct {
+	dns.ResponseWriter
+	shaping *Shaping
+}
+
+// WriteMsg delays, drops or rewrites m before it is written. m is
+// copied since it is also published as an interaction
+func (w *shapingWriter) WriteMsg(m *dns.Msg) error {
+	if w.shaping.Drop {
+		log.Debug().Msgf("dropped answer to %v from %v", m.Question, w.RemoteAddr())
+		return nil
+	}
+
+	if w.shaping.Delay > 0 {
+		time.Sleep(w.shaping.Delay)
+	}
+
+	if w.shaping.Rcode != "" {
+		m = m.Copy()
+		m.Rcode = dns.StringToRcode[strings.ToUpper(w.shaping.Rcode)]
+		clearRecords(m)
+	}
+
+	if w.shaping.Truncate && w.RemoteAddr().Network() == "udp" {
+		m = m.Copy()
+		m.Truncated = true
+		clearRecords(m)
+	}
+
+	return w.ResponseWriter.WriteMsg(m)
+}
+
+// clearRecords removes every record except the OPT record
+func clearRecords(m *dns.Msg) {
+	opt := m.IsEdns0()
+	m.Answer, m.Ns, m.Extra = nil, nil, nil
+	if opt != nil {
+		m.Extra = []dns.RR{opt}
+	}
+}
@@ -0,0 +1,137 @@
+package bind
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"github.com/tmoneypenny/conspirator/internal/pkg/encoding"
+	"github.com/tmoneypenny/conspirator/internal/pkg/polling"
+	"github.com/tmoneypenny/conspirator/internal/pkg/util"
+)
+
+// startZoneServer starts UDP and TCP listeners for the zone on the
+// same port
+func startZoneServer(t *testing.T, zone string, rateLimit *rateLimiter) (string, *polling.PollingServer) {
+	pm := polling.New(&polling.PollingConfig{MaxBufferSize: 10, DeleteAfter: true}).Start()
+	s := &server{
+		Zones:         []string{zone},
+		RateLimit:     rateLimit,
+		Defaults:      map[string]*defaultProfile{},
+		PollingServer: pm,
+		Marshaller:    encoding.NewMarshaller(encoding.Format("burp")),
+		PublicAddress: "127.0.0.1",
+	}
+
+	mux := dns.NewServeMux()
+	mux.HandleFunc(dns.Fqdn(zone), s.routeHandler)
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	conn, err := net.ListenPacket("udp", l.Addr().String())
+	assert.NoError(t, err)
+
+	tcp := &dns.Server{Listener: l, Handler: mux}
+	udp := &dns.Server{PacketConn: conn, Handler: mux}
+	go tcp.ActivateAndServe()
+	go udp.ActivateAndServe()
+	t.Cleanup(func() {
+		tcp.Shutdown()
+		udp.Shutdown()
+		pm.Stop()
+	})
+
+	return l.Addr().String(), pm
+}
+
+func TestShaping(t *testing.T) {
+	addr, _ := startZoneServer(t, "shape.src", nil)
+
+	assert.NoError(t, upsertRRS(&Record{
+		FQDN:       util.StrToPtr("tc.shape.src"),
+		RecordType: util.StrToPtr("A"),
+		TTL:        util.Uint32ToPtr(60),
+		Value:      "127.0.0.1",
+		Shaping:    &Shaping{Truncate: true, Delay: 200 * time.Millisecond},
+	}))
+	defer deleteRecord(&Record{FQDN: util.StrToPtr("tc.shape.src.")})
+
+	// UDP answers are truncated, so resolvers retry over TCP
+	m := new(dns.Msg)
+	m.SetQuestion("tc.shape.src.", dns.TypeA)
+	r, rtt, err := (&dns.Client{Net: "udp"}).Exchange(m, addr)
+	assert.NoError(t, err)
+	assert.True(t, r.Truncated)
+	assert.Empty(t, r.Answer)
+	assert.GreaterOrEqual(t, int64(rtt), int64(200*time.Millisecond))
+
+	r, _, err = (&dns.Client{Net: "tcp"}).Exchange(m, addr)
+	assert.NoError(t, err)
+	assert.False(t, r.Truncated)
+	assert.Len(t, r.Answer, 1)
+
+	// names without records are shaped for every type
+	assert.NoError(t, upsertRRS(&Record{
+		FQDN:    util.StrToPtr("fail.shape.src"),
+		Shaping: &Shaping{Rcode: "servfail"},
+	}))
+	defer deleteRecord(&Record{FQDN: util.StrToPtr("fail.shape.src")})
+	m.SetQuestion("FAIL.shape.src.", dns.TypeTXT)
+	r, _, err = (&dns.Client{Net: "udp"}).Exchange(m, addr)
+	assert.NoError(t, err)
+	assert.Equal(t, dns.RcodeServerFailure, r.Rcode)
+
+	// shaping of a record only applies to its type
+	assert.NoError(t, upsertRRS(&Record{
+		FQDN:       util.StrToPtr("drop.shape.src"),
+		RecordType: util.StrToPtr("TXT"),
+		TTL:        util.Uint32ToPtr(60),
+		Value:      "token",
+		Shaping:    &Shaping{Drop: true},
+	}))
+	defer deleteRecord(&Record{FQDN: util.StrToPtr("drop.shape.src.")})
+	m.SetQuestion("drop.shape.src.", dns.TypeTXT)
+	_, _, err = (&dns.Client{Net: "udp", Timeout: 300 * time.Millisecond}).Exchange(m, addr)
+	assert.Error(t, err)
+	m.SetQuestion("drop.shape.src.", dns.TypeA)
+	r, _, err = (&dns.Client{Net: "udp"}).Exchange(m, addr)
+	assert.NoError(t, err)
+	assert.Equal(t, dns.RcodeSuccess, r.Rcode)
+
+	// deleting the records removes the shaping
+	deleteRecord(&Record{FQDN: util.StrToPtr("fail.shape.src")})
+	_, ok := findShaping(dns.Question{Name: "fail.shape.src.", Qtype: dns.TypeTXT})
+	assert.False(t, ok)
+
+	// names are deleted with or without the trailing dot
+	assert.NoError(t, upsertRRS(&Record{
+		FQDN:       util.StrToPtr("nodot.shape.src"),
+		RecordType: util.StrToPtr("A"),
+		TTL:        util.Uint32ToPtr(60),
+		Value:      "127.0.0.1",
+		Shaping:    &Shaping{Rcode: "refused"},
+	}))
+	assert.True(t, deleteRecord(&Record{FQDN: util.StrToPtr("nodot.shape.src")}))
+	_, err = findRecordInZone(&Record{FQDN: util.StrToPtr("nodot.shape.src."), RecordType: util.StrToPtr("A")})
+	assert.Error(t, err)
+	m.SetQuestion("nodot.shape.src.", dns.TypeA)
+	r, _, err = (&dns.Client{Net: "udp"}).Exchange(m, addr)
+	assert.NoError(t, err)
+	assert.Equal(t, dns.RcodeSuccess, r.Rcode)
+	assert.Equal(t, "127.0.0.1", r.Answer[0].(*dns.A).A.String())
+	assert.False(t, deleteRecord(&Record{FQDN: util.StrToPtr("nodot.shape.src")}))
+}
+
+func TestInvalidShaping(t *testing.T) {
+	for _, s := range []*Shaping{
+		{Delay: -time.Second},
+		{Delay: time.Hour},
+		{Rcode: "unknown"},
+		{Rcode: "BADSIG"},
+	} {
+		assert.Error(t, upsertRRS(&Record{FQDN: util.StrToPtr("invalid.shape.src"), Shaping: s}))
+	}
+	assert.Error(t, upsertRRS(&Record{FQDN: util.StrToPtr("invalid..shape.src"), Shaping: &Shaping{Drop: true}}))
+}
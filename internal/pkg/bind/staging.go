@@ -0,0 +1,183 @@
+package bind
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/miekg/dns"
+	"github.com/rs/zerolog/log"
+)
+
+// maxChunkSize is the number of raw bytes per chunk. 189 bytes
+// encodes to 252 base64 characters, which fits in a single TXT
+// string and keeps the answer below the 512 byte UDP limit.
+// Chunk sizes must be a multiple of 3 so that chunks can be
+// concatenated before decoding
+const (
+	maxChunkSize = 189
+	stagingTTL   = 0 // resolvers should not cache staged chunks
+)
+
+// stagingMutex provides a lock for the stagingCache hashmap
+var stagingMutex = &sync.RWMutex{}
+
+// stagingCache maps the FQDN of a staged payload to its chunks
+var stagingCache = make(map[string]*stagedFile)
+
+var invalidChunkSize error = fmt.Errorf("Invalid chunk size")
+
+// stagedFile stores a payload split into base64 encoded chunks
+type stagedFile struct {
+	Chunks []string
+	Size   int
+	SHA256 string
+}
+
+// StagedPayload describes a payload staged for delivery over DNS
+type StagedPayload struct {
+	FQDN   string `json:"fqdn"`
+	Chunks int    `json:"chunks"`
+	Size   int    `json:"size"`
+	SHA256 string `json:"sha256"`
+}
+
+// manifest returns the TXT strings that describe the staged file
+func (f *stagedFile) manifest() []string {
+	return []string{
+		fmt.Sprintf("chunks=%d", len(f.Chunks)),
+		fmt.Sprintf("size=%d", f.Size),
+		fmt.Sprintf("sha256=%s", f.SHA256),
+	}
+}
+
+// stageFile splits data into base64 chunks served at <index>.<fqdn>
+// and a manifest served at <fqdn>. An existing stage is replaced
+func stageFile(fqdn string, data []byte, chunkSize int) (*StagedPayload, error) {
+	if !validateFQDN(fqdn) {
+		return nil, invalidDomainName
+	}
+
+	if chunkSize == 0 {
+		chunkSize = maxChunkSize
+	}
+	if chunkSize < 1 || chunkSize > maxChunkSize || chunkSize%3 != 0 {
+		return nil, invalidChunkSize
+	}
+
+	sum := sha256.Sum256(data)
+	file := &stagedFile{
+		Size:   len(data),
+		SHA256: hex.EncodeToString(sum[:]),
+	}
+
+	for i := 0; i < len(data); i += chunkSize {
+		end := i + chunkSize
+		if end > len(data) {
+			end = len(data)
+		}
+		file.Chunks = append(file.Chunks, base64.StdEncoding.EncodeToString(data[i:end]))
+	}
+
+	name := strings.ToLower(dns.Fqdn(fqdn))
+	stagingMutex.Lock()
+	stagingCache[name] = file
+	stagingMutex.Unlock()
+
+	return file.describe(name), nil
+}
+
+// describe converts the stagedFile into a StagedPayload
+func (f *stagedFile) describe(name string) *StagedPayload {
+	return &StagedPayload{
+		FQDN:   name,
+		Chunks: len(f.Chunks),
+		Size:   f.Size,
+		SHA256: f.SHA256,
+	}
+}
+
+// deleteStage is a noop if the key is absent
+func deleteStage(fqdn string) {
+	stagingMutex.Lock()
+	delete(stagingCache, strings.ToLower(dns.Fqdn(fqdn)))
+	stagingMutex.Unlock()
+}
+
+// listStages returns all staged payloads ordered by name
+func listStages() []*StagedPayload {
+	stagingMutex.RLock()
+	defer stagingMutex.RUnlock()
+
+	stages := make([]*StagedPayload, 0, len(stagingCache))
+	for name, f := range stagingCache {
+		stages = append(stages, f.describe(name))
+	}
+	sort.Slice(stages, func(i, j int) bool {
+		return stages[i].FQDN < stages[j].FQDN
+	})
+	return stages
+}
+
+// findStagedAnswer returns the TXT strings for a question name that
+// matches a staged manifest or chunk. If the name is below a staged
+// payload but the index is out of range, found is true and ok is false
+func findStagedAnswer(qname string) (txt []string, found bool, ok bool) {
+	name := strings.ToLower(dns.Fqdn(qname))
+
+	stagingMutex.RLock()
+	defer stagingMutex.RUnlock()
+
+	if f, exists := stagingCache[name]; exists {
+		return f.manifest(), true, true
+	}
+
+	labels := dns.SplitDomainName(name)
+	if len(labels) < 2 {
+		return nil, false, false
+	}
+
+	f, exists := stagingCache[dns.Fqdn(strings.Join(labels[1:], "."))]
+	if !exists {
+		return nil, false, false
+	}
+
+	index, err := strconv.Atoi(labels[0])
+	if err != nil || index < 0 || index >= len(f.Chunks) {
+		return nil, true, false
+	}
+
+	return []string{f.Chunks[index]}, true, true
+}
+
+// stagingHandler answers TXT questions for staged payloads
+func (s *server) stagingHandler(w dns.ResponseWriter, r *dns.Msg, txt []string, ok bool) {
+	m := new(dns.Msg)
+	m.SetReply(r)
+
+	m.Authoritative = true
+
+	if ok {
+		m.Answer = append(m.Answer, &dns.TXT{
+			Hdr: dns.RR_Header{
+				Name:   r.Question[0].Name,
+				Rrtype: dns.TypeTXT,
+				Class:  dns.ClassINET,
+				Ttl:    stagingTTL,
+			},
+			Txt: txt,
+		})
+	} else {
+		m.SetRcode(r, dns.RcodeNameError)
+	}
+
+	go s.interactionHandler(r, m, w.RemoteAddr())
+	if err := w.WriteMsg(m); err != nil {
+		log.Error().Msgf("failed to response to DNS query: %v", m)
+	}
+}
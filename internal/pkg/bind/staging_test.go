@@ -0,0 +1,53 @@
+package bind
+
+import (
+	"bytes"
+	"encoding/base64"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStageFile(t *testing.T) {
+	data := bytes.Repeat([]byte("conspirator"), 50) // 550 bytes
+	defer deleteStage("payload.staging.src")
+
+	stage, err := stageFile("payload.staging.src", data, 0)
+	assert.NoError(t, err)
+	assert.Equal(t, "payload.staging.src.", stage.FQDN)
+	assert.Equal(t, 3, stage.Chunks)
+	assert.Equal(t, 550, stage.Size)
+
+	txt, found, ok := findStagedAnswer("PAYLOAD.staging.src.")
+	assert.True(t, found)
+	assert.True(t, ok)
+	assert.Contains(t, txt, "chunks=3")
+
+	var reassembled []byte
+	for _, index := range []string{"0", "1", "2"} {
+		txt, found, ok := findStagedAnswer(index + ".payload.staging.src.")
+		assert.True(t, found)
+		assert.True(t, ok)
+		assert.LessOrEqual(t, len(txt[0]), 255)
+		chunk, err := base64.StdEncoding.DecodeString(txt[0])
+		assert.NoError(t, err)
+		reassembled = append(reassembled, chunk...)
+	}
+	assert.Equal(t, data, reassembled)
+
+	_, found, ok = findStagedAnswer("3.payload.staging.src.")
+	assert.True(t, found)
+	assert.False(t, ok)
+
+	_, found, _ = findStagedAnswer("0.other.staging.src.")
+	assert.False(t, found)
+
+	_, err = stageFile("payload.staging.src", data, 256)
+	assert.Error(t, err)
+
+	_, err = stageFile("payload.staging.src", data, 100)
+	assert.Error(t, err)
+
+	deleteStage("payload.staging.src")
+	assert.Empty(t, listStages())
+}
@@ -0,0 +1,365 @@
+package bind
+
+import (
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/miekg/dns"
+	"github.com/rs/zerolog/log"
+)
+
+// Transfer defaults
+const (
+	transferChunkSize = 100 // RRs per message of a transfer
+	notifyDelay       = time.Second
+	notifyRetries     = 3
+	notifyTimeout     = 2 * time.Second
+)
+
+// zoneSerial is the SOA serial of every zone. It is incremented
+// whenever a record changes so that secondaries transfer the zone
+var zoneSerial = uint32(time.Now().Unix())
+
+// zoneChanged signals the NOTIFY loop that records changed
+var zoneChanged = make(chan struct{}, 1)
+
+var invalidTransferConfig error = fmt.Errorf("Invalid transfer configuration")
+
+// TransferConfig lists the secondaries allowed to transfer the zones
+// and the secondaries to notify when records change
+type TransferConfig struct {
+	Allow     []string // Optional. CIDRs of peers allowed to transfer without TSIG
+	Keys      []string // Optional. TSIG keys allowed to transfer
+	Notify    []string // Optional. Addresses of secondaries to notify
+	NotifyKey *string  // Optional. TSIG key used to sign NOTIFY messages
+}
+
+// transferPolicy is the parsed TransferConfig
+type transferPolicy struct {
+	allow     []*net.IPNet
+	keys      map[string]bool
+	notify    []string
+	notifyKey string
+	done      chan struct{}
+}
+
+// newTransferPolicy parses the config. Keys must be listed in the
+// TSIG keys of the server
+func newTransferPolicy(cfg *TransferConfig, algorithms map[string]string) (*transferPolicy, error) {
+	if cfg == nil {
+		return nil, nil
+	}
+
+	p := &transferPolicy{
+		keys: make(map[string]bool),
+		done: make(chan struct{}),
+	}
+
+	for _, cidr := range cfg.Allow {
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return nil, fmt.Errorf("%v: %v", invalidTransferConfig, err)
+		}
+		p.allow = append(p.allow, network)
+	}
+
+	for _, key := range cfg.Keys {
+		name := strings.ToLower(dns.Fqdn(key))
+		if _, ok := algorithms[name]; !ok {
+			return nil, fmt.Errorf("%v: unknown TSIG key %s", invalidTransferConfig, key)
+		}
+		p.keys[name] = true
+	}
+
+	for _, addr := range cfg.Notify {
+		if _, _, err := net.SplitHostPort(addr); err != nil {
+			addr = net.JoinHostPort(addr, "53")
+		}
+		if _, _, err := net.SplitHostPort(addr); err != nil {
+			return nil, fmt.Errorf("%v: %v", invalidTransferConfig, err)
+		}
+		p.notify = append(p.notify, addr)
+	}
+
+	if cfg.NotifyKey != nil && *cfg.NotifyKey != "" {
+		p.notifyKey = strings.ToLower(dns.Fqdn(*cfg.NotifyKey))
+		if _, ok := algorithms[p.notifyKey]; !ok {
+			return nil, fmt.Errorf("%v: unknown TSIG key %s", invalidTransferConfig, *cfg.NotifyKey)
+		}
+	}
+
+	return p, nil
+}
+
+// recordChange increments the zone serial and wakes the NOTIFY loop
+func recordChange() {
+	atomic.AddUint32(&zoneSerial, 1)
+	select {
+	case zoneChanged <- struct{}{}:
+	default:
+	}
+}
+
+// zoneSOA returns the synthesized SOA of the zone
+func zoneSOA(zone string) *dns.SOA {
+	return &dns.SOA{
+		Hdr: dns.RR_Header{
+			Name:   zone,
+			Rrtype: dns.TypeSOA,
+			Class:  dns.ClassINET,
+			Ttl:    defaultTTL,
+		},
+		Ns:      "ns1." + zone,
+		Mbox:    "hostmaster." + zone,
+		Serial:  atomic.LoadUint32(&zoneSerial),
+		Refresh: 3600,
+		Retry:   600,
+		Expire:  86400,
+		Minttl:  defaultTTL,
+	}
+}
+
+// apexZone returns the served zone or reverse zone with the name
+func (s *server) apexZone(name string) (string, bool) {
+	zone := strings.ToLower(dns.Fqdn(name))
+	for _, z := range s.Zones {
+		if strings.ToLower(dns.Fqdn(z)) == zone {
+			return zone, true
+		}
+	}
+	for _, rz := range s.ReverseZones {
+		if rz.arpa == zone {
+			return zone, true
+		}
+	}
+	return "", false
+}
+
+// transferZones returns every zone that secondaries may transfer
+func (s *server) transferZones() []string {
+	var zones []string
+	for _, z := range s.Zones {
+		zones = append(zones, strings.ToLower(dns.Fqdn(z)))
+	}
+	for _, rz := range s.ReverseZones {
+		zones = append(zones, rz.arpa)
+	}
+	return zones
+}
+
+// zoneRecords returns the SOA, the NS records of the profile and the
+// custom records in the zone. Default and synthesized answers only
+// exist at query time, so they are not part of the zone
+func (s *server) zoneRecords(zone string) []dns.RR {
+	profile, profileZone := s.profileForName(zone)
+	if rz, ok := s.reverseZoneForName(zone); ok && rz.arpa == zone {
+		profile, profileZone = s.profileForName(rz.zone)
+	}
+
+	soa := zoneSOA(zone)
+	rrs := []dns.RR{soa}
+	ns, _ := profile.answer(dns.Question{Name: zone, Qtype: dns.TypeNS, Qclass: dns.ClassINET}, profileZone, nil)
+	rrs = append(rrs, ns...)
+
+	var names []string
+	rwMutex.RLock()
+	for name := range zoneCache {
+		if dns.IsSubDomain(zone, strings.ToLower(name)) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		for _, rrtype := range sortedTypes(zoneCache[name]) {
+			for _, rr := range zoneCache[name][rrtype].Record.([]dns.RR) {
+				rrs = append(rrs, dns.Copy(rr))
+			}
+		}
+	}
+	rwMutex.RUnlock()
+
+	return append(rrs, soa)
+}
+
+// authorizeTransfer allows peers that sign the request with an allowed
+// TSIG key or connect from an allowed network
+func (s *server) authorizeTransfer(w dns.ResponseWriter, r *dns.Msg) int {
+	if s.Transfer == nil || w.RemoteAddr().Network() == dohNet {
+		return dns.RcodeRefused
+	}
+
+	if t := r.IsTsig(); t != nil {
+		if !s.Transfer.keys[strings.ToLower(t.Hdr.Name)] || w.TsigStatus() != nil {
+			return dns.RcodeNotAuth
+		}
+		return dns.RcodeSuccess
+	}
+
+	host, _, err := net.SplitHostPort(w.RemoteAddr().String())
+	if err != nil {
+		return dns.RcodeRefused
+	}
+	ip := net.ParseIP(host)
+	for _, network := range s.Transfer.allow {
+		if network.Contains(ip) {
+			return dns.RcodeSuccess
+		}
+	}
+	return dns.RcodeRefused
+}
+
+// clientSerial returns the serial of the secondary's copy of the zone
+// sent in the authority section of an IXFR request
+func clientSerial(r *dns.Msg) (uint32, bool) {
+	if r.Question[0].Qtype != dns.TypeIXFR || len(r.Ns) != 1 {
+		return 0, false
+	}
+	soa, ok := r.Ns[0].(*dns.SOA)
+	if !ok {
+		return 0, false
+	}
+	return soa.Serial, true
+}
+
+// transferHandler answers AXFR and IXFR requests of authorized peers.
+// Changes are not journaled, so IXFR requests of outdated secondaries
+// are answered with the full zone as allowed by RFC 1995 section 4
+func (s *server) transferHandler(w dns.ResponseWriter, r *dns.Msg) {
+	m := new(dns.Msg)
+	m.SetReply(r)
+	m.Authoritative = true
+
+	zone, ok := s.apexZone(r.Question[0].Name)
+	rcode := s.authorizeTransfer(w, r)
+	if rcode == dns.RcodeSuccess && !ok {
+		rcode = dns.RcodeNotAuth
+	}
+	if rcode == dns.RcodeSuccess && r.Question[0].Qtype == dns.TypeAXFR && w.RemoteAddr().Network() == "udp" {
+		rcode = dns.RcodeFormatError
+	}
+
+	if rcode != dns.RcodeSuccess {
+		log.Warn().Msgf("received zone transfer request: \n\t%v : %v [status: %v]",
+			w.RemoteAddr().String(),
+			m.Question,
+			dns.RcodeToString[rcode],
+		)
+		m.SetRcode(r, rcode)
+		go s.interactionHandler(r, m, w.RemoteAddr())
+		if err := w.WriteMsg(m); err != nil {
+			log.Error().Msgf("failed to response to DNS query: %v", m)
+		}
+		return
+	}
+
+	log.Info().Msgf("transferring %v to %v", zone, w.RemoteAddr())
+
+	// the current SOA tells up to date secondaries and UDP clients
+	// that the transfer is complete or must be retried over TCP
+	serial, isIXFR := clientSerial(r)
+	current := zoneSOA(zone)
+	if (isIXFR && int32(current.Serial-serial) <= 0) || w.RemoteAddr().Network() == "udp" {
+		m.Answer = []dns.RR{current}
+		if t := r.IsTsig(); t != nil {
+			m.SetTsig(t.Hdr.Name, t.Algorithm, tsigFudge, time.Now().Unix())
+		}
+		if err := w.WriteMsg(m); err != nil {
+			log.Error().Msgf("failed to response to DNS query: %v", m)
+		}
+		return
+	}
+
+	rrs := s.zoneRecords(zone)
+	ch := make(chan *dns.Envelope)
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		if err := new(dns.Transfer).Out(w, r, ch); err != nil {
+			log.Error().Msgf("failed to transfer %v: %v", zone, err)
+		}
+	}()
+
+	for i := 0; i < len(rrs); i += transferChunkSize {
+		end := i + transferChunkSize
+		if end > len(rrs) {
+			end = len(rrs)
+		}
+		ch <- &dns.Envelope{RR: rrs[i:end]}
+	}
+	close(ch)
+	wg.Wait()
+	w.Close()
+}
+
+// soaHandler answers SOA questions at the apex so that secondaries
+// can compare serials
+func (s *server) soaHandler(w dns.ResponseWriter, r *dns.Msg, zone string) {
+	m := new(dns.Msg)
+	m.SetReply(r)
+	m.Authoritative = true
+
+	m.Answer = append(m.Answer, zoneSOA(zone))
+	go s.interactionHandler(r, m, w.RemoteAddr())
+	if err := w.WriteMsg(m); err != nil {
+		log.Error().Msgf("failed to response to DNS query: %v", m)
+	}
+}
+
+// notifySecondaries sends NOTIFY messages for every zone when records
+// change until the policy is stopped. Changes made in quick succession
+// are sent as a single NOTIFY
+func (s *server) notifySecondaries() {
+	for {
+		select {
+		case <-s.Transfer.done:
+			return
+		case <-zoneChanged:
+		}
+
+		select {
+		case <-s.Transfer.done:
+			return
+		case <-time.After(notifyDelay):
+		}
+		select {
+		case <-zoneChanged:
+		default:
+		}
+
+		for _, zone := range s.transferZones() {
+			for _, addr := range s.Transfer.notify {
+				go s.sendNotify(zone, addr)
+			}
+		}
+	}
+}
+
+// sendNotify tells the secondary at addr that the zone changed
+func (s *server) sendNotify(zone, addr string) {
+	m := new(dns.Msg)
+	m.SetNotify(zone)
+	m.Answer = []dns.RR{zoneSOA(zone)}
+
+	if s.Transfer.notifyKey != "" {
+		m.SetTsig(s.Transfer.notifyKey, s.TSIGAlgorithms[s.Transfer.notifyKey], tsigFudge, time.Now().Unix())
+	}
+
+	c := &dns.Client{Timeout: notifyTimeout, TsigSecret: s.TSIGSecrets}
+	for i := 0; i < notifyRetries; i++ {
+		r, _, err := c.Exchange(m, addr)
+		if err == nil && r.Rcode == dns.RcodeSuccess {
+			log.Debug().Msgf("notified %v of serial %d of %v", addr, m.Answer[0].(*dns.SOA).Serial, zone)
+			return
+		}
+		if err == nil {
+			err = fmt.Errorf("%v", dns.RcodeToString[r.Rcode])
+		}
+		log.Warn().Msgf("failed to notify %v of changes to %v: %v", addr, zone, err)
+	}
+}
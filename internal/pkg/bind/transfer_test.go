@@ -0,0 +1,187 @@
+package bind
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"github.com/tmoneypenny/conspirator/internal/pkg/encoding"
+	"github.com/tmoneypenny/conspirator/internal/pkg/polling"
+	"github.com/tmoneypenny/conspirator/internal/pkg/util"
+)
+
+// startTransferServer starts a TCP listener for the xfr.src zone
+func startTransferServer(t *testing.T, cfg *TransferConfig) (*server, string) {
+	secrets, algorithms, err := newTSIGKeys([]TSIGKey{{
+		Name:   util.StrToPtr("xfr"),
+		Secret: util.StrToPtr(testTSIGSecret),
+	}})
+	assert.NoError(t, err)
+	transfer, err := newTransferPolicy(cfg, algorithms)
+	assert.NoError(t, err)
+
+	pm := polling.New(&polling.PollingConfig{MaxBufferSize: 10, DeleteAfter: true}).Start()
+	s := &server{
+		Zones:          []string{"xfr.src"},
+		TSIGAlgorithms: algorithms,
+		TSIGSecrets:    secrets,
+		Transfer:       transfer,
+		PollingServer:  pm,
+		Marshaller:     encoding.NewMarshaller(encoding.Format("burp")),
+	}
+
+	mux := dns.NewServeMux()
+	mux.HandleFunc("xfr.src.", s.routeHandler)
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	svr := &dns.Server{Listener: l, Handler: mux, TsigSecret: secrets}
+	go svr.ActivateAndServe()
+	t.Cleanup(func() {
+		svr.Shutdown()
+		pm.Stop()
+	})
+
+	return s, l.Addr().String()
+}
+
+// transferIn returns the RRs of the transfer
+func transferIn(t *testing.T, addr, key string, m *dns.Msg) []dns.RR {
+	tr := &dns.Transfer{TsigSecret: map[string]string{"xfr.": testTSIGSecret, "wrong.": testTSIGSecret}}
+	if key != "" {
+		m.SetTsig(key, dns.HmacSHA256, tsigFudge, time.Now().Unix())
+	}
+
+	ch, err := tr.In(m, addr)
+	assert.NoError(t, err)
+
+	var rrs []dns.RR
+	for env := range ch {
+		assert.NoError(t, env.Error)
+		rrs = append(rrs, env.RR...)
+	}
+	return rrs
+}
+
+func TestTransfer(t *testing.T) {
+	_, addr := startTransferServer(t, &TransferConfig{
+		Allow: []string{"192.0.2.0/24"},
+		Keys:  []string{"xfr"},
+	})
+	assert.NoError(t, upsertRRS(&Record{
+		FQDN:       util.StrToPtr("a.xfr.src"),
+		RecordType: util.StrToPtr("A"),
+		TTL:        util.Uint32ToPtr(60),
+		Value:      "127.0.0.1",
+	}))
+	defer deleteRecord(&Record{FQDN: util.StrToPtr("a.xfr.src.")})
+
+	m := new(dns.Msg)
+	m.SetAxfr("xfr.src.")
+	rrs := transferIn(t, addr, "xfr.", m)
+	assert.Len(t, rrs, 4)
+	assert.Equal(t, dns.TypeSOA, rrs[0].Header().Rrtype)
+	assert.Equal(t, dns.TypeNS, rrs[1].Header().Rrtype)
+	assert.Equal(t, "a.xfr.src.", rrs[2].Header().Name)
+	assert.Equal(t, dns.TypeSOA, rrs[3].Header().Rrtype)
+	serial := rrs[0].(*dns.SOA).Serial
+
+	// up to date secondaries only receive the SOA
+	m = new(dns.Msg)
+	m.SetIxfr("xfr.src.", serial, "ns1.xfr.src.", "hostmaster.xfr.src.")
+	rrs = transferIn(t, addr, "xfr.", m)
+	assert.Len(t, rrs, 1)
+
+	// changes increment the serial
+	deleteRecord(&Record{FQDN: util.StrToPtr("a.xfr.src.")})
+	m = new(dns.Msg)
+	m.SetIxfr("xfr.src.", serial, "ns1.xfr.src.", "hostmaster.xfr.src.")
+	rrs = transferIn(t, addr, "xfr.", m)
+	assert.Len(t, rrs, 3)
+	assert.Equal(t, serial+1, rrs[0].(*dns.SOA).Serial)
+
+	// unsigned peers outside of the allowed networks and unknown keys
+	// are refused
+	c := &dns.Client{Net: "tcp", TsigSecret: map[string]string{"wrong.": testTSIGSecret}}
+	for _, key := range []string{"", "wrong."} {
+		m = new(dns.Msg)
+		m.SetAxfr("xfr.src.")
+		if key != "" {
+			m.SetTsig(key, dns.HmacSHA256, tsigFudge, time.Now().Unix())
+		}
+		r, _, err := c.Exchange(m, addr)
+		assert.NoError(t, err)
+		assert.NotEqual(t, dns.RcodeSuccess, r.Rcode)
+		assert.Empty(t, r.Answer)
+	}
+}
+
+func TestTransferAllow(t *testing.T) {
+	_, addr := startTransferServer(t, &TransferConfig{Allow: []string{"127.0.0.0/8"}})
+
+	m := new(dns.Msg)
+	m.SetAxfr("xfr.src.")
+	rrs := transferIn(t, addr, "", m)
+	assert.Len(t, rrs, 3)
+
+	// secondaries compare the serial of the apex SOA
+	c := &dns.Client{Net: "tcp"}
+	m = new(dns.Msg)
+	m.SetQuestion("xfr.src.", dns.TypeSOA)
+	r, _, err := c.Exchange(m, addr)
+	assert.NoError(t, err)
+	assert.Equal(t, rrs[0].String(), r.Answer[0].String())
+}
+
+func TestNotify(t *testing.T) {
+	notified := make(chan *dns.Msg, 1)
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	secondary := &dns.Server{
+		PacketConn: conn,
+		TsigSecret: map[string]string{"xfr.": testTSIGSecret},
+		Handler: dns.HandlerFunc(func(w dns.ResponseWriter, r *dns.Msg) {
+			assert.NoError(t, w.TsigStatus())
+			m := new(dns.Msg)
+			m.SetReply(r)
+			w.WriteMsg(m)
+			notified <- r
+		}),
+	}
+	go secondary.ActivateAndServe()
+	defer secondary.Shutdown()
+
+	s, _ := startTransferServer(t, &TransferConfig{
+		Notify:    []string{conn.LocalAddr().String()},
+		NotifyKey: util.StrToPtr("xfr"),
+	})
+	go s.notifySecondaries()
+	defer close(s.Transfer.done)
+
+	recordChange()
+	select {
+	case r := <-notified:
+		assert.Equal(t, dns.OpcodeNotify, r.Opcode)
+		assert.Equal(t, "xfr.src.", r.Question[0].Name)
+		assert.Equal(t, zoneSOA("xfr.src.").Serial, r.Answer[0].(*dns.SOA).Serial)
+	case <-time.After(5 * time.Second):
+		t.Fatal("secondary was not notified")
+	}
+}
+
+func TestNewTransferPolicy(t *testing.T) {
+	_, algorithms, _ := newTSIGKeys([]TSIGKey{{Name: util.StrToPtr("xfr"), Secret: util.StrToPtr(testTSIGSecret)}})
+
+	p, err := newTransferPolicy(&TransferConfig{Notify: []string{"192.0.2.1", "[2001:db8::1]:5353"}}, algorithms)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"192.0.2.1:53", "[2001:db8::1]:5353"}, p.notify)
+
+	_, err = newTransferPolicy(&TransferConfig{Allow: []string{"192.0.2.1"}}, algorithms)
+	assert.Error(t, err)
+	_, err = newTransferPolicy(&TransferConfig{Keys: []string{"unknown"}}, algorithms)
+	assert.Error(t, err)
+	_, err = newTransferPolicy(&TransferConfig{NotifyKey: util.StrToPtr("unknown")}, algorithms)
+	assert.Error(t, err)
+}
@@ -0,0 +1,411 @@
+package bind
+
+import (
+	"encoding/base64"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/miekg/dns"
+	"github.com/rs/zerolog/log"
+)
+
+// tsigFudge is the permitted clock skew of signed responses
+const tsigFudge = 300
+
+var invalidTSIGKey error = fmt.Errorf("Invalid TSIG key")
+
+// TSIGKey is a shared secret that authenticates dynamic updates
+type TSIGKey struct {
+	Name      *string // e.g. certbot.
+	Algorithm *string // Optional. Defaults to hmac-sha256
+	Secret    *string // base64 encoded
+}
+
+// tsigAlgorithms are the supported TSIG algorithms
+var tsigAlgorithms = map[string]struct{}{
+	dns.HmacSHA1:   {},
+	dns.HmacSHA224: {},
+	dns.HmacSHA256: {},
+	dns.HmacSHA384: {},
+	dns.HmacSHA512: {},
+}
+
+// newTSIGKeys returns the secrets and algorithms mapped by key name
+func newTSIGKeys(keys []TSIGKey) (map[string]string, map[string]string, error) {
+	secrets := make(map[string]string)
+	algorithms := make(map[string]string)
+	for _, k := range keys {
+		if k.Name == nil || !validateFQDN(*k.Name) || k.Secret == nil {
+			return nil, nil, invalidTSIGKey
+		}
+		if _, err := base64.StdEncoding.DecodeString(*k.Secret); err != nil || *k.Secret == "" {
+			return nil, nil, invalidTSIGKey
+		}
+
+		algorithm := dns.HmacSHA256
+		if k.Algorithm != nil && *k.Algorithm != "" {
+			algorithm = strings.ToLower(dns.Fqdn(*k.Algorithm))
+		}
+		if _, ok := tsigAlgorithms[algorithm]; !ok {
+			return nil, nil, invalidTSIGKey
+		}
+
+		name := strings.ToLower(dns.Fqdn(*k.Name))
+		secrets[name] = *k.Secret
+		algorithms[name] = algorithm
+	}
+	return secrets, algorithms, nil
+}
+
+// msgAcceptFunc accepts dynamic updates, which are rejected by the
+// default accept func since the sections may contain many RRs
+func msgAcceptFunc(dh dns.Header) dns.MsgAcceptAction {
+	isResponse := dh.Bits&(1<<15) != 0
+	if opcode := int(dh.Bits>>11) & 0xF; opcode != dns.OpcodeUpdate || isResponse {
+		return dns.DefaultMsgAcceptFunc(dh)
+	}
+
+	// the additional section may only hold the OPT and TSIG records
+	if dh.Qdcount != 1 || dh.Arcount > 2 {
+		return dns.MsgReject
+	}
+	return dns.MsgAccept
+}
+
+// rdataValue converts the RR into the Record value accepted by
+// buildRRS so that updates are validated like upsertRRS
+func rdataValue(rr dns.RR) (interface{}, bool) {
+	switch v := rr.(type) {
+	case *dns.A:
+		return v.A.String(), true
+	case *dns.AAAA:
+		return v.AAAA.String(), true
+	case *dns.CNAME:
+		return v.Target, true
+	case *dns.PTR:
+		return v.Ptr, true
+	case *dns.NS:
+		return v.Ns, true
+	case *dns.TXT:
+		return v.Txt, true
+	case *dns.SPF:
+		return v.Txt, true
+	case *dns.MX:
+		return fmt.Sprintf("%d %s", v.Preference, v.Mx), true
+	case *dns.SRV:
+		return fmt.Sprintf("%d %d %d %s", v.Priority, v.Weight, v.Port, v.Target), true
+	case *dns.CAA, *dns.NAPTR, *dns.HTTPS, *dns.SVCB, *dns.DS:
+		return strings.TrimPrefix(rr.String(), rr.Header().String()), true
+	}
+	return nil, false
+}
+
+// authorizeUpdate checks that the update is signed with a known key
+func (s *server) authorizeUpdate(w dns.ResponseWriter, r *dns.Msg) int {
+	t := r.IsTsig()
+	if t == nil {
+		log.Warn().Msgf("rejected unsigned update from %v", w.RemoteAddr())
+		return dns.RcodeRefused
+	}
+
+	algorithm, ok := s.TSIGAlgorithms[strings.ToLower(t.Hdr.Name)]
+	if !ok || !strings.EqualFold(algorithm, t.Algorithm) {
+		log.Warn().Msgf("rejected update with unknown key %s from %v", t.Hdr.Name, w.RemoteAddr())
+		return dns.RcodeNotAuth
+	}
+
+	if err := w.TsigStatus(); err != nil {
+		log.Warn().Msgf("rejected update with invalid TSIG from %v: %v", w.RemoteAddr(), err)
+		return dns.RcodeNotAuth
+	}
+
+	return dns.RcodeSuccess
+}
+
+// updateZone returns the zone named in the zone section if it is served
+func (s *server) updateZone(r *dns.Msg) (string, int) {
+	if len(r.Question) != 1 || r.Question[0].Qtype != dns.TypeSOA {
+		return "", dns.RcodeFormatError
+	}
+
+	if zone, ok := s.apexZone(r.Question[0].Name); ok {
+		return zone, dns.RcodeSuccess
+	}
+	return "", dns.RcodeNotAuth
+}
+
+// checkPrerequisites evaluates the prerequisite section against the
+// zone store as described in RFC 2136 section 3.2. The caller must
+// hold rwMutex
+func checkPrerequisites(zone string, prereqs []dns.RR) int {
+	expected := make(map[string][]dns.RR)
+	for _, rr := range prereqs {
+		h := rr.Header()
+		if h.Ttl != 0 {
+			return dns.RcodeFormatError
+		}
+		if !dns.IsSubDomain(zone, strings.ToLower(h.Name)) {
+			return dns.RcodeNotZone
+		}
+
+		rrsets, exists := zoneCache[zoneKey(h.Name)]
+		_, rrsetExists := rrsets[h.Rrtype]
+		switch h.Class {
+		case dns.ClassANY:
+			if h.Rdlength != 0 {
+				return dns.RcodeFormatError
+			}
+			if h.Rrtype == dns.TypeANY && !exists {
+				return dns.RcodeNameError
+			}
+			if h.Rrtype != dns.TypeANY && !rrsetExists {
+				return dns.RcodeNXRrset
+			}
+		case dns.ClassNONE:
+			if h.Rdlength != 0 {
+				return dns.RcodeFormatError
+			}
+			if h.Rrtype == dns.TypeANY && exists {
+				return dns.RcodeYXDomain
+			}
+			if h.Rrtype != dns.TypeANY && rrsetExists {
+				return dns.RcodeYXRrset
+			}
+		case dns.ClassINET:
+			key := zoneKey(h.Name) + "/" + dns.TypeToString[h.Rrtype]
+			expected[key] = append(expected[key], rr)
+		default:
+			return dns.RcodeFormatError
+		}
+	}
+
+	// value dependent prerequisites must match the RRset exactly
+	for _, rrset := range expected {
+		h := rrset[0].Header()
+		entry, exists := zoneCache[zoneKey(h.Name)][h.Rrtype]
+		if !exists {
+			return dns.RcodeNXRrset
+		}
+
+		stored := entry.Record.([]dns.RR)
+		if len(stored) != len(rrset) {
+			return dns.RcodeNXRrset
+		}
+		for _, rr := range rrset {
+			found := false
+			for _, existing := range stored {
+				if dns.IsDuplicate(rr, existing) {
+					found = true
+					break
+				}
+			}
+			if !found {
+				return dns.RcodeNXRrset
+			}
+		}
+	}
+
+	return dns.RcodeSuccess
+}
+
+// prescanUpdate validates the update section before any change is
+// made, building the RRs to add with the same validation as upsertRRS
+func prescanUpdate(zone string, updates []dns.RR) (map[int][]dns.RR, int) {
+	adds := make(map[int][]dns.RR)
+	for i, rr := range updates {
+		h := rr.Header()
+		if !dns.IsSubDomain(zone, strings.ToLower(h.Name)) {
+			return nil, dns.RcodeNotZone
+		}
+
+		switch h.Class {
+		case dns.ClassINET:
+			value, ok := rdataValue(rr)
+			if !ok {
+				return nil, dns.RcodeNotImplemented
+			}
+
+			recordType := dns.TypeToString[h.Rrtype]
+			rrs, err := buildRRS(&Record{
+				FQDN:       &h.Name,
+				RecordType: &recordType,
+				TTL:        &h.Ttl,
+				Value:      value,
+			})
+			if err != nil {
+				log.Debug().Msgf("invalid update %v: %v", rr, err)
+				return nil, dns.RcodeRefused
+			}
+			adds[i] = rrs
+		case dns.ClassANY:
+			if h.Ttl != 0 || h.Rdlength != 0 {
+				return nil, dns.RcodeFormatError
+			}
+		case dns.ClassNONE:
+			if h.Ttl != 0 || h.Rrtype == dns.TypeANY {
+				return nil, dns.RcodeFormatError
+			}
+		default:
+			return nil, dns.RcodeFormatError
+		}
+	}
+	return adds, dns.RcodeSuccess
+}
+
+// applyUpdate adds and deletes the RRs in the zone store. The caller
+// must hold rwMutex
+func applyUpdate(updates []dns.RR, adds map[int][]dns.RR) {
+	for i, rr := range updates {
+		h := rr.Header()
+		recordType := dns.TypeToString[h.Rrtype]
+		entry, exists := zoneCache[zoneKey(h.Name)][h.Rrtype]
+
+		switch h.Class {
+		case dns.ClassINET:
+			if !exists || h.Rrtype == dns.TypeCNAME {
+				storeRRS(h.Name, zoneRRS{RecordType: recordType, TTL: h.Ttl, Record: adds[i]})
+				continue
+			}
+
+			// copy the RRset since it may be in use by a response
+			var stored []dns.RR
+			for _, existing := range entry.Record.([]dns.RR) {
+				stored = append(stored, dns.Copy(existing))
+			}
+			for _, add := range adds[i] {
+				duplicate := false
+				for _, existing := range stored {
+					if dns.IsDuplicate(add, existing) {
+						duplicate = true
+						break
+					}
+				}
+				if !duplicate {
+					stored = append(stored, add)
+				}
+			}
+			// all RRs in an RRset share the TTL of the last update
+			for _, rr := range stored {
+				rr.Header().Ttl = h.Ttl
+			}
+			storeRRS(h.Name, zoneRRS{RecordType: recordType, TTL: h.Ttl, Record: stored})
+		case dns.ClassANY:
+			if h.Rrtype == dns.TypeANY {
+				delete(zoneCache, zoneKey(h.Name))
+			} else {
+				removeRRS(h.Name, h.Rrtype)
+			}
+		case dns.ClassNONE:
+			if !exists {
+				continue
+			}
+
+			var kept []dns.RR
+			for _, existing := range entry.Record.([]dns.RR) {
+				match := dns.Copy(rr)
+				match.Header().Class = dns.ClassINET
+				if !dns.IsDuplicate(match, existing) {
+					kept = append(kept, existing)
+				}
+			}
+			if len(kept) == 0 {
+				removeRRS(h.Name, h.Rrtype)
+			} else {
+				entry.Record = kept
+				storeRRS(h.Name, entry)
+			}
+		}
+	}
+}
+
+// update processes a dynamic update and returns the rcode
+func (s *server) update(w dns.ResponseWriter, r *dns.Msg) int {
+	if rcode := s.authorizeUpdate(w, r); rcode != dns.RcodeSuccess {
+		return rcode
+	}
+
+	zone, rcode := s.updateZone(r)
+	if rcode != dns.RcodeSuccess {
+		return rcode
+	}
+
+	adds, rcode := prescanUpdate(zone, r.Ns)
+	if rcode != dns.RcodeSuccess {
+		return rcode
+	}
+
+	rwMutex.Lock()
+	defer rwMutex.Unlock()
+
+	if rcode := checkPrerequisites(zone, r.Answer); rcode != dns.RcodeSuccess {
+		return rcode
+	}
+
+	applyUpdate(r.Ns, adds)
+	recordChange()
+	return dns.RcodeSuccess
+}
+
+// updateHandler applies RFC 2136 dynamic updates signed with TSIG
+func (s *server) updateHandler(w dns.ResponseWriter, r *dns.Msg) {
+	m := new(dns.Msg)
+	m.SetReply(r)
+
+	rcode := s.update(w, r)
+	m.SetRcode(r, rcode)
+
+	// sign the response with the key of an authorized request
+	if t := r.IsTsig(); t != nil && rcode != dns.RcodeNotAuth && rcode != dns.RcodeRefused {
+		m.SetTsig(t.Hdr.Name, t.Algorithm, tsigFudge, time.Now().Unix())
+	}
+
+	log.Info().Msgf("update of %v from %v with %v [status: %v]", m.Question, w.RemoteAddr(), r.Ns, dns.RcodeToString[rcode])
+
+	go s.interactionHandler(r, m, w.RemoteAddr())
+	if err := w.WriteMsg(m); err != nil {
+		log.Error().Msgf("failed to response to DNS query: %v", m)
+	}
+}
+
+// addTXT merges the value into the TXT records of the name as a
+// dynamic update would, so that concurrent challenges can coexist
+func addTXT(fqdn, value string, ttl uint32) error {
+	rr := &dns.TXT{
+		Hdr: dns.RR_Header{
+			Name:   dns.Fqdn(fqdn),
+			Rrtype: dns.TypeTXT,
+			Class:  dns.ClassINET,
+			Ttl:    ttl,
+		},
+		Txt: []string{value},
+	}
+
+	adds, rcode := prescanUpdate(".", []dns.RR{rr})
+	if rcode != dns.RcodeSuccess {
+		return invalidRR
+	}
+
+	rwMutex.Lock()
+	applyUpdate([]dns.RR{rr}, adds)
+	rwMutex.Unlock()
+	recordChange()
+	return nil
+}
+
+// removeTXT removes the value from the TXT records of the name
+func removeTXT(fqdn, value string) {
+	rr := &dns.TXT{
+		Hdr: dns.RR_Header{
+			Name:   dns.Fqdn(fqdn),
+			Rrtype: dns.TypeTXT,
+			Class:  dns.ClassNONE,
+		},
+		Txt: []string{value},
+	}
+
+	rwMutex.Lock()
+	applyUpdate([]dns.RR{rr}, nil)
+	rwMutex.Unlock()
+	recordChange()
+}
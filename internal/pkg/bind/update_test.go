@@ -0,0 +1,177 @@
+package bind
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"github.com/tmoneypenny/conspirator/internal/pkg/encoding"
+	"github.com/tmoneypenny/conspirator/internal/pkg/polling"
+	"github.com/tmoneypenny/conspirator/internal/pkg/util"
+)
+
+const testTSIGSecret = "c3JjLnByb3BlcnRpZXMgdXBkYXRlIGtleQ=="
+
+// startUpdateServer starts a UDP listener that accepts updates signed
+// with the update. key
+func startUpdateServer(t *testing.T) string {
+	secrets, algorithms, err := newTSIGKeys([]TSIGKey{{
+		Name:   util.StrToPtr("update"),
+		Secret: util.StrToPtr(testTSIGSecret),
+	}})
+	assert.NoError(t, err)
+
+	pm := polling.New(&polling.PollingConfig{MaxBufferSize: 10, DeleteAfter: true}).Start()
+	s := &server{
+		Zones:          []string{"update.src"},
+		TSIGAlgorithms: algorithms,
+		PollingServer:  pm,
+		Marshaller:     encoding.NewMarshaller(encoding.Format("burp")),
+	}
+
+	mux := dns.NewServeMux()
+	mux.HandleFunc("update.src.", s.routeHandler)
+
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	svr := &dns.Server{PacketConn: conn, Handler: mux, TsigSecret: secrets, MsgAcceptFunc: msgAcceptFunc}
+	go svr.ActivateAndServe()
+	t.Cleanup(func() {
+		svr.Shutdown()
+		pm.Stop()
+	})
+
+	return conn.LocalAddr().String()
+}
+
+// sendUpdate signs the update when key is set and returns the rcode
+func sendUpdate(t *testing.T, addr, key string, m *dns.Msg) int {
+	c := &dns.Client{TsigSecret: map[string]string{"update.": testTSIGSecret, "wrong.": testTSIGSecret}}
+	if key != "" {
+		m.SetTsig(key, dns.HmacSHA256, tsigFudge, time.Now().Unix())
+	}
+
+	r, _, err := c.Exchange(m, addr)
+	assert.NoError(t, err)
+	return r.Rcode
+}
+
+func TestUpdate(t *testing.T) {
+	addr := startUpdateServer(t)
+	defer func() {
+		for _, name := range []string{"_acme-challenge.update.src.", "a.update.src.", "a.other.src."} {
+			deleteRecord(&Record{FQDN: util.StrToPtr(name)})
+		}
+	}()
+
+	newUpdate := func() *dns.Msg {
+		m := new(dns.Msg)
+		m.SetUpdate("update.src.")
+		return m
+	}
+	mustRR := func(s string) dns.RR {
+		rr, err := dns.NewRR(s)
+		assert.NoError(t, err)
+		return rr
+	}
+
+	// both ACME tokens are kept as separate TXT records
+	m := newUpdate()
+	m.Insert([]dns.RR{
+		mustRR(`_acme-challenge.update.src. 60 IN TXT "token1"`),
+		mustRR(`_acme-challenge.update.src. 60 IN TXT "token2"`),
+	})
+	assert.Equal(t, dns.RcodeSuccess, sendUpdate(t, addr, "update.", m))
+
+	rec, err := findRecordInZone(&Record{FQDN: util.StrToPtr("_acme-challenge.update.src."), RecordType: util.StrToPtr("TXT")})
+	assert.NoError(t, err)
+	assert.Equal(t, "TXT", rec.RecordType)
+	assert.Len(t, rec.Record.([]dns.RR), 2)
+
+	// remove a single record
+	m = newUpdate()
+	m.Remove([]dns.RR{mustRR(`_acme-challenge.update.src. 0 IN TXT "token1"`)})
+	assert.Equal(t, dns.RcodeSuccess, sendUpdate(t, addr, "update.", m))
+	rec, _ = findRecordInZone(&Record{FQDN: util.StrToPtr("_acme-challenge.update.src."), RecordType: util.StrToPtr("TXT")})
+	assert.Equal(t, []string{"token2"}, rec.Record.([]dns.RR)[0].(*dns.TXT).Txt)
+
+	// prerequisites are checked before the update is applied
+	m = newUpdate()
+	m.NameUsed([]dns.RR{mustRR("a.update.src. 0 IN A 127.0.0.1")})
+	m.Insert([]dns.RR{mustRR("a.update.src. 60 IN A 127.0.0.1")})
+	assert.Equal(t, dns.RcodeNameError, sendUpdate(t, addr, "update.", m))
+
+	m = newUpdate()
+	m.NameNotUsed([]dns.RR{mustRR("a.update.src. 0 IN A 127.0.0.1")})
+	m.Insert([]dns.RR{mustRR("a.update.src. 60 IN A 127.0.0.1")})
+	assert.Equal(t, dns.RcodeSuccess, sendUpdate(t, addr, "update.", m))
+	_, err = findRecordInZone(&Record{FQDN: util.StrToPtr("a.update.src."), RecordType: util.StrToPtr("A")})
+	assert.NoError(t, err)
+
+	m = newUpdate()
+	m.RRsetUsed([]dns.RR{mustRR("_acme-challenge.update.src. 0 IN TXT")})
+	m.RemoveName([]dns.RR{mustRR("_acme-challenge.update.src. 0 IN TXT")})
+	assert.Equal(t, dns.RcodeSuccess, sendUpdate(t, addr, "update.", m))
+	_, err = findRecordInZone(&Record{FQDN: util.StrToPtr("_acme-challenge.update.src."), RecordType: util.StrToPtr("TXT")})
+	assert.Error(t, err)
+
+	// unsigned, unknown keys, other zones and invalid records are rejected
+	m = newUpdate()
+	m.Insert([]dns.RR{mustRR("b.update.src. 60 IN A 127.0.0.1")})
+	assert.Equal(t, dns.RcodeRefused, sendUpdate(t, addr, "", m))
+
+	m = newUpdate()
+	m.Insert([]dns.RR{mustRR("b.update.src. 60 IN A 127.0.0.1")})
+	assert.Equal(t, dns.RcodeNotAuth, sendUpdate(t, addr, "wrong.", m))
+
+	m = newUpdate()
+	m.Insert([]dns.RR{mustRR("a.other.src. 60 IN A 127.0.0.1")})
+	assert.Equal(t, dns.RcodeNotZone, sendUpdate(t, addr, "update.", m))
+
+	m = newUpdate()
+	m.Insert([]dns.RR{mustRR("b.update.src. 60 IN HINFO cpu os")})
+	assert.Equal(t, dns.RcodeNotImplemented, sendUpdate(t, addr, "update.", m))
+
+	_, err = findRecordInZone(&Record{FQDN: util.StrToPtr("b.update.src."), RecordType: util.StrToPtr("A")})
+	assert.Error(t, err)
+}
+
+func TestNewTSIGKeys(t *testing.T) {
+	_, algorithms, err := newTSIGKeys([]TSIGKey{{
+		Name:      util.StrToPtr("Certbot"),
+		Algorithm: util.StrToPtr("HMAC-SHA512"),
+		Secret:    util.StrToPtr(testTSIGSecret),
+	}})
+	assert.NoError(t, err)
+	assert.Equal(t, dns.HmacSHA512, algorithms["certbot."])
+
+	_, _, err = newTSIGKeys([]TSIGKey{{Name: util.StrToPtr("certbot"), Secret: util.StrToPtr("not base64!")}})
+	assert.Error(t, err)
+
+	_, _, err = newTSIGKeys([]TSIGKey{{Name: util.StrToPtr("certbot"), Algorithm: util.StrToPtr("hmac-md5"), Secret: util.StrToPtr(testTSIGSecret)}})
+	assert.Error(t, err)
+}
+
+func TestAddTXT(t *testing.T) {
+	name := "_acme-challenge.txt.src."
+	defer deleteRecord(&Record{FQDN: util.StrToPtr(name)})
+
+	// both challenges of a wildcard order share the name
+	assert.NoError(t, addTXT(name, "token1", 60))
+	assert.NoError(t, addTXT(name, "token2", 60))
+	rec, err := findRecordInZone(&Record{FQDN: util.StrToPtr(name), RecordType: util.StrToPtr("TXT")})
+	assert.NoError(t, err)
+	assert.Len(t, rec.Record.([]dns.RR), 2)
+
+	removeTXT(name, "token1")
+	rec, _ = findRecordInZone(&Record{FQDN: util.StrToPtr(name), RecordType: util.StrToPtr("TXT")})
+	assert.Equal(t, []string{"token2"}, rec.Record.([]dns.RR)[0].(*dns.TXT).Txt)
+
+	removeTXT(name, "token2")
+	_, err = findRecordInZone(&Record{FQDN: util.StrToPtr(name), RecordType: util.StrToPtr("TXT")})
+	assert.Error(t, err)
+
+	assert.Error(t, addTXT("invalid..name", "token", 60))
+}
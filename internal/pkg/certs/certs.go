@@ -0,0 +1,65 @@
+package certs
+
+import (
+	"crypto/tls"
+)
+
+// Manager is a facade to the certificates shared by all TLS
+// listeners. Certificates are reloaded when their files change, so
+// renewed certificates are used without a restart
+type Manager struct {
+	manager *manager
+}
+
+// NewManager returns a manager without certificates
+func NewManager() (*Manager, error) {
+	m, err := newManager()
+	if err != nil {
+		return nil, err
+	}
+
+	return &Manager{manager: m}, nil
+}
+
+// Start reloads certificates when their files change
+func (m *Manager) Start() {
+	m.manager.start()
+}
+
+// Stop stops watching the certificate files
+func (m *Manager) Stop() {
+	m.manager.stop()
+}
+
+// AddKeyPair loads the PEM encoded key pair and reloads it whenever
+// the files change. The files are watched even if they cannot be
+// loaded yet, e.g. before ACME obtained the certificate. The
+// directories of the files must exist
+func (m *Manager) AddKeyPair(certFile, keyFile string) error {
+	_, err := m.manager.addKeyPair(certFile, keyFile)
+	return err
+}
+
+// GetCertificate returns the certificate that is valid for the SNI of
+// the client or the first loaded certificate
+func (m *Manager) GetCertificate(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	return m.manager.getCertificate(hello, nil)
+}
+
+// Listener adds the key pair of a listener and returns the
+// tls.Config.GetCertificate of the listener. Clients without a
+// matching SNI receive the key pair of the listener. The key pair
+// is optional if other certificates, e.g. from ACME, are added
+func (m *Manager) Listener(certFile, keyFile string) (func(*tls.ClientHelloInfo) (*tls.Certificate, error), error) {
+	var pair *keyPair
+	if certFile != "" || keyFile != "" {
+		var err error
+		if pair, err = m.manager.addKeyPair(certFile, keyFile); err != nil {
+			return nil, err
+		}
+	}
+
+	return func(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+		return m.manager.getCertificate(hello, pair)
+	}, nil
+}
@@ -0,0 +1,150 @@
+package certs
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+// writeKeyPair writes a self-signed certificate for the names to
+// <dir>/<name>.pem and <dir>/<name>.key
+func writeKeyPair(t *testing.T, dir, name string, notAfter time.Time, names ...string) (string, string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err)
+
+	der, err := x509.CreateCertificate(rand.Reader, &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: names[0]},
+		DNSNames:     names,
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     notAfter,
+	}, &x509.Certificate{SerialNumber: big.NewInt(1)}, &key.PublicKey, key)
+	assert.NoError(t, err)
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	assert.NoError(t, err)
+
+	certFile := filepath.Join(dir, name+".pem")
+	keyFile := filepath.Join(dir, name+".key")
+	assert.NoError(t, ioutil.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600))
+	assert.NoError(t, ioutil.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600))
+	return certFile, keyFile
+}
+
+// waitFor polls the condition until the reload happened
+func waitFor(t *testing.T, condition func() bool) {
+	deadline := time.Now().Add(5 * time.Second)
+	for !condition() {
+		if time.Now().After(deadline) {
+			t.Fatal("certificate was not reloaded")
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+}
+
+func TestGetCertificate(t *testing.T) {
+	dir := t.TempDir()
+	notAfter := time.Now().Add(24 * time.Hour)
+	srcCert, srcKey := writeKeyPair(t, dir, "src", notAfter, "src.properties", "*.src.properties")
+	devCert, devKey := writeKeyPair(t, dir, "dev", notAfter, "dev.properties", "*.dev.properties")
+
+	m, err := NewManager()
+	assert.NoError(t, err)
+	defer m.Stop()
+
+	_, err = m.GetCertificate(&tls.ClientHelloInfo{})
+	assert.Error(t, err)
+
+	assert.NoError(t, m.AddKeyPair(srcCert, srcKey))
+	devListener, err := m.Listener(devCert, devKey)
+	assert.NoError(t, err)
+
+	cert, err := m.GetCertificate(&tls.ClientHelloInfo{ServerName: "abc.dev.properties."})
+	assert.NoError(t, err)
+	assert.Equal(t, "dev.properties", cert.Leaf.Subject.CommonName)
+
+	// clients without a matching SNI receive the first certificate or
+	// the certificate of the listener
+	cert, _ = m.GetCertificate(&tls.ClientHelloInfo{ServerName: "a.b.dev.properties"})
+	assert.Equal(t, "src.properties", cert.Leaf.Subject.CommonName)
+	cert, _ = devListener(&tls.ClientHelloInfo{})
+	assert.Equal(t, "dev.properties", cert.Leaf.Subject.CommonName)
+	cert, _ = devListener(&tls.ClientHelloInfo{ServerName: "abc.src.properties"})
+	assert.Equal(t, "src.properties", cert.Leaf.Subject.CommonName)
+
+	// listeners without a key pair use the certificates of other pairs
+	acmeListener, err := m.Listener("", "")
+	assert.NoError(t, err)
+	cert, _ = acmeListener(&tls.ClientHelloInfo{ServerName: "dev.properties"})
+	assert.Equal(t, "dev.properties", cert.Leaf.Subject.CommonName)
+
+	_, err = m.Listener(filepath.Join(dir, "missing.pem"), filepath.Join(dir, "missing.key"))
+	assert.Error(t, err)
+}
+
+func TestReload(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := writeKeyPair(t, dir, "src", time.Now().Add(24*time.Hour), "src.properties")
+
+	m, err := NewManager()
+	assert.NoError(t, err)
+	m.Start()
+	defer m.Stop()
+
+	getCertificate, err := m.Listener(certFile, keyFile)
+	assert.NoError(t, err)
+	old, _ := getCertificate(&tls.ClientHelloInfo{})
+
+	notAfter := time.Now().Add(90 * 24 * time.Hour).Truncate(time.Second)
+	writeKeyPair(t, dir, "src", notAfter, "src.properties")
+	waitFor(t, func() bool {
+		cert, _ := getCertificate(&tls.ClientHelloInfo{})
+		return cert != old
+	})
+	assert.Equal(t, float64(notAfter.Unix()), testutil.ToFloat64(certificateExpiry.WithLabelValues(certFile)))
+
+	// invalid files keep the previous certificate
+	errors := testutil.ToFloat64(certificateReloadErrors)
+	assert.NoError(t, ioutil.WriteFile(certFile, []byte("not a certificate"), 0600))
+	waitFor(t, func() bool {
+		return testutil.ToFloat64(certificateReloadErrors) > errors
+	})
+	cert, _ := getCertificate(&tls.ClientHelloInfo{})
+	assert.Equal(t, notAfter.Unix(), cert.Leaf.NotAfter.Unix())
+}
+
+func TestAddKeyPair(t *testing.T) {
+	dir := t.TempDir()
+
+	m, err := NewManager()
+	assert.NoError(t, err)
+	m.Start()
+	defer m.Stop()
+
+	assert.Error(t, m.AddKeyPair("", ""))
+	assert.Error(t, m.AddKeyPair(filepath.Join(dir, "missing", "src.pem"), filepath.Join(dir, "missing", "src.key")))
+
+	// files created after the key pair was added are loaded
+	certFile, keyFile := filepath.Join(dir, "src.pem"), filepath.Join(dir, "src.key")
+	assert.Error(t, m.AddKeyPair(certFile, keyFile))
+	_, err = os.Stat(certFile)
+	assert.True(t, os.IsNotExist(err))
+
+	writeKeyPair(t, dir, "src", time.Now().Add(24*time.Hour), "src.properties")
+	waitFor(t, func() bool {
+		_, err := m.GetCertificate(&tls.ClientHelloInfo{ServerName: "src.properties"})
+		return err == nil
+	})
+}
@@ -0,0 +1,228 @@
+package certs
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/rs/zerolog/log"
+)
+
+// reloadDelay collects the events of a cert and key that are
+// replaced one after another into a single reload
+const reloadDelay = 500 * time.Millisecond
+
+// Errors
+var (
+	missingKeyPair error = fmt.Errorf("No key pair configured")
+	noCertificate  error = fmt.Errorf("No certificate available")
+)
+
+var (
+	certificateExpiry = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "tls_certificate_expiry_timestamp_seconds",
+		Help: "Expiry of the loaded TLS certificates",
+	}, []string{"cert_file"})
+
+	certificateReloadErrors = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "tls_certificate_reload_errors_total",
+		Help: "Total failed TLS certificate reloads",
+	})
+)
+
+// keyPair is a certificate loaded from a cert and key file
+type keyPair struct {
+	certFile string
+	keyFile  string
+	cert     *tls.Certificate // nil until the files are loaded
+}
+
+// manager loads key pairs and reloads them when the files in their
+// directories change. Directories are watched rather than the files,
+// since renewed certificates usually replace the files
+type manager struct {
+	watcher *fsnotify.Watcher
+	mutex   *sync.RWMutex
+	pairs   []*keyPair // in the order they were added
+	dirs    map[string]bool
+	done    chan struct{}
+	wg      sync.WaitGroup
+}
+
+func newManager() (*manager, error) {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, err
+	}
+
+	return &manager{
+		watcher: watcher,
+		mutex:   &sync.RWMutex{},
+		dirs:    make(map[string]bool),
+		done:    make(chan struct{}),
+	}, nil
+}
+
+// addKeyPair registers, watches and loads the key pair. The pair is
+// returned even if it cannot be loaded yet
+func (m *manager) addKeyPair(certFile, keyFile string) (*keyPair, error) {
+	if certFile == "" || keyFile == "" {
+		return nil, missingKeyPair
+	}
+	certFile, keyFile = filepath.Clean(certFile), filepath.Clean(keyFile)
+
+	m.mutex.Lock()
+	var pair *keyPair
+	for _, p := range m.pairs {
+		if p.certFile == certFile && p.keyFile == keyFile {
+			pair = p
+		}
+	}
+	if pair == nil {
+		pair = &keyPair{certFile: certFile, keyFile: keyFile}
+		m.pairs = append(m.pairs, pair)
+	}
+
+	var err error
+	for _, dir := range []string{filepath.Dir(certFile), filepath.Dir(keyFile)} {
+		if m.dirs[dir] {
+			continue
+		}
+		if err = m.watcher.Add(dir); err != nil {
+			break
+		}
+		m.dirs[dir] = true
+	}
+	m.mutex.Unlock()
+
+	if err != nil {
+		return pair, err
+	}
+	return pair, m.reload(pair)
+}
+
+// reload loads the files of the pair. The previous certificate is
+// kept if the files are invalid
+func (m *manager) reload(p *keyPair) error {
+	cert, err := tls.LoadX509KeyPair(p.certFile, p.keyFile)
+	if err != nil {
+		return err
+	}
+	if cert.Leaf, err = x509.ParseCertificate(cert.Certificate[0]); err != nil {
+		return err
+	}
+
+	m.mutex.Lock()
+	changed := p.cert == nil || !bytes.Equal(p.cert.Certificate[0], cert.Certificate[0])
+	p.cert = &cert
+	m.mutex.Unlock()
+
+	certificateExpiry.WithLabelValues(p.certFile).Set(float64(cert.Leaf.NotAfter.Unix()))
+	if changed {
+		log.Info().Msgf("loaded certificate %s for %v, valid until %v",
+			p.certFile,
+			cert.Leaf.DNSNames,
+			cert.Leaf.NotAfter,
+		)
+	}
+	return nil
+}
+
+// reloadDirs reloads every pair with a file in one of the directories
+func (m *manager) reloadDirs(dirs map[string]bool) {
+	m.mutex.RLock()
+	var pairs []*keyPair
+	for _, p := range m.pairs {
+		if dirs[filepath.Dir(p.certFile)] || dirs[filepath.Dir(p.keyFile)] {
+			pairs = append(pairs, p)
+		}
+	}
+	m.mutex.RUnlock()
+
+	for _, p := range pairs {
+		if err := m.reload(p); err != nil {
+			certificateReloadErrors.Inc()
+			log.Warn().Msgf("failed to reload certificate %s, keeping the previous certificate: %v", p.certFile, err)
+		}
+	}
+}
+
+// start reloads key pairs when their directories change until stop
+// is called
+func (m *manager) start() {
+	m.wg.Add(1)
+	go func() {
+		defer m.wg.Done()
+
+		changed := make(map[string]bool)
+		var reload <-chan time.Time
+		for {
+			select {
+			case <-m.done:
+				return
+			case event, ok := <-m.watcher.Events:
+				if !ok {
+					return
+				}
+				log.Debug().Msgf("certificate directory changed: %v", event)
+				changed[filepath.Dir(event.Name)] = true
+				reload = time.After(reloadDelay)
+			case err, ok := <-m.watcher.Errors:
+				if !ok {
+					return
+				}
+				log.Warn().Msgf("failed to watch certificates: %v", err)
+			case <-reload:
+				m.reloadDirs(changed)
+				changed = make(map[string]bool)
+				reload = nil
+			}
+		}
+	}()
+}
+
+func (m *manager) stop() {
+	close(m.done)
+	m.watcher.Close()
+	m.wg.Wait()
+}
+
+// getCertificate returns the certificate that is valid for the SNI.
+// The certificate of the listener is preferred and used for clients
+// without a matching SNI. The first loaded certificate is used if the
+// listener has none
+func (m *manager) getCertificate(hello *tls.ClientHelloInfo, listener *keyPair) (*tls.Certificate, error) {
+	name := strings.ToLower(strings.TrimSuffix(hello.ServerName, "."))
+
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	if name != "" {
+		if listener != nil && listener.cert != nil && listener.cert.Leaf.VerifyHostname(name) == nil {
+			return listener.cert, nil
+		}
+		for _, p := range m.pairs {
+			if p.cert != nil && p.cert.Leaf.VerifyHostname(name) == nil {
+				return p.cert, nil
+			}
+		}
+	}
+
+	if listener != nil && listener.cert != nil {
+		return listener.cert, nil
+	}
+	for _, p := range m.pairs {
+		if p.cert != nil {
+			return p.cert, nil
+		}
+	}
+	return nil, noCertificate
+}
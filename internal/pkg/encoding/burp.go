@@ -52,6 +52,10 @@ type DNSResultData struct {
 	Subdomain  string `json:"subDomain"`
 	Type       uint16 `json:"type"`
 	RawRequest string `json:"rawRequest"`
+	QueriedIP  string `json:"queriedIp,omitempty"`
+	Transport  string `json:"transport,omitempty"`
+	// HTTPRequest is the b64 encoded request of a DoH query
+	HTTPRequest string `json:"httpRequest,omitempty"`
 }
 
 // RawResultData will contain b64 encoded strings
@@ -129,16 +133,27 @@ func (m *BurpMarshaller) MarshalToJSON(data interface{}) ([]byte, error) {
 		return jsonData, error
 	case *DNSInput:
 		log.Debug().Msg("Got DNS Event")
+		interactionName := d.SubdomainQuestion
+		if d.InteractionName != "" {
+			interactionName = d.InteractionName
+		}
+		var httpRequest string
+		if len(d.HTTPRequest) > 0 {
+			httpRequest = base64.StdEncoding.EncodeToString(d.HTTPRequest)
+		}
 		jsonData, error := json.Marshal(&Response{
 			Protocol:      "dns",
 			OpCode:        strconv.Itoa(d.OpCode + 1), // Map to Burp OpCodes?
-			InteractionID: m.extractInteraction(strings.TrimSuffix(d.SubdomainQuestion, ".")),
+			InteractionID: m.extractInteraction(strings.TrimSuffix(interactionName, ".")),
 			ClientPart:    "0y",
 			Time:          fmt.Sprint(time.Now().UnixNano() / int64(time.Millisecond)), // Convert to unix
 			Data: DNSResultData{
-				Subdomain:  d.SubdomainQuestion,
-				Type:       d.RequestType,
-				RawRequest: base64.StdEncoding.EncodeToString([]byte(d.RawRequest)),
+				Subdomain:   d.SubdomainQuestion,
+				Type:        d.RequestType,
+				RawRequest:  base64.StdEncoding.EncodeToString([]byte(d.RawRequest)),
+				QueriedIP:   d.QueriedIP,
+				Transport:   d.Transport,
+				HTTPRequest: httpRequest,
 			},
 			ClientIP: RemovePortFromClientIP(d.ClientIP),
 		})
@@ -1,6 +1,7 @@
 package encoding
 
 import (
+	"encoding/json"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -42,3 +43,39 @@ func TestExtractInteraction(t *testing.T) {
 		assert.Equal(t, testCases[test].expected, bm.extractInteraction(testCases[test].input))
 	}
 }
+
+func TestMarshalDNSInteractionName(t *testing.T) {
+	bm := &BurpMarshaller{Ndots: 1}
+
+	data, err := bm.MarshalToJSON(&DNSInput{
+		SubdomainQuestion: "1.2.0.192.in-addr.arpa.",
+		InteractionName:   "c0000201.src.properties.",
+		QueriedIP:         "192.0.2.1",
+		ClientIP:          "127.0.0.1:53",
+	})
+	assert.NoError(t, err)
+
+	var response Response
+	assert.NoError(t, json.Unmarshal(data, &response))
+	assert.Equal(t, "c0000201", response.InteractionID)
+	assert.Equal(t, "192.0.2.1", response.Data.(map[string]interface{})["queriedIp"])
+	assert.Equal(t, "1.2.0.192.in-addr.arpa.", response.Data.(map[string]interface{})["subDomain"])
+}
+
+func TestMarshalDNSTransport(t *testing.T) {
+	bm := &BurpMarshaller{Ndots: 1}
+
+	data, err := bm.MarshalToJSON(&DNSInput{
+		SubdomainQuestion: "abc.src.properties.",
+		ClientIP:          "127.0.0.1:443",
+		Transport:         "doh",
+		HTTPRequest:       []byte("GET /dns-query HTTP/1.1\r\n\r\n"),
+	})
+	assert.NoError(t, err)
+
+	var response Response
+	assert.NoError(t, json.Unmarshal(data, &response))
+	assert.Equal(t, "127.0.0.1", response.ClientIP)
+	assert.Equal(t, "doh", response.Data.(map[string]interface{})["transport"])
+	assert.Equal(t, "R0VUIC9kbnMtcXVlcnkgSFRUUC8xLjENCg0K", response.Data.(map[string]interface{})["httpRequest"])
+}
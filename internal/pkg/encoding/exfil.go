@@ -0,0 +1,94 @@
+package encoding
+
+import (
+	"encoding/base32"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Supported exfil chunk encodings
+const (
+	ExfilHex    = "hex"
+	ExfilBase32 = "base32"
+)
+
+// ExfilChunk is a single chunk of data exfiltrated in a DNS label
+type ExfilChunk struct {
+	Sequence int
+	Data     string
+}
+
+// exfilBase32 is the RFC 4648 alphabet without padding, since '='
+// is not valid in a hostname label
+var exfilBase32 = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// OrderExfilChunks sorts chunks by sequence and returns the
+// concatenated data along with any sequence numbers that have
+// not been received yet
+func OrderExfilChunks(chunks []ExfilChunk) (string, []int) {
+	ordered := make([]ExfilChunk, len(chunks))
+	copy(ordered, chunks)
+	sort.Slice(ordered, func(i, j int) bool {
+		return ordered[i].Sequence < ordered[j].Sequence
+	})
+
+	var data strings.Builder
+	missing := []int{}
+	next := 0
+	if len(ordered) > 0 && ordered[0].Sequence == 1 {
+		next = 1 // allow sequences that start at 1
+	}
+
+	for _, c := range ordered {
+		for ; next < c.Sequence; next++ {
+			missing = append(missing, next)
+		}
+		data.WriteString(c.Data)
+		next = c.Sequence + 1
+	}
+
+	return data.String(), missing
+}
+
+// DecodeExfil reassembles the chunks and decodes the payload. Hex is
+// preferred when the data is valid for both encodings. The encoding
+// that was used is returned with the decoded data
+func DecodeExfil(chunks []ExfilChunk) ([]byte, string, error) {
+	data, _ := OrderExfilChunks(chunks)
+	data = strings.ToLower(data)
+
+	if data == "" {
+		return []byte{}, "", fmt.Errorf("no exfil data to decode")
+	}
+
+	if decoded, err := hex.DecodeString(data); err == nil {
+		return decoded, ExfilHex, nil
+	}
+
+	decoded, err := exfilBase32.DecodeString(strings.ToUpper(strings.TrimRight(data, "=")))
+	if err != nil {
+		return []byte{}, "", fmt.Errorf("exfil data is not valid hex or base32")
+	}
+
+	return decoded, ExfilBase32, nil
+}
+
+// IsExfilChunk reports whether the label only contains characters
+// from the hex or base32 alphabets
+func IsExfilChunk(label string) bool {
+	if label == "" {
+		return false
+	}
+
+	for _, c := range strings.ToLower(label) {
+		switch {
+		case c >= 'a' && c <= 'z':
+		case c >= '0' && c <= '9':
+		default:
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,69 @@
+package encoding
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOrderExfilChunks(t *testing.T) {
+	data, missing := OrderExfilChunks([]ExfilChunk{
+		{Sequence: 2, Data: "cc"},
+		{Sequence: 0, Data: "aa"},
+		{Sequence: 4, Data: "ee"},
+	})
+	assert.Equal(t, "aaccee", data)
+	assert.Equal(t, []int{1, 3}, missing)
+
+	data, missing = OrderExfilChunks([]ExfilChunk{
+		{Sequence: 2, Data: "bb"},
+		{Sequence: 1, Data: "aa"},
+	})
+	assert.Equal(t, "aabb", data)
+	assert.Empty(t, missing)
+}
+
+func TestDecodeExfil(t *testing.T) {
+	testCases := []struct {
+		input    []ExfilChunk
+		expected string
+		encoding string
+	}{
+		{
+			[]ExfilChunk{{1, "6f6f"}, {0, "666f"}},
+			"fooo",
+			ExfilHex,
+		},
+		{
+			// base32("root:x:0:0") split across labels
+			[]ExfilChunk{{0, "OJXW"}, {1, "65B2"}, {2, "PA5DAORQ"}},
+			"root:x:0:0",
+			ExfilBase32,
+		},
+		{
+			[]ExfilChunk{{0, "nzxxi"}},
+			"not",
+			ExfilBase32,
+		},
+	}
+
+	for _, tc := range testCases {
+		data, enc, err := DecodeExfil(tc.input)
+		assert.NoError(t, err)
+		assert.Equal(t, tc.expected, string(data))
+		assert.Equal(t, tc.encoding, enc)
+	}
+
+	_, _, err := DecodeExfil([]ExfilChunk{{0, "1"}})
+	assert.Error(t, err)
+
+	_, _, err = DecodeExfil([]ExfilChunk{})
+	assert.Error(t, err)
+}
+
+func TestIsExfilChunk(t *testing.T) {
+	assert.True(t, IsExfilChunk("MFRGG"))
+	assert.True(t, IsExfilChunk("deadbeef"))
+	assert.False(t, IsExfilChunk("dead-beef"))
+	assert.False(t, IsExfilChunk(""))
+}
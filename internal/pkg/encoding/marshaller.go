@@ -41,6 +41,12 @@ type DNSInput struct {
 	Answer            string
 	ClientIP          string
 	OpCode            int
+	// InteractionName is used to extract the interaction ID instead
+	// of SubdomainQuestion, e.g. the PTR answer of a reverse lookup
+	InteractionName string
+	QueriedIP       string // address of a reverse lookup
+	Transport       string // udp, tcp or doh
+	HTTPRequest     []byte // DoH request in wire format
 }
 
 // RawInput is used as a generic input to the marshaller
@@ -3,33 +3,171 @@ package apiv1
 import (
 	"encoding/base64"
 	"fmt"
+	"io/ioutil"
+	"mime/multipart"
+	"net/http"
+	"strconv"
+	"time"
 
 	"github.com/labstack/echo/v4"
+	"github.com/tmoneypenny/conspirator/internal/pkg/http/routes"
 )
 
-// addRouteOutput is returned to addRoute to construct
-// a new exploit page
-type addRouteOutput struct {
-	Methods  []string
-	Endpoint string
-	Headers  map[string]string
-	Body     string
-}
-
-func parseAddRouteInput(c echo.Context) (*addRouteOutput, error) {
+// parseAddRouteInput returns the route to add from the base64
+// encoded form fields. An uploaded bodyFile replaces the body
+func parseAddRouteInput(c echo.Context) (*routes.Route, error) {
 	url := c.FormValue("urlPath")
 	methods, _ := base64.StdEncoding.DecodeString(c.FormValue("methods"))
 	headers, _ := base64.StdEncoding.DecodeString(c.FormValue("headers"))
-	body, _ := base64.StdEncoding.DecodeString(c.FormValue("body"))
+	body, err := base64.StdEncoding.DecodeString(c.FormValue("body"))
+	if err != nil {
+		return nil, fmt.Errorf("body must be base64 encoded")
+	}
 
-	if methods == nil || headers == nil || body == nil || url == "" {
+	if methods == nil || headers == nil || url == "" {
 		return nil, fmt.Errorf("form fields cannot be null")
 	}
 
-	return &addRouteOutput{
+	if file, err := c.FormFile("bodyFile"); err == nil {
+		if body, err = readFormFile(file); err != nil {
+			return nil, err
+		}
+	} else if err != http.ErrMissingFile && err != http.ErrNotMultipart {
+		return nil, err
+	}
+
+	status := http.StatusOK
+	if v := c.FormValue("status"); v != "" {
+		if status, err = strconv.Atoi(v); err != nil {
+			return nil, fmt.Errorf("status must be a number")
+		}
+	}
+
+	redirect, err := parseRedirectInput(c)
+	if err != nil {
+		return nil, err
+	}
+
+	proxy, err := parseProxyInput(c)
+	if err != nil {
+		return nil, err
+	}
+
+	tmpl := false
+	if v := c.FormValue("template"); v != "" {
+		if tmpl, err = strconv.ParseBool(v); err != nil {
+			return nil, fmt.Errorf("template must be a boolean")
+		}
+	}
+
+	maxHits := 0
+	if v := c.FormValue("maxHits"); v != "" {
+		if maxHits, err = strconv.Atoi(v); err != nil {
+			return nil, fmt.Errorf("maxHits must be a number")
+		}
+	}
+
+	expires, err := parseExpires(c.FormValue("expires"), time.Now())
+	if err != nil {
+		return nil, err
+	}
+
+	match := c.FormValue("match")
+	return &routes.Route{
+		Host:     c.FormValue("host"),
+		Path:     parsePath(url, match),
+		Match:    match,
 		Methods:  parseMethods(methods),
-		Endpoint: parseUrl(url),
 		Headers:  parseHeaders(string(headers)),
-		Body:     string(body),
+		Body:     body,
+		Status:   status,
+		Redirect: redirect,
+		Proxy:    proxy,
+		Template: tmpl,
+		MaxHits:  maxHits,
+		Expires:  expires,
 	}, nil
 }
+
+// parseProxyInput returns the proxy of the route or nil if the
+// proxyUpstream is unset
+func parseProxyInput(c echo.Context) (*routes.Proxy, error) {
+	upstream := c.FormValue("proxyUpstream")
+	if upstream == "" {
+		return nil, nil
+	}
+
+	headers, err := base64.StdEncoding.DecodeString(c.FormValue("proxyHeaders"))
+	if err != nil {
+		return nil, fmt.Errorf("proxyHeaders must be base64 encoded")
+	}
+
+	p := &routes.Proxy{Upstream: upstream, Headers: parseHeaders(string(headers))}
+	if v := c.FormValue("proxyPreserveHost"); v != "" {
+		if p.PreserveHost, err = strconv.ParseBool(v); err != nil {
+			return nil, fmt.Errorf("proxyPreserveHost must be a boolean")
+		}
+	}
+
+	return p, nil
+}
+
+// parseExpires returns the expiry of a route from a duration after
+// now, e.g. 10m, or an RFC 3339 time. An empty value never expires
+func parseExpires(v string, now time.Time) (*time.Time, error) {
+	if v == "" {
+		return nil, nil
+	}
+
+	if d, err := time.ParseDuration(v); err == nil {
+		expires := now.Add(d)
+		return &expires, nil
+	}
+
+	expires, err := time.Parse(time.RFC3339, v)
+	if err != nil {
+		return nil, fmt.Errorf("expires must be a duration or an RFC 3339 time")
+	}
+	return &expires, nil
+}
+
+// parseRedirectInput returns the redirect of the route or nil if the
+// redirectTarget is unset
+func parseRedirectInput(c echo.Context) (*routes.Redirect, error) {
+	target := c.FormValue("redirectTarget")
+	if target == "" {
+		return nil, nil
+	}
+	r := &routes.Redirect{Target: target}
+
+	var err error
+	for field, n := range map[string]*int{
+		"redirectStatus": &r.Status,
+		"redirectHops":   &r.Hops,
+		"redirectAfter":  &r.After,
+	} {
+		if v := c.FormValue(field); v != "" {
+			if *n, err = strconv.Atoi(v); err != nil {
+				return nil, fmt.Errorf("%s must be a number", field)
+			}
+		}
+	}
+	if v := c.FormValue("redirectPerClient"); v != "" {
+		if r.PerClient, err = strconv.ParseBool(v); err != nil {
+			return nil, fmt.Errorf("redirectPerClient must be a boolean")
+		}
+	}
+
+	return r, nil
+}
+
+// readFormFile returns the content of the uploaded file
+func readFormFile(fh *multipart.FileHeader) ([]byte, error) {
+	f, err := fh.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return ioutil.ReadAll(f)
+}
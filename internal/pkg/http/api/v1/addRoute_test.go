@@ -0,0 +1,60 @@
+package apiv1
+
+import (
+	"bytes"
+	"encoding/base64"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/tmoneypenny/conspirator/internal/pkg/http/routes"
+)
+
+func TestParseAddRouteInput(t *testing.T) {
+	var buf bytes.Buffer
+	w := multipart.NewWriter(&buf)
+	for k, v := range map[string]string{
+		"urlPath": "/image.png",
+		"methods": base64.StdEncoding.EncodeToString([]byte("GET,POST")),
+		"headers": base64.StdEncoding.EncodeToString([]byte("Content-Type: image/png\r\nX-Test:  a:b \r\n")),
+		"body":    base64.StdEncoding.EncodeToString([]byte("replaced")),
+		"status":  "401",
+	} {
+		assert.NoError(t, w.WriteField(k, v))
+	}
+	f, err := w.CreateFormFile("bodyFile", "image.png")
+	assert.NoError(t, err)
+	f.Write([]byte{0x89, 'P', 'N', 'G', 0x00})
+	assert.NoError(t, w.Close())
+
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/addRoute", &buf)
+	req.Header.Set("Content-Type", w.FormDataContentType())
+	r, err := parseAddRouteInput(echo.New().NewContext(req, httptest.NewRecorder()))
+	assert.NoError(t, err)
+
+	assert.Equal(t, &routes.Route{
+		Path:    "/image.png",
+		Methods: []string{"GET", "POST"},
+		Headers: map[string]string{"Content-Type": "image/png", "X-Test": "a:b"},
+		Body:    []byte{0x89, 'P', 'N', 'G', 0x00},
+		Status:  http.StatusUnauthorized,
+	}, r)
+}
+
+func TestParseExpires(t *testing.T) {
+	now := time.Now()
+	expires, err := parseExpires("10m", now)
+	assert.NoError(t, err)
+	assert.Equal(t, now.Add(10*time.Minute), *expires)
+
+	expires, err = parseExpires("2030-01-02T15:04:05Z", now)
+	assert.NoError(t, err)
+	assert.Equal(t, 2030, expires.Year())
+
+	_, err = parseExpires("tomorrow", now)
+	assert.Error(t, err)
+}
@@ -1,26 +1,21 @@
 package apiv1
 
 import (
-	"crypto/md5"
+	"encoding/json"
 	"fmt"
 	"net/http"
-	"strings"
+	"strconv"
 
 	"github.com/labstack/echo/v4"
 	"github.com/labstack/echo/v4/middleware"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/rs/zerolog/log"
+	"github.com/tmoneypenny/conspirator/internal/pkg/bind"
 	_ "github.com/tmoneypenny/conspirator/internal/pkg/http/api/v1/docs"
 	auth "github.com/tmoneypenny/conspirator/internal/pkg/http/middleware"
+	"github.com/tmoneypenny/conspirator/internal/pkg/http/routes"
 )
 
-//customRoutes []customRouteInfo
-var customRoutes = make(map[string]map[string]string) // endpoint: Method: content-type?
-
-type customRouteInfo struct {
-	//Path    string
-	Method string
-}
-
 // @title API
 // @description Provides an API for interacting with the server
 // @license.name Apache 2.0
@@ -32,8 +27,9 @@ type customRouteInfo struct {
 // @name Authorization
 // @scope.admin
 
-// Router defines a new subRouter for the API version
-func Router(s *echo.Echo) {
+// Router defines a new subRouter for the API version. Custom routes
+// saved in routesFile are restored and served by the catch-all route
+func Router(s *echo.Echo, routesFile string) {
 	s.Pre(middleware.Rewrite(map[string]string{
 		"/metrics":        "/api/v1/metrics",
 		"/api/v1/healthz": "/healthz",
@@ -52,38 +48,62 @@ func Router(s *echo.Echo) {
 
 	apiV1.GET("/metrics", echo.WrapHandler(promhttp.Handler()))
 
-	apiV1.POST("/addRoute", func(c echo.Context) (err error) {
-		addRoute(s, c, "s")
-		return
-	})
+	if err := routes.Restore(routesFile); err != nil {
+		log.Error().Msgf("failed to restore custom routes from %s: %v", routesFile, err)
+	}
 
-	apiV1.POST("/deleteRoute", func(c echo.Context) (err error) {
-		deleteRoute(s, c, "s")
-		return
-	})
+	apiV1.POST("/addRoute", addRoute)
+	apiV1.POST("/deleteRoute", deleteRoute)
+	apiV1.GET("/showRoutes", showRoutes)
+	apiV1.GET("/exportRoutes", exportRoutes)
+	apiV1.POST("/importRoutes", importRoutes)
 
-	apiV1.GET("/showRoutes", func(c echo.Context) (err error) {
-		showRoutes(s, c, "s")
-		return
-	})
+	apiV1.GET("/showExfil", showExfil)
+	apiV1.POST("/deleteExfil", deleteExfil)
+
+	apiV1.POST("/addStage", addStage)
+	apiV1.POST("/deleteStage", deleteStage)
+	apiV1.GET("/showStages", showStages)
+
+	apiV1.POST("/addRecord", addRecord)
+	apiV1.POST("/deleteRecord", deleteRecord)
+
+	apiV1.POST("/addPolicy", addPolicy)
+	apiV1.POST("/deletePolicy", deletePolicy)
+	apiV1.GET("/showPolicies", showPolicies)
 }
 
 // metrics godoc
 // @Summary Add route
-// @Description add a new route
+// @Description add a new route. The body is served unchanged with a Content-Length of its size and the Content-Type header, or the Content-Type detected from the body if it is unset
 // @Tags routes
 // @Accept mpfd
 // @Param urlPath formData string true "absolute URL path, e.g. /test or /test.jpg"
+// @Param match formData string false "how urlPath matches request paths: exact (default), prefix, glob, e.g. /*.js or /static/**, or regex, e.g. ^/u/(?P<id>[0-9]+)$. Captured groups are available to templates"
+// @Param host formData string false "only serve the route for the host, e.g. a.test.example.com, or its subdomains, e.g. *.xxe.test.example.com"
 // @Param methods formData string true "list of b64 encoded HTTP methods, e.g. GET,POST,PUT"
 // @Param headers formData string true "list of b64 encoded headers separated by \r\n"
-// @Param body formData string true "base64 encoded body"
+// @Param body formData string false "base64 encoded body"
+// @Param bodyFile formData file false "raw body, replaces body, e.g. an image or a serialized object"
+// @Param status formData int false "HTTP status code between 200 and 599, defaults to 200"
+// @Param template formData bool false "render the body as a Go text/template with the request, e.g. {{ .ClientIP }} or {{ .Headers.Get \"User-Agent\" }}"
+// @Param maxHits formData int false "serve the route to the first requests only, then the default response"
+// @Param expires formData string false "serve the default response after a duration, e.g. 10m, or an RFC 3339 time"
+// @Param proxyUpstream formData string false "forward requests to the http or https URL instead of serving the body, e.g. http://127.0.0.1:8000. Route headers are set on the response, an empty value removes a header"
+// @Param proxyHeaders formData string false "b64 encoded headers set on the upstream request separated by \r\n, an empty value removes a header"
+// @Param proxyPreserveHost formData bool false "forward the Host of the request instead of the upstream host"
+// @Param redirectTarget formData string false "redirect requests to the URL instead of serving the body, e.g. http://169.254.169.254/ or gopher://127.0.0.1:6379/_INFO"
+// @Param redirectStatus formData int false "301, 302, 303, 307 or 308, defaults to 302"
+// @Param redirectHops formData int false "redirects through the route with an increasing conspirator_hop query parameter before the target, up to 20"
+// @Param redirectAfter formData int false "serve the body to the first requests and redirect the following requests"
+// @Param redirectPerClient formData bool false "count redirectAfter requests for each client address"
 // @Produce json
 // @Success 200 {object} string "OK"
 // @Failure 401 {string} string "Invalid Token"
 // @Failure 500 {string} string "Internal Server Error"
 // @security AuthToken
 // @Router /addRoute [post]
-func addRoute(t *echo.Echo, c echo.Context, s string) error {
+func addRoute(c echo.Context) error {
 	r, err := parseAddRouteInput(c)
 	if err != nil {
 		return c.JSON(http.StatusInternalServerError, map[string]interface{}{
@@ -91,27 +111,9 @@ func addRoute(t *echo.Echo, c echo.Context, s string) error {
 		})
 	}
 
-	// default content-type to use if unset
-	contentType := "text/html"
-	if _, ok := customRoutes[r.Endpoint]; !ok {
-		customRoutes[r.Endpoint] = make(map[string]string)
-	}
-
-	for m := range r.Methods {
-		for k, v := range r.Headers {
-			if strings.EqualFold(k, "content-type") {
-				contentType = v
-			}
-		}
-
-		customRoutes[r.Endpoint][r.Methods[m]] = contentType
-
-		t.Router().Add(r.Methods[m], r.Endpoint, func(c echo.Context) (err error) {
-			for h, v := range r.Headers {
-				c.Response().Header().Add(h, v)
-			}
-
-			return c.HTML(http.StatusOK, r.Body)
+	if err := routes.Add(r); err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]interface{}{
+			"status": fmt.Sprint(err),
 		})
 	}
 
@@ -126,6 +128,8 @@ func addRoute(t *echo.Echo, c echo.Context, s string) error {
 // @Tags routes
 // @Accept mpfd
 // @Param urlPath formData string true "absolute URL path, e.g. /test or /test.jpg"
+// @Param host formData string false "host of the route, if it was added for a host"
+// @Param match formData string false "match of the route, if it was added with a match other than exact"
 // @Param methods formData string true "list of b64 encoded HTTP methods, e.g. GET,POST,PUT"
 // @Produce json
 // @Success 200 {object} string "OK"
@@ -133,7 +137,7 @@ func addRoute(t *echo.Echo, c echo.Context, s string) error {
 // @Failure 500 {string} string "Internal Server Error"
 // @security AuthToken
 // @Router /deleteRoute [post]
-func deleteRoute(t *echo.Echo, c echo.Context, s string) error {
+func deleteRoute(c echo.Context) error {
 	r, err := parseDelRouteInput(c)
 	if err != nil {
 		return c.JSON(http.StatusInternalServerError, map[string]interface{}{
@@ -141,18 +145,9 @@ func deleteRoute(t *echo.Echo, c echo.Context, s string) error {
 		})
 	}
 
-	for m := range r.Methods {
-		if len(customRoutes[r.Endpoint]) > 1 {
-			delete(customRoutes[r.Endpoint], r.Methods[m])
-		} else {
-			delete(customRoutes, r.Endpoint)
-		}
-
-		t.Router().Add(r.Methods[m], r.Endpoint, func(c echo.Context) (err error) {
-			return c.HTML(http.StatusOK,
-				"<html><body>"+
-					fmt.Sprintf("%x", md5.Sum([]byte(c.Request().Host)))+
-					"</body></html>")
+	if err := routes.Remove(r.Host, r.Match, r.Endpoint, r.Methods); err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]interface{}{
+			"status": fmt.Sprint(err),
 		})
 	}
 
@@ -163,7 +158,7 @@ func deleteRoute(t *echo.Echo, c echo.Context, s string) error {
 
 // metrics godoc
 // @Summary Show routes
-// @Description show all added routes
+// @Description show all added routes with the requests served by each route
 // @Tags routes
 // @Accept mpfd
 // @Produce json
@@ -172,9 +167,128 @@ func deleteRoute(t *echo.Echo, c echo.Context, s string) error {
 // @Failure 500 {string} string "Internal Server Error"
 // @security AuthToken
 // @Router /showRoutes [get]
-func showRoutes(t *echo.Echo, c echo.Context, s string) error {
+func showRoutes(c echo.Context) error {
 	return c.JSON(http.StatusOK, map[string]interface{}{
-		"Routes": customRoutes,
+		"Routes": routes.List(),
+	})
+}
+
+// metrics godoc
+// @Summary Export routes
+// @Description download all custom routes as JSON for importRoutes. Bodies are base64 encoded
+// @Tags routes
+// @Accept */*
+// @Produce json
+// @Success 200 {array} routes.Route
+// @Failure 401 {string} string "Invalid Token"
+// @security AuthToken
+// @Router /exportRoutes [get]
+func exportRoutes(c echo.Context) error {
+	c.Response().Header().Set(echo.HeaderContentDisposition, `attachment; filename="routes.json"`)
+	return c.JSONPretty(http.StatusOK, routes.List(), "    ")
+}
+
+// metrics godoc
+// @Summary Import routes
+// @Description add custom routes exported by exportRoutes. Routes overwrite existing routes at the same path and method
+// @Tags routes
+// @Accept json
+// @Param routes body []routes.Route true "routes to add"
+// @Param replace query bool false "remove all existing routes first"
+// @Produce json
+// @Success 200 {object} string "OK"
+// @Failure 401 {string} string "Invalid Token"
+// @Failure 500 {string} string "Internal Server Error"
+// @security AuthToken
+// @Router /importRoutes [post]
+func importRoutes(c echo.Context) error {
+	var imported []*routes.Route
+	if err := json.NewDecoder(c.Request().Body).Decode(&imported); err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]interface{}{
+			"status": fmt.Sprint(err),
+		})
+	}
+
+	replace := false
+	if v := c.QueryParam("replace"); v != "" {
+		var err error
+		if replace, err = strconv.ParseBool(v); err != nil {
+			return c.JSON(http.StatusInternalServerError, map[string]interface{}{
+				"status": "replace must be a boolean",
+			})
+		}
+	}
+
+	var err error
+	if replace {
+		err = routes.Replace(imported...)
+	} else {
+		err = routes.Add(imported...)
+	}
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]interface{}{
+			"status": fmt.Sprint(err),
+		})
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"status": "OK",
+	})
+}
+
+// metrics godoc
+// @Summary Show exfil
+// @Description show DNS exfil payloads reassembled from <seq>.<chunk>.<id> names
+// @Tags exfil
+// @Accept */*
+// @Param interactionId query string false "only show the payload for this interaction ID"
+// @Produce json
+// @Success 200 {object} string "OK"
+// @Failure 401 {string} string "Invalid Token"
+// @Failure 404 {string} string "Not Found"
+// @security AuthToken
+// @Router /showExfil [get]
+func showExfil(c echo.Context) error {
+	if id := c.QueryParam("interactionId"); id != "" {
+		payload, found := bind.GetExfil(id)
+		if !found {
+			return c.JSON(http.StatusNotFound, map[string]interface{}{
+				"status": "interaction ID not found",
+			})
+		}
+		return c.JSON(http.StatusOK, map[string]interface{}{
+			"Exfil": []*bind.ExfilPayload{payload},
+		})
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"Exfil": bind.ListExfil(),
+	})
+}
+
+// metrics godoc
+// @Summary Delete exfil
+// @Description remove all DNS exfil chunks received for an interaction ID
+// @Tags exfil
+// @Accept mpfd
+// @Param interactionId formData string true "interaction ID of the exfil payload"
+// @Produce json
+// @Success 200 {object} string "OK"
+// @Failure 401 {string} string "Invalid Token"
+// @Failure 500 {string} string "Internal Server Error"
+// @security AuthToken
+// @Router /deleteExfil [post]
+func deleteExfil(c echo.Context) error {
+	id := c.FormValue("interactionId")
+	if id == "" {
+		return c.JSON(http.StatusInternalServerError, map[string]interface{}{
+			"status": "form fields cannot be null",
+		})
+	}
+
+	bind.DeleteExfil(id)
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"status": "OK",
 	})
 }
 
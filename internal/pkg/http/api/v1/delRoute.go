@@ -10,6 +10,8 @@ import (
 type deleteRouteOutput struct {
 	Methods  []string
 	Endpoint string
+	Host     string
+	Match    string
 }
 
 func parseDelRouteInput(c echo.Context) (*deleteRouteOutput, error) {
@@ -20,8 +22,11 @@ func parseDelRouteInput(c echo.Context) (*deleteRouteOutput, error) {
 		return nil, fmt.Errorf("form fields cannot be null")
 	}
 
+	match := c.FormValue("match")
 	return &deleteRouteOutput{
 		Methods:  parseMethods(methods),
-		Endpoint: parseUrl(url),
+		Endpoint: parsePath(url, match),
+		Host:     c.FormValue("host"),
+		Match:    match,
 	}, nil
 }
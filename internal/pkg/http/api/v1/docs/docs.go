@@ -28,6 +28,222 @@ var doc = `{
     "host": "{{.Host}}",
     "basePath": "{{.BasePath}}",
     "paths": {
+        "/addPolicy": {
+            "post": {
+                "security": [
+                    {
+                        "AuthToken": []
+                    }
+                ],
+                "description": "add or replace a DNS response policy. Policies are evaluated by priority before records and default answers, and the first match decides the response",
+                "consumes": [
+                    "multipart/form-data"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "policies"
+                ],
+                "summary": "Add policy",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "ID of the policy to replace",
+                        "name": "id",
+                        "in": "formData"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "lower priorities are evaluated first",
+                        "name": "priority",
+                        "in": "formData"
+                    },
+                    {
+                        "type": "array",
+                        "items": {
+                            "type": "string"
+                        },
+                        "collectionFormat": "multi",
+                        "description": "source or EDNS client subnet CIDRs to match, repeat for multiple",
+                        "name": "clientCidrs",
+                        "in": "formData"
+                    },
+                    {
+                        "type": "array",
+                        "items": {
+                            "type": "string"
+                        },
+                        "collectionFormat": "multi",
+                        "description": "question types to match, e.g. A, repeat for multiple",
+                        "name": "qtypes",
+                        "in": "formData"
+                    },
+                    {
+                        "type": "string",
+                        "description": "glob to match the question name, e.g. *.test.example.com",
+                        "name": "namePattern",
+                        "in": "formData"
+                    },
+                    {
+                        "type": "string",
+                        "description": "RFC3339 time the policy starts to match",
+                        "name": "notBefore",
+                        "in": "formData"
+                    },
+                    {
+                        "type": "string",
+                        "description": "RFC3339 time the policy stops matching",
+                        "name": "notAfter",
+                        "in": "formData"
+                    },
+                    {
+                        "type": "string",
+                        "description": "answer, nxdomain, refused or servfail",
+                        "name": "action",
+                        "in": "formData",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "record type of the answer, e.g. A",
+                        "name": "recordType",
+                        "in": "formData"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "TTL of the answer",
+                        "name": "ttl",
+                        "in": "formData"
+                    },
+                    {
+                        "type": "array",
+                        "items": {
+                            "type": "string"
+                        },
+                        "collectionFormat": "multi",
+                        "description": "answer values in the same format as records, repeat for multiple",
+                        "name": "value",
+                        "in": "formData"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "401": {
+                        "description": "Invalid Token",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/addRecord": {
+            "post": {
+                "security": [
+                    {
+                        "AuthToken": []
+                    }
+                ],
+                "description": "add or replace the DNS records of a type at a name. Shaping fields change how answers are sent, e.g. to tell UDP and TCP fetchers apart. Without a recordType only the shaping is stored and applies to every answer for the name",
+                "consumes": [
+                    "multipart/form-data"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "records"
+                ],
+                "summary": "Add record",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "name of the record, e.g. a.test.example.com",
+                        "name": "fqdn",
+                        "in": "formData",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "record type, e.g. A",
+                        "name": "recordType",
+                        "in": "formData"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "TTL of the records",
+                        "name": "ttl",
+                        "in": "formData"
+                    },
+                    {
+                        "type": "array",
+                        "items": {
+                            "type": "string"
+                        },
+                        "collectionFormat": "multi",
+                        "description": "record values, repeat for multiple",
+                        "name": "value",
+                        "in": "formData"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "milliseconds to wait before answering, up to 30000",
+                        "name": "delay",
+                        "in": "formData"
+                    },
+                    {
+                        "type": "boolean",
+                        "description": "set the TC bit on UDP answers so that resolvers retry over TCP",
+                        "name": "truncate",
+                        "in": "formData"
+                    },
+                    {
+                        "type": "string",
+                        "description": "answer with the rcode instead of the records, e.g. SERVFAIL, REFUSED or NXDOMAIN",
+                        "name": "rcode",
+                        "in": "formData"
+                    },
+                    {
+                        "type": "boolean",
+                        "description": "do not answer queries",
+                        "name": "drop",
+                        "in": "formData"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "401": {
+                        "description": "Invalid Token",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
         "/addRoute": {
             "post": {
                 "security": [
@@ -35,7 +251,381 @@ var doc = `{
                         "AuthToken": []
                     }
                 ],
-                "description": "add a new route",
+                "description": "add a new route. The body is served unchanged with a Content-Length of its size and the Content-Type header, or the Content-Type detected from the body if it is unset",
+                "consumes": [
+                    "multipart/form-data"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "routes"
+                ],
+                "summary": "Add route",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "absolute URL path, e.g. /test or /test.jpg",
+                        "name": "urlPath",
+                        "in": "formData",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "how urlPath matches request paths: exact (default), prefix, glob, e.g. /*.js or /static/**, or regex, e.g. ^/u/(?P\u003cid\u003e[0-9]+)$. Captured groups are available to templates",
+                        "name": "match",
+                        "in": "formData"
+                    },
+                    {
+                        "type": "string",
+                        "description": "only serve the route for the host, e.g. a.test.example.com, or its subdomains, e.g. *.xxe.test.example.com",
+                        "name": "host",
+                        "in": "formData"
+                    },
+                    {
+                        "type": "string",
+                        "description": "list of b64 encoded HTTP methods, e.g. GET,POST,PUT",
+                        "name": "methods",
+                        "in": "formData",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "list of b64 encoded headers separated by \\r\\n",
+                        "name": "headers",
+                        "in": "formData",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "base64 encoded body",
+                        "name": "body",
+                        "in": "formData"
+                    },
+                    {
+                        "type": "file",
+                        "description": "raw body, replaces body, e.g. an image or a serialized object",
+                        "name": "bodyFile",
+                        "in": "formData"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "HTTP status code between 200 and 599, defaults to 200",
+                        "name": "status",
+                        "in": "formData"
+                    },
+                    {
+                        "type": "boolean",
+                        "description": "render the body as a Go text/template with the request, e.g. {{ .ClientIP }} or {{ .Headers.Get \\",
+                        "name": "template",
+                        "in": "formData"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "serve the route to the first requests only, then the default response",
+                        "name": "maxHits",
+                        "in": "formData"
+                    },
+                    {
+                        "type": "string",
+                        "description": "serve the default response after a duration, e.g. 10m, or an RFC 3339 time",
+                        "name": "expires",
+                        "in": "formData"
+                    },
+                    {
+                        "type": "string",
+                        "description": "forward requests to the http or https URL instead of serving the body, e.g. http://127.0.0.1:8000. Route headers are set on the response, an empty value removes a header",
+                        "name": "proxyUpstream",
+                        "in": "formData"
+                    },
+                    {
+                        "type": "string",
+                        "description": "b64 encoded headers set on the upstream request separated by \\r\\n, an empty value removes a header",
+                        "name": "proxyHeaders",
+                        "in": "formData"
+                    },
+                    {
+                        "type": "boolean",
+                        "description": "forward the Host of the request instead of the upstream host",
+                        "name": "proxyPreserveHost",
+                        "in": "formData"
+                    },
+                    {
+                        "type": "string",
+                        "description": "redirect requests to the URL instead of serving the body, e.g. http://169.254.169.254/ or gopher://127.0.0.1:6379/_INFO",
+                        "name": "redirectTarget",
+                        "in": "formData"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "301, 302, 303, 307 or 308, defaults to 302",
+                        "name": "redirectStatus",
+                        "in": "formData"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "redirects through the route with an increasing conspirator_hop query parameter before the target, up to 20",
+                        "name": "redirectHops",
+                        "in": "formData"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "serve the body to the first requests and redirect the following requests",
+                        "name": "redirectAfter",
+                        "in": "formData"
+                    },
+                    {
+                        "type": "boolean",
+                        "description": "count redirectAfter requests for each client address",
+                        "name": "redirectPerClient",
+                        "in": "formData"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "401": {
+                        "description": "Invalid Token",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/addStage": {
+            "post": {
+                "security": [
+                    {
+                        "AuthToken": []
+                    }
+                ],
+                "description": "stage a file for delivery as base64 chunks in TXT answers at \u003cindex\u003e.\u003cfqdn\u003e, with a manifest at \u003cfqdn\u003e",
+                "consumes": [
+                    "multipart/form-data"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "staging"
+                ],
+                "summary": "Add stage",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "name to serve the payload under, e.g. payload.test.example.com",
+                        "name": "fqdn",
+                        "in": "formData",
+                        "required": true
+                    },
+                    {
+                        "type": "file",
+                        "description": "file to stage",
+                        "name": "file",
+                        "in": "formData",
+                        "required": true
+                    },
+                    {
+                        "type": "integer",
+                        "description": "raw bytes per chunk, a multiple of 3 up to 189",
+                        "name": "chunkSize",
+                        "in": "formData"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "401": {
+                        "description": "Invalid Token",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/deleteExfil": {
+            "post": {
+                "security": [
+                    {
+                        "AuthToken": []
+                    }
+                ],
+                "description": "remove all DNS exfil chunks received for an interaction ID",
+                "consumes": [
+                    "multipart/form-data"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "exfil"
+                ],
+                "summary": "Delete exfil",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "interaction ID of the exfil payload",
+                        "name": "interactionId",
+                        "in": "formData",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "401": {
+                        "description": "Invalid Token",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/deletePolicy": {
+            "post": {
+                "security": [
+                    {
+                        "AuthToken": []
+                    }
+                ],
+                "description": "remove a DNS response policy",
+                "consumes": [
+                    "multipart/form-data"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "policies"
+                ],
+                "summary": "Delete policy",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "ID of the policy",
+                        "name": "id",
+                        "in": "formData",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "401": {
+                        "description": "Invalid Token",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/deleteRecord": {
+            "post": {
+                "security": [
+                    {
+                        "AuthToken": []
+                    }
+                ],
+                "description": "remove the DNS records and shaping of a name",
+                "consumes": [
+                    "multipart/form-data"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "records"
+                ],
+                "summary": "Delete record",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "name of the record",
+                        "name": "fqdn",
+                        "in": "formData",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "401": {
+                        "description": "Invalid Token",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/deleteRoute": {
+            "post": {
+                "security": [
+                    {
+                        "AuthToken": []
+                    }
+                ],
+                "description": "resets a route to default",
                 "consumes": [
                     "multipart/form-data"
                 ],
@@ -45,7 +635,7 @@ var doc = `{
                 "tags": [
                     "routes"
                 ],
-                "summary": "Add route",
+                "summary": "Delete route",
                 "parameters": [
                     {
                         "type": "string",
@@ -56,22 +646,20 @@ var doc = `{
                     },
                     {
                         "type": "string",
-                        "description": "list of b64 encoded HTTP methods, e.g. GET,POST,PUT",
-                        "name": "methods",
-                        "in": "formData",
-                        "required": true
+                        "description": "host of the route, if it was added for a host",
+                        "name": "host",
+                        "in": "formData"
                     },
                     {
                         "type": "string",
-                        "description": "list of b64 encoded headers separated by \\r\\n",
-                        "name": "headers",
-                        "in": "formData",
-                        "required": true
+                        "description": "match of the route, if it was added with a match other than exact",
+                        "name": "match",
+                        "in": "formData"
                     },
                     {
                         "type": "string",
-                        "description": "base64 encoded body",
-                        "name": "body",
+                        "description": "list of b64 encoded HTTP methods, e.g. GET,POST,PUT",
+                        "name": "methods",
                         "in": "formData",
                         "required": true
                     }
@@ -98,14 +686,14 @@ var doc = `{
                 }
             }
         },
-        "/deleteRoute": {
+        "/deleteStage": {
             "post": {
                 "security": [
                     {
                         "AuthToken": []
                     }
                 ],
-                "description": "resets a route to default",
+                "description": "stop serving a staged file",
                 "consumes": [
                     "multipart/form-data"
                 ],
@@ -113,21 +701,14 @@ var doc = `{
                     "application/json"
                 ],
                 "tags": [
-                    "routes"
+                    "staging"
                 ],
-                "summary": "Delete route",
+                "summary": "Delete stage",
                 "parameters": [
                     {
                         "type": "string",
-                        "description": "absolute URL path, e.g. /test or /test.jpg",
-                        "name": "urlPath",
-                        "in": "formData",
-                        "required": true
-                    },
-                    {
-                        "type": "string",
-                        "description": "list of b64 encoded HTTP methods, e.g. GET,POST,PUT",
-                        "name": "methods",
+                        "description": "name the payload is served under",
+                        "name": "fqdn",
                         "in": "formData",
                         "required": true
                     }
@@ -154,6 +735,43 @@ var doc = `{
                 }
             }
         },
+        "/exportRoutes": {
+            "get": {
+                "security": [
+                    {
+                        "AuthToken": []
+                    }
+                ],
+                "description": "download all custom routes as JSON for importRoutes. Bodies are base64 encoded",
+                "consumes": [
+                    "*/*"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "routes"
+                ],
+                "summary": "Export routes",
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/routes.Route"
+                            }
+                        }
+                    },
+                    "401": {
+                        "description": "Invalid Token",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
         "/healthz": {
             "get": {
                 "description": "get the status of server.",
@@ -183,6 +801,66 @@ var doc = `{
                 }
             }
         },
+        "/importRoutes": {
+            "post": {
+                "security": [
+                    {
+                        "AuthToken": []
+                    }
+                ],
+                "description": "add custom routes exported by exportRoutes. Routes overwrite existing routes at the same path and method",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "routes"
+                ],
+                "summary": "Import routes",
+                "parameters": [
+                    {
+                        "description": "routes to add",
+                        "name": "routes",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/routes.Route"
+                            }
+                        }
+                    },
+                    {
+                        "type": "boolean",
+                        "description": "remove all existing routes first",
+                        "name": "replace",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "401": {
+                        "description": "Invalid Token",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
         "/metrics": {
             "get": {
                 "security": [
@@ -223,6 +901,88 @@ var doc = `{
                 }
             }
         },
+        "/showExfil": {
+            "get": {
+                "security": [
+                    {
+                        "AuthToken": []
+                    }
+                ],
+                "description": "show DNS exfil payloads reassembled from \u003cseq\u003e.\u003cchunk\u003e.\u003cid\u003e names",
+                "consumes": [
+                    "*/*"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "exfil"
+                ],
+                "summary": "Show exfil",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "only show the payload for this interaction ID",
+                        "name": "interactionId",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "401": {
+                        "description": "Invalid Token",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/showPolicies": {
+            "get": {
+                "security": [
+                    {
+                        "AuthToken": []
+                    }
+                ],
+                "description": "show all DNS response policies in evaluation order",
+                "consumes": [
+                    "*/*"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "policies"
+                ],
+                "summary": "Show policies",
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "401": {
+                        "description": "Invalid Token",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
         "/showRoutes": {
             "get": {
                 "security": [
@@ -230,7 +990,7 @@ var doc = `{
                         "AuthToken": []
                     }
                 ],
-                "description": "show all added routes",
+                "description": "show all added routes with the requests served by each route",
                 "consumes": [
                     "multipart/form-data"
                 ],
@@ -262,6 +1022,155 @@ var doc = `{
                     }
                 }
             }
+        },
+        "/showStages": {
+            "get": {
+                "security": [
+                    {
+                        "AuthToken": []
+                    }
+                ],
+                "description": "show all files staged for delivery over DNS",
+                "consumes": [
+                    "*/*"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "staging"
+                ],
+                "summary": "Show stages",
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "401": {
+                        "description": "Invalid Token",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        }
+    },
+    "definitions": {
+        "routes.Proxy": {
+            "type": "object",
+            "properties": {
+                "headers": {
+                    "description": "Headers are set on the upstream request. An empty value removes\nthe header. The headers of the route are set on the response",
+                    "type": "object",
+                    "additionalProperties": {
+                        "type": "string"
+                    }
+                },
+                "preserveHost": {
+                    "description": "PreserveHost forwards the Host of the request instead of the host\nof the upstream",
+                    "type": "boolean"
+                },
+                "upstream": {
+                    "description": "Upstream is the URL of the service. The request path is appended\nto its path, e.g. /a is forwarded to http://127.0.0.1:8000/base/a",
+                    "type": "string"
+                }
+            }
+        },
+        "routes.Redirect": {
+            "type": "object",
+            "properties": {
+                "after": {
+                    "description": "After serves the route response to the first After requests and\nredirects the following requests, since some clients fetch a URL\nto validate it before the request that is redirected",
+                    "type": "integer"
+                },
+                "hops": {
+                    "description": "Hops redirects to the route with an increasing, signed\nconspirator_hop query parameter before the target, since some\nclients only validate the first URL",
+                    "type": "integer"
+                },
+                "perClient": {
+                    "description": "PerClient counts the requests of After for each client address\ninstead of all clients",
+                    "type": "boolean"
+                },
+                "status": {
+                    "description": "Optional. 301, 302, 303, 307 or 308. Defaults to 302",
+                    "type": "integer"
+                },
+                "target": {
+                    "description": "Required. Any URL, e.g. gopher:// or file://",
+                    "type": "string"
+                }
+            }
+        },
+        "routes.Route": {
+            "type": "object",
+            "properties": {
+                "body": {
+                    "description": "base64 encoded in JSON",
+                    "type": "array",
+                    "items": {
+                        "type": "integer"
+                    }
+                },
+                "expires": {
+                    "description": "Expires optionally serves the default response after the time",
+                    "type": "string"
+                },
+                "headers": {
+                    "description": "Headers are added to the response. The Content-Type is detected\nfrom the body if it is not set",
+                    "type": "object",
+                    "additionalProperties": {
+                        "type": "string"
+                    }
+                },
+                "hits": {
+                    "description": "requests served by the route",
+                    "type": "integer"
+                },
+                "host": {
+                    "description": "Host optionally limits the route to a host, e.g. a.example.com,\nor the subdomains of a wildcard, e.g. *.xxe.example.com",
+                    "type": "string"
+                },
+                "id": {
+                    "description": "Assigned when the route is added",
+                    "type": "string"
+                },
+                "match": {
+                    "description": "Match is how the Path matches the request path: exact, prefix,\nglob or regex. Defaults to exact",
+                    "type": "string"
+                },
+                "maxHits": {
+                    "description": "MaxHits optionally serves the route to the first requests only,\ne.g. for stage-once payloads. Later requests are served the\ndefault response",
+                    "type": "integer"
+                },
+                "methods": {
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                },
+                "path": {
+                    "type": "string"
+                },
+                "proxy": {
+                    "description": "Proxy optionally forwards the requests to an upstream service\ninstead of serving the body",
+                    "$ref": "#/definitions/routes.Proxy"
+                },
+                "redirect": {
+                    "description": "Redirect optionally redirects the requests instead of serving\nthe body",
+                    "$ref": "#/definitions/routes.Redirect"
+                },
+                "status": {
+                    "description": "Optional. Defaults to 200",
+                    "type": "integer"
+                },
+                "template": {
+                    "description": "Template renders the body as a text/template with the\nTemplateRequest of each request",
+                    "type": "boolean"
+                }
+            }
         }
     },
     "securityDefinitions": {
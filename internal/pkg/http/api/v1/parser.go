@@ -6,6 +6,7 @@ import (
 	"strings"
 
 	"github.com/rs/zerolog/log"
+	"github.com/tmoneypenny/conspirator/internal/pkg/http/routes"
 )
 
 // parseHeaders takes a string from formValue and converts it
@@ -14,12 +15,18 @@ func parseHeaders(headers string) map[string]string {
 	hMap := make(map[string]string)
 
 	if headers != "" {
-		for _, h := range strings.Split(headers, "\r\n") {
+		// browsers submit textarea lines separated by \n only
+		for _, h := range strings.Split(headers, "\n") {
 			hS := strings.SplitN(h, ":", 2)
+			// empty lines, e.g. a trailing \r\n, are not headers
+			name := strings.TrimSpace(hS[0])
+			if name == "" {
+				continue
+			}
 			if len(hS) == 2 {
-				hMap[hS[0]] = hS[1]
+				hMap[name] = strings.TrimSpace(hS[1])
 			} else {
-				hMap[hS[0]] = ""
+				hMap[name] = ""
 			}
 		}
 	}
@@ -41,9 +48,17 @@ func parseUrl(urlPath string) string {
 	return u.Path
 }
 
-// parseMethods parses the selected method options. It is
-// necessary to add methods individually, since Router().Add()
-// does not support the "ANY" type
+// parsePath validates the URL of exact and prefix routes. Glob and
+// regex patterns are not URLs, e.g. ? is part of the pattern
+func parsePath(urlPath, match string) string {
+	if match == routes.MatchGlob || match == routes.MatchRegex {
+		return urlPath
+	}
+	return parseUrl(urlPath)
+}
+
+// parseMethods parses the selected method options. Routes are
+// matched for each of their methods, there is no "ANY" method
 func parseMethods(m []byte) []string {
 	return strings.Split(string(m), ",")
 }
@@ -0,0 +1,144 @@
+package apiv1
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/tmoneypenny/conspirator/internal/pkg/bind"
+)
+
+// metrics godoc
+// @Summary Add policy
+// @Description add or replace a DNS response policy. Policies are evaluated by priority before records and default answers, and the first match decides the response
+// @Tags policies
+// @Accept mpfd
+// @Param id formData string false "ID of the policy to replace"
+// @Param priority formData int false "lower priorities are evaluated first"
+// @Param clientCidrs formData []string false "source or EDNS client subnet CIDRs to match, repeat for multiple" collectionFormat(multi)
+// @Param qtypes formData []string false "question types to match, e.g. A, repeat for multiple" collectionFormat(multi)
+// @Param namePattern formData string false "glob to match the question name, e.g. *.test.example.com"
+// @Param notBefore formData string false "RFC3339 time the policy starts to match"
+// @Param notAfter formData string false "RFC3339 time the policy stops matching"
+// @Param action formData string true "answer, nxdomain, refused or servfail"
+// @Param recordType formData string false "record type of the answer, e.g. A"
+// @Param ttl formData int false "TTL of the answer"
+// @Param value formData []string false "answer values in the same format as records, repeat for multiple" collectionFormat(multi)
+// @Produce json
+// @Success 200 {object} string "OK"
+// @Failure 401 {string} string "Invalid Token"
+// @Failure 500 {string} string "Internal Server Error"
+// @security AuthToken
+// @Router /addPolicy [post]
+func addPolicy(c echo.Context) error {
+	p, err := parseAddPolicyInput(c)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]interface{}{
+			"status": fmt.Sprint(err),
+		})
+	}
+
+	policy, err := bind.UpsertPolicy(*p)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]interface{}{
+			"status": fmt.Sprint(err),
+		})
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"status": "OK",
+		"Policy": policy,
+	})
+}
+
+// metrics godoc
+// @Summary Delete policy
+// @Description remove a DNS response policy
+// @Tags policies
+// @Accept mpfd
+// @Param id formData string true "ID of the policy"
+// @Produce json
+// @Success 200 {object} string "OK"
+// @Failure 401 {string} string "Invalid Token"
+// @Failure 500 {string} string "Internal Server Error"
+// @security AuthToken
+// @Router /deletePolicy [post]
+func deletePolicy(c echo.Context) error {
+	if err := bind.DeletePolicy(c.FormValue("id")); err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]interface{}{
+			"status": fmt.Sprint(err),
+		})
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"status": "OK",
+	})
+}
+
+// metrics godoc
+// @Summary Show policies
+// @Description show all DNS response policies in evaluation order
+// @Tags policies
+// @Accept */*
+// @Produce json
+// @Success 200 {object} string "OK"
+// @Failure 401 {string} string "Invalid Token"
+// @security AuthToken
+// @Router /showPolicies [get]
+func showPolicies(c echo.Context) error {
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"Policies": bind.ListPolicies(),
+	})
+}
+
+func parseAddPolicyInput(c echo.Context) (*bind.Policy, error) {
+	form, err := c.FormParams()
+	if err != nil {
+		return nil, err
+	}
+
+	p := &bind.Policy{
+		ID:          form.Get("id"),
+		ClientCIDRs: form["clientCidrs"],
+		Qtypes:      form["qtypes"],
+		NamePattern: form.Get("namePattern"),
+		Action:      form.Get("action"),
+		RecordType:  form.Get("recordType"),
+		Value:       form["value"],
+	}
+
+	if p.Action == "" {
+		return nil, fmt.Errorf("form fields cannot be null")
+	}
+
+	if v := form.Get("priority"); v != "" {
+		if p.Priority, err = strconv.Atoi(v); err != nil {
+			return nil, fmt.Errorf("priority must be a number")
+		}
+	}
+
+	if v := form.Get("ttl"); v != "" {
+		ttl, err := strconv.ParseUint(v, 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("ttl must be a number")
+		}
+		p.TTL = uint32(ttl)
+	}
+
+	for field, t := range map[string]**time.Time{
+		"notBefore": &p.NotBefore,
+		"notAfter":  &p.NotAfter,
+	} {
+		if v := form.Get(field); v != "" {
+			parsed, err := time.Parse(time.RFC3339, v)
+			if err != nil {
+				return nil, fmt.Errorf("%s must be an RFC3339 time", field)
+			}
+			*t = &parsed
+		}
+	}
+
+	return p, nil
+}
@@ -0,0 +1,144 @@
+package apiv1
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/tmoneypenny/conspirator/internal/pkg/bind"
+)
+
+// metrics godoc
+// @Summary Add record
+// @Description add or replace the DNS records of a type at a name. Shaping fields change how answers are sent, e.g. to tell UDP and TCP fetchers apart. Without a recordType only the shaping is stored and applies to every answer for the name
+// @Tags records
+// @Accept mpfd
+// @Param fqdn formData string true "name of the record, e.g. a.test.example.com"
+// @Param recordType formData string false "record type, e.g. A"
+// @Param ttl formData int false "TTL of the records"
+// @Param value formData []string false "record values, repeat for multiple" collectionFormat(multi)
+// @Param delay formData int false "milliseconds to wait before answering, up to 30000"
+// @Param truncate formData bool false "set the TC bit on UDP answers so that resolvers retry over TCP"
+// @Param rcode formData string false "answer with the rcode instead of the records, e.g. SERVFAIL, REFUSED or NXDOMAIN"
+// @Param drop formData bool false "do not answer queries"
+// @Produce json
+// @Success 200 {object} string "OK"
+// @Failure 401 {string} string "Invalid Token"
+// @Failure 500 {string} string "Internal Server Error"
+// @security AuthToken
+// @Router /addRecord [post]
+func addRecord(c echo.Context) error {
+	r, err := parseAddRecordInput(c)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]interface{}{
+			"status": fmt.Sprint(err),
+		})
+	}
+
+	if err := bind.UpsertRRS(r); err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]interface{}{
+			"status": fmt.Sprint(err),
+		})
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"status": "OK",
+	})
+}
+
+// metrics godoc
+// @Summary Delete record
+// @Description remove the DNS records and shaping of a name
+// @Tags records
+// @Accept mpfd
+// @Param fqdn formData string true "name of the record"
+// @Produce json
+// @Success 200 {object} string "OK"
+// @Failure 401 {string} string "Invalid Token"
+// @Failure 404 {string} string "Not Found"
+// @Failure 500 {string} string "Internal Server Error"
+// @security AuthToken
+// @Router /deleteRecord [post]
+func deleteRecord(c echo.Context) error {
+	fqdn := c.FormValue("fqdn")
+	if fqdn == "" {
+		return c.JSON(http.StatusInternalServerError, map[string]interface{}{
+			"status": "form fields cannot be null",
+		})
+	}
+
+	if !bind.DeleteRRS(&bind.Record{FQDN: &fqdn}) {
+		return c.JSON(http.StatusNotFound, map[string]interface{}{
+			"status": "record not found",
+		})
+	}
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"status": "OK",
+	})
+}
+
+func parseAddRecordInput(c echo.Context) (*bind.Record, error) {
+	form, err := c.FormParams()
+	if err != nil {
+		return nil, err
+	}
+
+	fqdn := form.Get("fqdn")
+	if fqdn == "" {
+		return nil, fmt.Errorf("form fields cannot be null")
+	}
+	r := &bind.Record{FQDN: &fqdn}
+
+	shaping := &bind.Shaping{Rcode: form.Get("rcode")}
+	if v := form.Get("delay"); v != "" {
+		delay, err := strconv.ParseUint(v, 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("delay must be a number")
+		}
+		shaping.Delay = time.Duration(delay) * time.Millisecond
+	}
+	for field, b := range map[string]*bool{
+		"truncate": &shaping.Truncate,
+		"drop":     &shaping.Drop,
+	} {
+		if v := form.Get(field); v != "" {
+			if *b, err = strconv.ParseBool(v); err != nil {
+				return nil, fmt.Errorf("%s must be a boolean", field)
+			}
+		}
+	}
+	if *shaping != (bind.Shaping{}) {
+		r.Shaping = shaping
+	}
+
+	recordType := form.Get("recordType")
+	if recordType == "" {
+		if r.Shaping == nil {
+			return nil, fmt.Errorf("form fields cannot be null")
+		}
+		return r, nil
+	}
+	r.RecordType = &recordType
+
+	ttl, err := strconv.ParseUint(form.Get("ttl"), 10, 32)
+	if err != nil {
+		return nil, fmt.Errorf("ttl must be a number")
+	}
+	ttl32 := uint32(ttl)
+	r.TTL = &ttl32
+
+	// single values are passed as a string since some types, e.g.
+	// CNAME, only accept one value
+	switch values := form["value"]; len(values) {
+	case 0:
+		return nil, fmt.Errorf("form fields cannot be null")
+	case 1:
+		r.Value = values[0]
+	default:
+		r.Value = values
+	}
+
+	return r, nil
+}
@@ -0,0 +1,38 @@
+package apiv1
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/tmoneypenny/conspirator/internal/pkg/bind"
+	"github.com/tmoneypenny/conspirator/internal/pkg/util"
+)
+
+func TestDeleteRecord(t *testing.T) {
+	assert.NoError(t, bind.UpsertRRS(&bind.Record{
+		FQDN:       util.StrToPtr("a.record.src."),
+		RecordType: util.StrToPtr("A"),
+		TTL:        util.Uint32ToPtr(60),
+		Value:      "127.0.0.1",
+	}))
+
+	del := func(fqdn string) int {
+		form := url.Values{"fqdn": {fqdn}}
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/deleteRecord", strings.NewReader(form.Encode()))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationForm)
+		rec := httptest.NewRecorder()
+		assert.NoError(t, deleteRecord(echo.New().NewContext(req, rec)))
+		return rec.Code
+	}
+
+	// the name is found without the trailing dot
+	assert.Equal(t, http.StatusOK, del("a.record.src"))
+	_, found := bind.GetRRS(&bind.Record{FQDN: util.StrToPtr("a.record.src."), RecordType: util.StrToPtr("A")})
+	assert.False(t, found)
+	assert.Equal(t, http.StatusNotFound, del("a.record.src"))
+}
@@ -0,0 +1,140 @@
+package apiv1
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+
+	"github.com/labstack/echo/v4"
+	"github.com/tmoneypenny/conspirator/internal/pkg/bind"
+)
+
+// maxStageSize limits the size of a file staged over DNS. At 189
+// bytes per chunk this is roughly 5500 queries
+const maxStageSize = 1 << 20
+
+// metrics godoc
+// @Summary Add stage
+// @Description stage a file for delivery as base64 chunks in TXT answers at <index>.<fqdn>, with a manifest at <fqdn>
+// @Tags staging
+// @Accept mpfd
+// @Param fqdn formData string true "name to serve the payload under, e.g. payload.test.example.com"
+// @Param file formData file true "file to stage"
+// @Param chunkSize formData int false "raw bytes per chunk, a multiple of 3 up to 189"
+// @Produce json
+// @Success 200 {object} string "OK"
+// @Failure 401 {string} string "Invalid Token"
+// @Failure 500 {string} string "Internal Server Error"
+// @security AuthToken
+// @Router /addStage [post]
+func addStage(c echo.Context) error {
+	r, err := parseAddStageInput(c)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]interface{}{
+			"status": fmt.Sprint(err),
+		})
+	}
+
+	stage, err := bind.StageFile(r.FQDN, r.Data, r.ChunkSize)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]interface{}{
+			"status": fmt.Sprint(err),
+		})
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"status": "OK",
+		"Stage":  stage,
+	})
+}
+
+// metrics godoc
+// @Summary Delete stage
+// @Description stop serving a staged file
+// @Tags staging
+// @Accept mpfd
+// @Param fqdn formData string true "name the payload is served under"
+// @Produce json
+// @Success 200 {object} string "OK"
+// @Failure 401 {string} string "Invalid Token"
+// @Failure 500 {string} string "Internal Server Error"
+// @security AuthToken
+// @Router /deleteStage [post]
+func deleteStage(c echo.Context) error {
+	fqdn := c.FormValue("fqdn")
+	if fqdn == "" {
+		return c.JSON(http.StatusInternalServerError, map[string]interface{}{
+			"status": "form fields cannot be null",
+		})
+	}
+
+	bind.DeleteStage(fqdn)
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"status": "OK",
+	})
+}
+
+// metrics godoc
+// @Summary Show stages
+// @Description show all files staged for delivery over DNS
+// @Tags staging
+// @Accept */*
+// @Produce json
+// @Success 200 {object} string "OK"
+// @Failure 401 {string} string "Invalid Token"
+// @security AuthToken
+// @Router /showStages [get]
+func showStages(c echo.Context) error {
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"Stages": bind.ListStages(),
+	})
+}
+
+// addStageOutput is returned to addStage to stage a new file
+type addStageOutput struct {
+	FQDN      string
+	Data      []byte
+	ChunkSize int
+}
+
+func parseAddStageInput(c echo.Context) (*addStageOutput, error) {
+	fqdn := c.FormValue("fqdn")
+	if fqdn == "" {
+		return nil, fmt.Errorf("form fields cannot be null")
+	}
+
+	var chunkSize int
+	if v := c.FormValue("chunkSize"); v != "" {
+		size, err := strconv.Atoi(v)
+		if err != nil {
+			return nil, fmt.Errorf("chunkSize must be a number")
+		}
+		chunkSize = size
+	}
+
+	fh, err := c.FormFile("file")
+	if err != nil {
+		return nil, fmt.Errorf("form fields cannot be null")
+	}
+	if fh.Size > maxStageSize {
+		return nil, fmt.Errorf("file exceeds %d bytes", maxStageSize)
+	}
+
+	f, err := fh.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	data, err := ioutil.ReadAll(f)
+	if err != nil {
+		return nil, err
+	}
+
+	return &addStageOutput{
+		FQDN:      fqdn,
+		Data:      data,
+		ChunkSize: chunkSize,
+	}, nil
+}
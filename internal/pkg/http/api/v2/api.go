@@ -0,0 +1,74 @@
+package apiv2
+
+import (
+	_ "embed"
+	"errors"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/echo/v4/middleware"
+	auth "github.com/tmoneypenny/conspirator/internal/pkg/http/middleware"
+	"github.com/tmoneypenny/conspirator/internal/pkg/http/routes"
+)
+
+// @title API
+// @description Provides a RESTful JSON API for interacting with the server
+// @license.name Apache 2.0
+// @license.url http://www.apache.org/licenses/LICENSE-2.0.html
+// @BasePath /api/v2
+// @version v2
+// @securitydefinitions.apikey AuthToken
+// @in header
+// @name Authorization
+// @scope.admin
+
+// swaggerDoc is the generated Swagger document of the API. Only one
+// document can be registered with swag, so it is served by Docs
+//
+//go:embed docs/swagger.json
+var swaggerDoc []byte
+
+// Error is the body of the error responses
+type Error struct {
+	Error string `json:"error"`
+}
+
+// Router defines a new subRouter for the API version. Custom routes
+// are restored by apiv1.Router, which must be called first
+func Router(s *echo.Echo) {
+	jwtConfig := middleware.JWTConfig{
+		Claims:                  &auth.JWTClaim{},
+		SigningKey:              auth.JWTSigningKey,
+		ErrorHandlerWithContext: auth.JWTAPIError,
+	}
+
+	apiV2 := s.Group("/api/v2")
+	apiV2.Use(middleware.JWTWithConfig(jwtConfig))
+
+	apiV2.GET("/routes", listRoutes)
+	apiV2.POST("/routes", createRoute)
+	apiV2.GET("/routes/:id", getRoute).Name = "getRoute"
+	apiV2.PUT("/routes/:id", updateRoute)
+	apiV2.PATCH("/routes/:id", patchRoute)
+	apiV2.DELETE("/routes/:id", deleteRoute)
+}
+
+// Docs serves the Swagger document of the API
+func Docs(c echo.Context) error {
+	return c.JSONBlob(http.StatusOK, swaggerDoc)
+}
+
+// errorResponse returns the status of the error and the error as the
+// body
+func errorResponse(c echo.Context, err error) error {
+	status := http.StatusInternalServerError
+	switch {
+	case errors.Is(err, routes.ErrInvalidRoute):
+		status = http.StatusBadRequest
+	case errors.Is(err, routes.ErrRouteNotFound):
+		status = http.StatusNotFound
+	case errors.Is(err, routes.ErrRouteConflict):
+		status = http.StatusConflict
+	}
+	return c.JSON(status, &Error{Error: err.Error()})
+}
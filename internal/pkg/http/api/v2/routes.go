@@ -0,0 +1,227 @@
+package apiv2
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+	"github.com/tmoneypenny/conspirator/internal/pkg/http/routes"
+)
+
+// metrics godoc
+// @Summary List routes
+// @Description list all custom routes with the requests served by each route, sorted by path, match, method and host
+// @Tags routes
+// @Produce json
+// @Success 200 {array} routes.Route
+// @Failure 401 {string} string "Invalid Token"
+// @security AuthToken
+// @Router /routes [get]
+func listRoutes(c echo.Context) error {
+	return c.JSON(http.StatusOK, routes.List())
+}
+
+// metrics godoc
+// @Summary Create route
+// @Description create a custom route with a new ID. The body is served unchanged with a Content-Length of its size and the Content-Type header, or the Content-Type detected from the body if it is unset
+// @Tags routes
+// @Accept json
+// @Param route body routes.Route true "route to create, the id is assigned by the server"
+// @Produce json
+// @Success 201 {object} routes.Route
+// @Header 201 {string} Location "URL of the route"
+// @Failure 400 {object} Error "Invalid route"
+// @Failure 401 {string} string "Invalid Token"
+// @Failure 409 {object} Error "Another route has the host, path, match and one of the methods"
+// @Failure 500 {object} Error "Internal Server Error"
+// @security AuthToken
+// @Router /routes [post]
+func createRoute(c echo.Context) error {
+	r, err := decodeRoute(c)
+	if err != nil {
+		return errorResponse(c, err)
+	}
+
+	if err := routes.Create(r); err != nil {
+		return errorResponse(c, err)
+	}
+
+	c.Response().Header().Set(echo.HeaderLocation, c.Echo().Reverse("getRoute", r.ID))
+	return getRouteResponse(c, http.StatusCreated, r.ID)
+}
+
+// metrics godoc
+// @Summary Get route
+// @Description get the custom route of the ID
+// @Tags routes
+// @Param id path string true "ID of the route"
+// @Produce json
+// @Success 200 {object} routes.Route
+// @Failure 401 {string} string "Invalid Token"
+// @Failure 404 {object} Error "Route not found"
+// @security AuthToken
+// @Router /routes/{id} [get]
+func getRoute(c echo.Context) error {
+	return getRouteResponse(c, http.StatusOK, c.Param("id"))
+}
+
+// metrics godoc
+// @Summary Replace route
+// @Description replace the custom route of the ID. Fields missing from the body are reset to their defaults, including the hits
+// @Tags routes
+// @Accept json
+// @Param id path string true "ID of the route"
+// @Param route body routes.Route true "route replacing the route of the ID, the id of the body is ignored"
+// @Produce json
+// @Success 200 {object} routes.Route
+// @Failure 400 {object} Error "Invalid route"
+// @Failure 401 {string} string "Invalid Token"
+// @Failure 404 {object} Error "Route not found"
+// @Failure 409 {object} Error "Another route has the host, path, match and one of the methods"
+// @Failure 500 {object} Error "Internal Server Error"
+// @security AuthToken
+// @Router /routes/{id} [put]
+func updateRoute(c echo.Context) error {
+	r, err := decodeRoute(c)
+	if err != nil {
+		return errorResponse(c, err)
+	}
+
+	if err := routes.Update(c.Param("id"), r); err != nil {
+		return errorResponse(c, err)
+	}
+	return getRouteResponse(c, http.StatusOK, c.Param("id"))
+}
+
+// metrics godoc
+// @Summary Update route
+// @Description update fields of the custom route of the ID with a JSON merge patch (RFC 7396). Fields missing from the body are unchanged and null fields are reset to their defaults, e.g. {"status": 404, "redirect": null}
+// @Tags routes
+// @Accept json
+// @Param id path string true "ID of the route"
+// @Param route body object true "fields of the route to update"
+// @Produce json
+// @Success 200 {object} routes.Route
+// @Failure 400 {object} Error "Invalid route"
+// @Failure 401 {string} string "Invalid Token"
+// @Failure 404 {object} Error "Route not found"
+// @Failure 409 {object} Error "Another route has the host, path, match and one of the methods"
+// @Failure 500 {object} Error "Internal Server Error"
+// @security AuthToken
+// @Router /routes/{id} [patch]
+func patchRoute(c echo.Context) error {
+	id := c.Param("id")
+	old, err := routes.Get(id)
+	if err != nil {
+		return errorResponse(c, err)
+	}
+
+	var patch interface{}
+	if err := json.NewDecoder(c.Request().Body).Decode(&patch); err != nil {
+		return errorResponse(c, fmt.Errorf("%w: %v", routes.ErrInvalidRoute, err))
+	}
+	if _, ok := patch.(map[string]interface{}); !ok {
+		return errorResponse(c, fmt.Errorf("%w: patch must be a JSON object", routes.ErrInvalidRoute))
+	}
+
+	r, err := mergeRoute(old, patch)
+	if err != nil {
+		return errorResponse(c, err)
+	}
+
+	if err := routes.Update(id, r); err != nil {
+		return errorResponse(c, err)
+	}
+	return getRouteResponse(c, http.StatusOK, id)
+}
+
+// metrics godoc
+// @Summary Delete route
+// @Description delete the custom route of the ID. Its paths serve the default response again
+// @Tags routes
+// @Param id path string true "ID of the route"
+// @Success 204
+// @Failure 401 {string} string "Invalid Token"
+// @Failure 404 {object} Error "Route not found"
+// @Failure 500 {object} Error "Internal Server Error"
+// @security AuthToken
+// @Router /routes/{id} [delete]
+func deleteRoute(c echo.Context) error {
+	if err := routes.Delete(c.Param("id")); err != nil {
+		return errorResponse(c, err)
+	}
+	return c.NoContent(http.StatusNoContent)
+}
+
+// decodeRoute returns the route of the JSON body. Unknown fields are
+// rejected, since a misspelt field would silently be ignored
+func decodeRoute(c echo.Context) (*routes.Route, error) {
+	dec := json.NewDecoder(c.Request().Body)
+	dec.DisallowUnknownFields()
+
+	var r routes.Route
+	if err := dec.Decode(&r); err != nil {
+		return nil, fmt.Errorf("%w: %v", routes.ErrInvalidRoute, err)
+	}
+	return &r, nil
+}
+
+// getRouteResponse returns the route of the ID with the status
+func getRouteResponse(c echo.Context, status int, id string) error {
+	r, err := routes.Get(id)
+	if err != nil {
+		return errorResponse(c, err)
+	}
+	return c.JSON(status, r)
+}
+
+// mergeRoute returns the route with the merge patch applied to its
+// JSON fields
+func mergeRoute(r *routes.Route, patch interface{}) (*routes.Route, error) {
+	data, err := json.Marshal(r)
+	if err != nil {
+		return nil, err
+	}
+
+	var doc interface{}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+
+	if data, err = json.Marshal(mergePatch(doc, patch)); err != nil {
+		return nil, err
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+
+	var merged routes.Route
+	if err := dec.Decode(&merged); err != nil {
+		return nil, fmt.Errorf("%w: %v", routes.ErrInvalidRoute, err)
+	}
+	return &merged, nil
+}
+
+// mergePatch applies the JSON merge patch to the document. Objects
+// are merged, null removes a member and other values replace it
+func mergePatch(doc, patch interface{}) interface{} {
+	p, ok := patch.(map[string]interface{})
+	if !ok {
+		return patch
+	}
+
+	d, ok := doc.(map[string]interface{})
+	if !ok {
+		d = make(map[string]interface{})
+	}
+	for k, v := range p {
+		if v == nil {
+			delete(d, k)
+		} else {
+			d[k] = mergePatch(d[k], v)
+		}
+	}
+	return d
+}
@@ -0,0 +1,108 @@
+package apiv2
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/tmoneypenny/conspirator/internal/pkg/http/routes"
+)
+
+func newTestRouter() *echo.Echo {
+	e := echo.New()
+	e.GET("/api/v2/routes", listRoutes)
+	e.POST("/api/v2/routes", createRoute)
+	e.GET("/api/v2/routes/:id", getRoute).Name = "getRoute"
+	e.PUT("/api/v2/routes/:id", updateRoute)
+	e.PATCH("/api/v2/routes/:id", patchRoute)
+	e.DELETE("/api/v2/routes/:id", deleteRoute)
+	return e
+}
+
+func request(e *echo.Echo, method, path, body string) *httptest.ResponseRecorder {
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	e.ServeHTTP(rec, req)
+	return rec
+}
+
+func decode(t *testing.T, rec *httptest.ResponseRecorder) *routes.Route {
+	var r routes.Route
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &r))
+	return &r
+}
+
+func TestRouteAPI(t *testing.T) {
+	e := newTestRouter()
+
+	rec := request(e, http.MethodPost, "/api/v2/routes", `{"path": "/v2", "methods": ["get"], "body": "cGF5bG9hZA==", "headers": {"X-A": "a"}}`)
+	assert.Equal(t, http.StatusCreated, rec.Code)
+	created := decode(t, rec)
+	assert.NotEmpty(t, created.ID)
+	assert.Equal(t, "/api/v2/routes/"+created.ID, rec.Header().Get(echo.HeaderLocation))
+	assert.Equal(t, []string{"GET"}, created.Methods)
+	assert.Equal(t, []byte("payload"), created.Body)
+	assert.Equal(t, http.StatusOK, created.Status)
+	defer routes.Delete(created.ID)
+
+	for body, status := range map[string]int{
+		`{"path": "/v2", "methods": ["GET"]}`:                       http.StatusConflict,
+		`{"path": "/v2-invalid", "methods": []}`:                    http.StatusBadRequest,
+		`{"path": "/v2-invalid", "methods": ["GET"], "statu": 404}`: http.StatusBadRequest,
+		`{"path": `: http.StatusBadRequest,
+	} {
+		rec = request(e, http.MethodPost, "/api/v2/routes", body)
+		assert.Equal(t, status, rec.Code, body)
+		assert.Contains(t, rec.Body.String(), `"error"`)
+	}
+
+	rec = request(e, http.MethodGet, "/api/v2/routes/"+created.ID, "")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, created, decode(t, rec))
+	assert.Equal(t, http.StatusNotFound, request(e, http.MethodGet, "/api/v2/routes/unknown", "").Code)
+
+	// patches only change the fields of the body and null resets a
+	// field
+	rec = request(e, http.MethodPatch, "/api/v2/routes/"+created.ID, `{"status": 404, "headers": {"X-B": "b"}, "body": null}`)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	patched := decode(t, rec)
+	assert.Equal(t, created.ID, patched.ID)
+	assert.Equal(t, "/v2", patched.Path)
+	assert.Equal(t, http.StatusNotFound, patched.Status)
+	assert.Equal(t, map[string]string{"X-A": "a", "X-B": "b"}, patched.Headers)
+	assert.Empty(t, patched.Body)
+	assert.Equal(t, http.StatusBadRequest, request(e, http.MethodPatch, "/api/v2/routes/"+created.ID, `{"status": 42}`).Code)
+	assert.Equal(t, http.StatusBadRequest, request(e, http.MethodPatch, "/api/v2/routes/"+created.ID, `[]`).Code)
+
+	// updates replace every field
+	rec = request(e, http.MethodPut, "/api/v2/routes/"+created.ID, `{"path": "/v2", "methods": ["POST"]}`)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	updated := decode(t, rec)
+	assert.Equal(t, []string{"POST"}, updated.Methods)
+	assert.Empty(t, updated.Headers)
+	assert.Equal(t, http.StatusOK, updated.Status)
+	assert.Equal(t, http.StatusNotFound, request(e, http.MethodPut, "/api/v2/routes/unknown", `{"path": "/v2", "methods": ["GET"]}`).Code)
+
+	var listed []*routes.Route
+	rec = request(e, http.MethodGet, "/api/v2/routes", "")
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &listed))
+	assert.Contains(t, listed, updated)
+
+	assert.Equal(t, http.StatusNoContent, request(e, http.MethodDelete, "/api/v2/routes/"+created.ID, "").Code)
+	assert.Equal(t, http.StatusNotFound, request(e, http.MethodDelete, "/api/v2/routes/"+created.ID, "").Code)
+}
+
+func TestMergePatch(t *testing.T) {
+	doc := map[string]interface{}{"a": "b", "c": map[string]interface{}{"d": "e", "f": "g"}}
+	patch := map[string]interface{}{"a": "z", "c": map[string]interface{}{"f": nil}, "h": []interface{}{"i"}}
+	assert.Equal(t, map[string]interface{}{
+		"a": "z",
+		"c": map[string]interface{}{"d": "e"},
+		"h": []interface{}{"i"},
+	}, mergePatch(doc, patch))
+}
@@ -139,3 +139,13 @@ func pollServer(c echo.Context) error {
 		"AccessToken":    accessCookie.Value,
 	})
 }
+
+// showExfil - /admin/exfil
+func showExfil(c echo.Context) error {
+	c.Response().Header().Set("X-Csrf-Token", csrf.Token(c.Request()))
+	accessCookie, _ := c.Cookie("access-token")
+	return c.Render(http.StatusOK, "exfil.tmpl", map[string]interface{}{
+		csrf.TemplateTag: csrf.TemplateField(c.Request()),
+		"AccessToken":    accessCookie.Value,
+	})
+}
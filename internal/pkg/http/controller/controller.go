@@ -9,6 +9,7 @@ import (
 	"github.com/labstack/echo/v4"
 	"github.com/labstack/echo/v4/middleware"
 	echoSwagger "github.com/swaggo/echo-swagger"
+	apiv2 "github.com/tmoneypenny/conspirator/internal/pkg/http/api/v2"
 	auth "github.com/tmoneypenny/conspirator/internal/pkg/http/middleware"
 )
 
@@ -47,6 +48,8 @@ func Router(s *echo.Echo) {
 
 	// Setup SwaggerUI docs
 	adminGroup.GET("/docs/*", echoSwagger.WrapHandler)
+	adminGroup.GET("/docs/v2/swagger.json", apiv2.Docs)
+	adminGroup.GET("/docs/v2/*", echoSwagger.EchoWrapHandler(echoSwagger.URL("swagger.json")))
 
 	adminGroup.GET("/home", adminHome)
 	adminGroup.GET("/settings", adminSettings)
@@ -54,4 +57,5 @@ func Router(s *echo.Echo) {
 	adminGroup.GET("/deleteRoute", deleteRoute)
 	adminGroup.GET("/showRoutes", showRoutes)
 	adminGroup.GET("/poll", pollServer)
+	adminGroup.GET("/exfil", showExfil)
 }
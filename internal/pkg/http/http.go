@@ -1,6 +1,10 @@
 package http
 
-import "github.com/tmoneypenny/conspirator/internal/pkg/polling"
+import (
+	"crypto/tls"
+
+	"github.com/tmoneypenny/conspirator/internal/pkg/polling"
+)
 
 // Server contains all HTTP listeners
 type Server struct {
@@ -24,6 +28,10 @@ type TLSConfig struct {
 	Port     *int
 	CertFile *string
 	KeyFile  *string
+	// GetCertificate optionally provides certificates that are
+	// reloaded while the listener is running. The key pair is not
+	// loaded by the listener if it is set
+	GetCertificate func(*tls.ClientHelloInfo) (*tls.Certificate, error)
 }
 
 // HTTPServer takes HTTPServerConfig input and returns
@@ -0,0 +1,118 @@
+package routes
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Path match types of a route
+const (
+	MatchExact  = "exact"
+	MatchPrefix = "prefix"
+	MatchGlob   = "glob"
+	MatchRegex  = "regex"
+)
+
+// matchOrder is the order in which the match types of the routes of a
+// host are tried
+var matchOrder = map[string]int{MatchExact: 0, MatchPrefix: 1, MatchGlob: 2, MatchRegex: 3}
+
+// validateMatch checks the match type and compiles the pattern of the
+// route. An empty match type is an exact match
+func validateMatch(r *Route) error {
+	switch r.Match {
+	case "", MatchExact:
+		r.Match = ""
+	case MatchPrefix:
+	case MatchGlob:
+		r.pattern = globToRegexp(r.Path)
+	case MatchRegex:
+		var err error
+		if r.pattern, err = regexp.Compile(r.Path); err != nil {
+			return fmt.Errorf("%w: %v", ErrInvalidRoute, err)
+		}
+	default:
+		return fmt.Errorf("%w: unknown match %s", ErrInvalidRoute, r.Match)
+	}
+
+	if r.Match != MatchRegex && !strings.HasPrefix(r.Path, "/") {
+		return fmt.Errorf("%w: path must start with /", ErrInvalidRoute)
+	}
+	return nil
+}
+
+// globToRegexp converts the glob to an anchored regexp. * matches
+// within a path segment, ** matches across segments and ? matches a
+// single character. Each wildcard is a group
+func globToRegexp(glob string) *regexp.Regexp {
+	var b strings.Builder
+	b.WriteString("^")
+	for i := 0; i < len(glob); i++ {
+		switch {
+		case strings.HasPrefix(glob[i:], "**"):
+			b.WriteString("(.*)")
+			i++
+		case glob[i] == '*':
+			b.WriteString("([^/]*)")
+		case glob[i] == '?':
+			b.WriteString("([^/])")
+		default:
+			b.WriteString(regexp.QuoteMeta(glob[i : i+1]))
+		}
+	}
+	b.WriteString("$")
+	return regexp.MustCompile(b.String())
+}
+
+// matchPath reports whether the path matches the route. The groups
+// are the path followed by the captured groups: the remainder of a
+// prefix, the wildcards of a glob or the groups of a regex
+func (r *Route) matchPath(path string) ([]string, bool) {
+	switch r.Match {
+	case MatchPrefix:
+		if !strings.HasPrefix(path, r.Path) {
+			return nil, false
+		}
+		return []string{path, strings.TrimPrefix(path, r.Path)}, true
+	case MatchGlob, MatchRegex:
+		groups := r.pattern.FindStringSubmatch(path)
+		return groups, groups != nil
+	default:
+		return []string{path}, path == r.Path
+	}
+}
+
+// namedGroups returns the named groups of a regex route
+func (r *Route) namedGroups(groups []string) map[string]string {
+	named := make(map[string]string)
+	if r.pattern == nil {
+		return named
+	}
+	for i, name := range r.pattern.SubexpNames() {
+		if name != "" && i < len(groups) {
+			named[name] = groups[i]
+		}
+	}
+	return named
+}
+
+// hostPatterns returns the patterns matching the host from the most
+// specific: the host, the wildcards from the longest suffix and the
+// empty pattern of routes for any host
+func hostPatterns(host string) []string {
+	if host == "" {
+		return []string{""}
+	}
+
+	patterns := []string{host}
+	for i := strings.Index(host, "."); i >= 0; {
+		patterns = append(patterns, "*"+host[i:])
+		next := strings.Index(host[i+1:], ".")
+		if next < 0 {
+			break
+		}
+		i += next + 1
+	}
+	return append(patterns, "")
+}
@@ -0,0 +1,88 @@
+package routes
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+
+	"github.com/labstack/echo/v4"
+	"github.com/rs/zerolog/log"
+)
+
+var invalidProxy error = fmt.Errorf("%w: proxy", ErrInvalidRoute)
+
+// Proxy forwards the requests of a route to an upstream service, e.g.
+// a listener on localhost. Requests and responses are recorded as
+// interactions like other routes
+type Proxy struct {
+	// Upstream is the URL of the service. The request path is appended
+	// to its path, e.g. /a is forwarded to http://127.0.0.1:8000/base/a
+	Upstream string `json:"upstream"`
+	// Headers are set on the upstream request. An empty value removes
+	// the header. The headers of the route are set on the response
+	Headers map[string]string `json:"headers,omitempty"`
+	// PreserveHost forwards the Host of the request instead of the host
+	// of the upstream
+	PreserveHost bool `json:"preserveHost,omitempty"`
+
+	proxy *httputil.ReverseProxy
+}
+
+// validateProxy checks the upstream and creates the reverse proxy of
+// the route
+func validateProxy(r *Route) error {
+	p := r.Proxy
+	if r.Redirect != nil || r.Template {
+		return fmt.Errorf("%w: proxy routes cannot redirect or render templates", invalidProxy)
+	}
+
+	upstream, err := url.Parse(p.Upstream)
+	if err != nil || (upstream.Scheme != "http" && upstream.Scheme != "https") || upstream.Host == "" {
+		return fmt.Errorf("%w: upstream must be an http or https URL", invalidProxy)
+	}
+
+	p.proxy = httputil.NewSingleHostReverseProxy(upstream)
+	director := p.proxy.Director
+	p.proxy.Director = func(req *http.Request) {
+		host := req.Host
+		director(req)
+		req.Host = upstream.Host
+		if p.PreserveHost {
+			req.Host = host
+		}
+
+		for h, v := range p.Headers {
+			if v == "" {
+				req.Header.Del(h)
+			} else {
+				req.Header.Set(h, v)
+			}
+		}
+	}
+
+	p.proxy.ModifyResponse = func(res *http.Response) error {
+		for h, v := range r.Headers {
+			if v == "" {
+				res.Header.Del(h)
+			} else {
+				res.Header.Set(h, v)
+			}
+		}
+		return nil
+	}
+
+	p.proxy.ErrorHandler = func(w http.ResponseWriter, req *http.Request, err error) {
+		log.Error().Msgf("failed to proxy %s %s to %s: %v", req.Method, req.URL.Path, p.Upstream, err)
+		w.WriteHeader(http.StatusBadGateway)
+	}
+
+	return nil
+}
+
+// writeProxy forwards the request to the upstream of the route
+func writeProxy(c echo.Context, r *Route) error {
+	log.Debug().Msgf("proxying %s %s from %s to %s", c.Request().Method, c.Request().URL.Path, c.RealIP(), r.Proxy.Upstream)
+	r.Proxy.proxy.ServeHTTP(c.Response(), c.Request())
+	return nil
+}
@@ -0,0 +1,159 @@
+package routes
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/labstack/echo/v4"
+	"github.com/rs/zerolog/log"
+)
+
+// maxRedirectHops limits the hops through the server before the
+// redirect to the target
+const maxRedirectHops = 20
+
+// hopParam is the query parameter of the hop count. It is namespaced
+// so that it does not clash with a hop parameter of the route path
+const hopParam = "conspirator_hop"
+
+// hopKey signs the hop counts, so that a client cannot skip the After
+// requests by sending a hop count. Hops of a previous run are counted
+// as first requests
+var hopKey = newHopKey()
+
+func newHopKey() []byte {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		log.Fatal().Msgf("failed to generate redirect hop key: %v", err)
+	}
+	return key
+}
+
+var invalidRedirect error = fmt.Errorf("%w: redirect", ErrInvalidRoute)
+
+// redirectStatus are the status codes of a redirect
+var redirectStatus = map[int]bool{301: true, 302: true, 303: true, 307: true, 308: true}
+
+// Redirect redirects requests of a route to a target, e.g. an internal
+// address to test SSRF filters. Each hop is a request to the server
+// and recorded as an interaction
+type Redirect struct {
+	Target string `json:"target"`           // Required. Any URL, e.g. gopher:// or file://
+	Status int    `json:"status,omitempty"` // Optional. 301, 302, 303, 307 or 308. Defaults to 302
+	// Hops redirects to the route with an increasing, signed
+	// conspirator_hop query parameter before the target, since some
+	// clients only validate the first URL
+	Hops int `json:"hops,omitempty"`
+	// After serves the route response to the first After requests and
+	// redirects the following requests, since some clients fetch a URL
+	// to validate it before the request that is redirected
+	After int `json:"after,omitempty"`
+	// PerClient counts the requests of After for each client address
+	// instead of all clients
+	PerClient bool `json:"perClient,omitempty"`
+
+	mutex    *sync.Mutex
+	requests map[string]int // requests by client, or "" for all clients
+}
+
+// validateRedirect checks the redirect and sets the default status
+func validateRedirect(r *Redirect) error {
+	u, err := url.Parse(r.Target)
+	if err != nil || u.Scheme == "" {
+		return fmt.Errorf("%w: target must be an absolute URL", invalidRedirect)
+	}
+	if r.Status == 0 {
+		r.Status = 302
+	}
+	if !redirectStatus[r.Status] {
+		return fmt.Errorf("%w: invalid status %d", invalidRedirect, r.Status)
+	}
+	if r.Hops < 0 || r.Hops > maxRedirectHops {
+		return fmt.Errorf("%w: hops must be between 0 and %d", invalidRedirect, maxRedirectHops)
+	}
+	if r.After < 0 {
+		return fmt.Errorf("%w: after cannot be negative", invalidRedirect)
+	}
+
+	r.mutex = &sync.Mutex{}
+	r.requests = make(map[string]int)
+	return nil
+}
+
+// count counts the request of the client and reports whether it is
+// redirected
+func (r *Redirect) count(client string) bool {
+	if !r.PerClient {
+		client = ""
+	}
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.requests[client]++
+	return r.requests[client] > r.After
+}
+
+// signHop returns the signed hop count of the route
+func signHop(r *Route, hop int) string {
+	mac := hmac.New(sha256.New, hopKey)
+	fmt.Fprintf(mac, "%s:%d", r.ID, hop)
+	return fmt.Sprintf("%d.%s", hop, hex.EncodeToString(mac.Sum(nil)[:8]))
+}
+
+// hop returns the hop count of a redirect route request, or 0 for the
+// first request. Counts that are not signed for the route or not
+// between 1 and Hops are first requests
+func hop(c echo.Context, r *Route) int {
+	v := c.QueryParam(hopParam)
+	i := strings.Index(v, ".")
+	if r.Redirect == nil || i < 0 {
+		return 0
+	}
+
+	n, err := strconv.Atoi(v[:i])
+	if err != nil || n < 1 || n > r.Redirect.Hops || !hmac.Equal([]byte(v), []byte(signHop(r, n))) {
+		return 0
+	}
+	return n
+}
+
+// location returns the next hop of the request or the target
+func location(c echo.Context, r *Route, hop int) string {
+	if hop >= r.Redirect.Hops {
+		return r.Redirect.Target
+	}
+
+	u := *c.Request().URL
+	u.Scheme, u.Host = c.Scheme(), c.Request().Host
+	q := u.Query()
+	q.Set(hopParam, signHop(r, hop+1))
+	u.RawQuery = q.Encode()
+	return u.String()
+}
+
+// writeRedirect redirects the request to the next hop or the target.
+// Requests before After are served the route response
+func writeRedirect(c echo.Context, r *Route) (bool, error) {
+	// hops were already counted by the first request
+	hop := hop(c, r)
+	if hop == 0 && !r.Redirect.count(c.RealIP()) {
+		return false, nil
+	}
+
+	location := location(c, r, hop)
+	log.Debug().Msgf("redirecting %s %s from %s to %s", c.Request().Method, c.Request().URL, c.RealIP(), location)
+
+	for h, v := range r.Headers {
+		c.Response().Header().Add(h, v)
+	}
+	c.Response().Header().Set(echo.HeaderLocation, location)
+	return true, c.NoContent(r.Redirect.Status)
+}
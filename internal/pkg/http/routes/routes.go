@@ -0,0 +1,53 @@
+package routes
+
+// Restore loads the routes saved in file. Routes are saved to file
+// when they change. A missing file is not an error and an empty file
+// disables saving
+func Restore(file string) error {
+	return customRoutes.restore(file)
+}
+
+// Add adds the routes. Routes replace the routes with the same ID and
+// the methods of other routes with the same host, path and match
+func Add(routes ...*Route) error {
+	return customRoutes.add(routes...)
+}
+
+// Replace removes every route before adding the routes
+func Replace(routes ...*Route) error {
+	return customRoutes.replace(routes...)
+}
+
+// Remove removes the methods of the route with the host, match and
+// path
+func Remove(host, match, path string, methods []string) error {
+	return customRoutes.remove(host, match, path, methods)
+}
+
+// Create adds the route with a new ID. ErrRouteConflict is returned if
+// another route has the host, path, match and one of the methods
+func Create(r *Route) error {
+	return customRoutes.create(r)
+}
+
+// Update replaces the route of the ID. ErrRouteConflict is returned if
+// another route has the host, path, match and one of the methods
+func Update(id string, r *Route) error {
+	return customRoutes.update(id, r)
+}
+
+// Delete removes the route of the ID
+func Delete(id string) error {
+	return customRoutes.delete(id)
+}
+
+// Get returns a copy of the route of the ID
+func Get(id string) (*Route, error) {
+	return customRoutes.get(id)
+}
+
+// List returns copies of the routes sorted by path, match, method and
+// host
+func List() []*Route {
+	return customRoutes.list()
+}
@@ -0,0 +1,424 @@
+package routes
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+)
+
+// restoreStore returns a store with the routes saved to file that is
+// served by the catch-all route of e
+func restoreStore(t *testing.T, e *echo.Echo, file string) *routeStore {
+	s := newRouteStore()
+	assert.NoError(t, s.restore(file))
+	e.Any("/*", func(c echo.Context) error {
+		if ok, err := s.serve(c); ok {
+			return err
+		}
+		return c.String(http.StatusNotFound, "catch-all")
+	})
+	return s
+}
+
+func serve(e *echo.Echo, method, path string) *httptest.ResponseRecorder {
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(method, path, nil))
+	return rec
+}
+
+func TestRouteStore(t *testing.T) {
+	e := echo.New()
+	s := restoreStore(t, e, "")
+	registered := len(e.Routes())
+
+	assert.NoError(t, s.add(&Route{
+		Path:    "/exploit",
+		Methods: []string{"get", "POST", "GET"},
+		Headers: map[string]string{"Content-Type": "text/plain"},
+		Body:    []byte("pwned"),
+	}))
+	assert.Error(t, s.add(&Route{Path: "/invalid", Methods: []string{"GET"}, Status: 42}))
+
+	rec := serve(e, http.MethodGet, "/exploit")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "pwned", rec.Body.String())
+	assert.Equal(t, "text/plain", rec.Header().Get("Content-Type"))
+
+	// adding a route for one method replaces it for that method only
+	assert.NoError(t, s.add(&Route{Path: "/exploit", Methods: []string{"POST"}, Status: http.StatusCreated}))
+	routes := s.list()
+	assert.Len(t, routes, 2)
+	assert.Equal(t, []string{"GET"}, routes[0].Methods)
+	assert.Equal(t, []string{"POST"}, routes[1].Methods)
+	assert.Equal(t, http.StatusCreated, serve(e, http.MethodPost, "/exploit").Code)
+
+	// removed routes are served by the catch-all and the router is
+	// unchanged
+	assert.NoError(t, s.remove("", "", "/exploit", []string{"GET", "POST"}))
+	assert.Empty(t, s.list())
+	rec = serve(e, http.MethodGet, "/exploit")
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+	assert.Equal(t, "catch-all", rec.Body.String())
+	assert.Len(t, e.Routes(), registered)
+
+	// built-in routes are not replaced by custom routes
+	e.GET("/healthz", func(c echo.Context) error { return c.String(http.StatusOK, "healthy") })
+	assert.NoError(t, s.add(&Route{Path: "/healthz", Methods: []string{"GET"}, Body: []byte("custom")}))
+	assert.Equal(t, "healthy", serve(e, http.MethodGet, "/healthz").Body.String())
+}
+
+func TestRouteStorePersistence(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "data", "routes.json")
+
+	s := restoreStore(t, echo.New(), file)
+	assert.NoError(t, s.add(
+		&Route{Path: "/a", Methods: []string{"GET"}, Body: []byte{0x00, 0xff}},
+		&Route{Path: "/b", Methods: []string{"PUT", "DELETE"}, Status: http.StatusTeapot},
+	))
+
+	// routes are restored by a new store
+	e := echo.New()
+	restored := restoreStore(t, e, file)
+	assert.Equal(t, s.list(), restored.list())
+	assert.Equal(t, []byte{0x00, 0xff}, serve(e, http.MethodGet, "/a").Body.Bytes())
+	assert.Equal(t, http.StatusTeapot, serve(e, http.MethodDelete, "/b").Code)
+
+	// replacing the routes removes the previous routes from the file
+	assert.NoError(t, restored.replace(&Route{Path: "/c", Methods: []string{"GET"}}))
+	restored = restoreStore(t, echo.New(), file)
+	routes := restored.list()
+	assert.Len(t, routes, 1)
+	assert.Equal(t, "/c", routes[0].Path)
+	assert.Equal(t, http.StatusOK, routes[0].Status)
+}
+
+func TestWriteRoute(t *testing.T) {
+	e := echo.New()
+	s := restoreStore(t, e, "")
+
+	jar := []byte{0x50, 0x4b, 0x03, 0x04, 0x00, 0x00}
+	assert.NoError(t, s.add(
+		&Route{Path: "/payload.jar", Methods: []string{"GET", "HEAD"}, Body: jar, Headers: map[string]string{
+			"content-type":   "application/java-archive",
+			"Content-Length": "1",
+		}},
+		&Route{Path: "/redirect", Methods: []string{"GET"}, Status: http.StatusFound, Headers: map[string]string{
+			"Location": "http://169.254.169.254/",
+		}},
+		&Route{Path: "/empty", Methods: []string{"GET"}, Status: http.StatusNoContent, Body: []byte("ignored")},
+		&Route{Path: "/page", Methods: []string{"GET"}, Body: []byte("<html><body></body></html>")},
+	))
+	assert.Error(t, s.add(&Route{Path: "/continue", Methods: []string{"GET"}, Status: http.StatusContinue}))
+
+	// binary bodies are served unchanged with their exact length
+	rec := serve(e, http.MethodGet, "/payload.jar")
+	assert.Equal(t, jar, rec.Body.Bytes())
+	assert.Equal(t, "application/java-archive", rec.Header().Get("Content-Type"))
+	assert.Equal(t, []string{"6"}, rec.Header()["Content-Length"])
+
+	rec = serve(e, http.MethodHead, "/payload.jar")
+	assert.Empty(t, rec.Body.Bytes())
+	assert.Equal(t, "6", rec.Header().Get("Content-Length"))
+
+	rec = serve(e, http.MethodGet, "/redirect")
+	assert.Equal(t, http.StatusFound, rec.Code)
+	assert.Equal(t, "http://169.254.169.254/", rec.Header().Get("Location"))
+
+	rec = serve(e, http.MethodGet, "/empty")
+	assert.Equal(t, http.StatusNoContent, rec.Code)
+	assert.Empty(t, rec.Body.Bytes())
+
+	// the content type is detected if it is unset
+	rec = serve(e, http.MethodGet, "/page")
+	assert.Equal(t, "text/html; charset=utf-8", rec.Header().Get("Content-Type"))
+}
+
+func TestRedirect(t *testing.T) {
+	e := echo.New()
+	e.IPExtractor = echo.ExtractIPDirect()
+	s := restoreStore(t, e, "")
+
+	assert.NoError(t, s.add(
+		&Route{Path: "/ssrf", Methods: []string{"GET"}, Redirect: &Redirect{
+			Target: "gopher://127.0.0.1:6379/_INFO",
+			Hops:   2,
+		}},
+		&Route{Path: "/validate", Methods: []string{"GET"}, Body: []byte("ok"), Redirect: &Redirect{
+			Target:    "http://169.254.169.254/",
+			Status:    http.StatusTemporaryRedirect,
+			Hops:      1,
+			After:     1,
+			PerClient: true,
+		}},
+	))
+	for _, r := range []*Redirect{
+		{Target: "/relative"},
+		{Target: "http://169.254.169.254/", Status: http.StatusOK},
+		{Target: "http://169.254.169.254/", Hops: maxRedirectHops + 1},
+	} {
+		assert.Error(t, s.add(&Route{Path: "/invalid", Methods: []string{"GET"}, Redirect: r}))
+	}
+
+	// requests hop through the route before the target
+	location := "/ssrf?hop=a"
+	for _, expected := range []string{
+		"http://example.com/ssrf?conspirator_hop=1.",
+		"http://example.com/ssrf?conspirator_hop=2.",
+		"gopher://127.0.0.1:6379/_INFO",
+	} {
+		rec := serve(e, http.MethodGet, location)
+		assert.Equal(t, http.StatusFound, rec.Code)
+		assert.True(t, strings.HasPrefix(rec.Header().Get("Location"), expected), rec.Header().Get("Location"))
+		location = strings.TrimPrefix(rec.Header().Get("Location"), "http://example.com")
+	}
+	// the query of the path is kept
+	assert.Contains(t, serve(e, http.MethodGet, "/ssrf?hop=a").Header().Get("Location"), "hop=a")
+
+	// the first request of each client is served the body
+	request := func(client string) *httptest.ResponseRecorder {
+		target := "/validate"
+		if i := strings.Index(client, "/"); i >= 0 {
+			client, target = client[:i], client[i:]
+		}
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, target, nil)
+		req.RemoteAddr = client + ":1234"
+		e.ServeHTTP(rec, req)
+		return rec
+	}
+	assert.Equal(t, "ok", request("192.0.2.1").Body.String())
+	assert.Equal(t, http.StatusTemporaryRedirect, request("192.0.2.1").Code)
+	assert.Equal(t, http.StatusOK, request("192.0.2.2").Code)
+	assert.Equal(t, http.StatusTemporaryRedirect, request("192.0.2.2").Code)
+
+	// unsigned hop counts are counted as first requests
+	for i, hop := range []string{"0", "1", "1.0000000000000000"} {
+		client := fmt.Sprintf("192.0.2.%d", 10+i)
+		assert.Equal(t, "ok", request(client+"/validate?conspirator_hop="+hop).Body.String(), hop)
+		assert.Equal(t, http.StatusTemporaryRedirect, request(client).Code, hop)
+	}
+}
+
+func TestTemplate(t *testing.T) {
+	viper.Set("domain", "test.example.com")
+	defer viper.Set("domain", nil)
+
+	e := echo.New()
+	e.IPExtractor = echo.ExtractIPDirect()
+	s := restoreStore(t, e, "")
+
+	assert.NoError(t, s.add(&Route{
+		Path:     "/reflect",
+		Methods:  []string{"POST"},
+		Template: true,
+		Body:     []byte(`{{ .Method }} {{ .InteractionID }} {{ .ClientIP }} {{ .Query.Get "q" | upper }} {{ .Headers.Get "X-Test" | b64enc }} {{ .Body | xml }}`),
+	}))
+	assert.NoError(t, s.add(&Route{Path: "/error", Methods: []string{"GET"}, Template: true, Body: []byte(`{{ "%" | b64dec }}`)}))
+	assert.Error(t, s.add(&Route{Path: "/invalid", Methods: []string{"GET"}, Template: true, Body: []byte("{{ .Unclosed ")}))
+	assert.Error(t, s.add(&Route{Path: "/invalid", Methods: []string{"GET"}, Template: true, Body: []byte(`{{ env "HOME" }}`)}))
+
+	req := httptest.NewRequest(http.MethodPost, "/reflect?q=payload", strings.NewReader("<a>"))
+	req.Host = "abc.test.example.com:80"
+	req.RemoteAddr = "192.0.2.1:1234"
+	req.Header.Set("X-Test", "value")
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	assert.Equal(t, "POST abc 192.0.2.1 PAYLOAD dmFsdWU= &lt;a&gt;", rec.Body.String())
+	assert.Equal(t, "text/plain; charset=utf-8", rec.Header().Get("Content-Type"))
+
+	assert.Equal(t, http.StatusInternalServerError, serve(e, http.MethodGet, "/error").Code)
+
+	assert.Equal(t, "", interactionID("test.example.com"))
+	assert.Equal(t, "b", interactionID("a.B.test.example.com."))
+}
+
+func TestHostRoutes(t *testing.T) {
+	e := echo.New()
+	s := restoreStore(t, e, "")
+
+	assert.NoError(t, s.add(
+		&Route{Path: "/exploit.dtd", Methods: []string{"GET"}, Body: []byte("any")},
+		&Route{Path: "/exploit.dtd", Methods: []string{"GET"}, Host: "*.xxe.example.com", Body: []byte("xxe")},
+		&Route{Path: "/exploit.dtd", Methods: []string{"GET"}, Host: "*.b.xxe.example.com", Body: []byte("b")},
+		&Route{Path: "/exploit.dtd", Methods: []string{"GET"}, Host: "A.b.xxe.example.com.", Body: []byte("a")},
+		&Route{Path: "/scoped", Methods: []string{"GET"}, Host: "only.example.com", Body: []byte("scoped")},
+	))
+	for _, host := range []string{"*", "a.*.example.com", "example.com/path"} {
+		assert.Error(t, s.add(&Route{Path: "/invalid", Methods: []string{"GET"}, Host: host}))
+	}
+
+	request := func(host, path string) string {
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.Host = host
+		e.ServeHTTP(rec, req)
+		return rec.Body.String()
+	}
+	assert.Equal(t, "a", request("a.b.xxe.example.com:8080", "/exploit.dtd"))
+	assert.Equal(t, "b", request("c.b.xxe.example.com", "/exploit.dtd"))
+	assert.Equal(t, "xxe", request("d.c.xxe.example.com", "/exploit.dtd"))
+	assert.Equal(t, "any", request("xxe.example.com", "/exploit.dtd"))
+	assert.Equal(t, "scoped", request("only.example.com", "/scoped"))
+	assert.NotEqual(t, "scoped", request("other.example.com", "/scoped"))
+
+	// routes are removed for their host only
+	assert.NoError(t, s.remove("a.b.xxe.example.com", "", "/exploit.dtd", []string{"GET"}))
+	assert.Equal(t, "b", request("a.b.xxe.example.com", "/exploit.dtd"))
+	assert.Len(t, s.list(), 4)
+}
+
+func TestPatternRoutes(t *testing.T) {
+	e := echo.New()
+	s := restoreStore(t, e, "")
+
+	assert.NoError(t, s.add(
+		&Route{Path: "/static/", Match: "prefix", Methods: []string{"GET"}, Template: true, Body: []byte("prefix {{ index .Groups 1 }}")},
+		&Route{Path: "/static/js/", Match: "prefix", Methods: []string{"GET"}, Body: []byte("longer prefix")},
+		&Route{Path: "/*.js", Match: "glob", Methods: []string{"GET"}, Template: true, Body: []byte("glob {{ index .Groups 1 }}")},
+		&Route{Path: "/deep/**/?.txt", Match: "glob", Methods: []string{"GET"}, Template: true, Body: []byte("{{ index .Groups 1 }} {{ index .Groups 2 }}")},
+		&Route{Path: `^/u/(?P<id>[0-9]+)$`, Match: "regex", Methods: []string{"GET"}, Template: true, Body: []byte("user {{ .NamedGroups.id }}")},
+		&Route{Path: "/exact.js", Methods: []string{"GET"}, Body: []byte("exact")},
+	))
+	assert.Error(t, s.add(&Route{Path: "(", Match: "regex", Methods: []string{"GET"}}))
+	assert.Error(t, s.add(&Route{Path: "*.js", Match: "glob", Methods: []string{"GET"}}))
+	assert.Error(t, s.add(&Route{Path: "/a", Match: "fuzzy", Methods: []string{"GET"}}))
+
+	for path, expected := range map[string]string{
+		"/exact.js":          "exact",
+		"/app.js":            "glob app",
+		"/a/app.js":          "catch-all",
+		"/static/img/a.png":  "prefix img/a.png",
+		"/static/js/a.js":    "longer prefix",
+		"/deep/a/b/c.txt":    "a/b c",
+		"/u/42":              "user 42",
+		"/u/42/posts":        "catch-all",
+		"/unmatched":         "catch-all",
+		"/static-not-prefix": "catch-all",
+	} {
+		assert.Equal(t, expected, serve(e, http.MethodGet, path).Body.String(), path)
+	}
+
+	assert.NoError(t, s.remove("", "glob", "/*.js", []string{"GET"}))
+	assert.Equal(t, "catch-all", serve(e, http.MethodGet, "/app.js").Body.String())
+}
+
+func TestLimitedRoutes(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "routes.json")
+	e := echo.New()
+	s := restoreStore(t, e, file)
+
+	now := time.Now()
+	expired := now.Add(-time.Second)
+	assert.NoError(t, s.add(
+		&Route{Path: "/once", Methods: []string{"GET"}, MaxHits: 1, Body: []byte("payload")},
+		&Route{Path: "/expired", Methods: []string{"GET"}, Expires: &expired, Body: []byte("payload")},
+		&Route{Path: "/ssrf", Methods: []string{"GET"}, MaxHits: 1, Redirect: &Redirect{Target: "http://169.254.169.254/", Hops: 2}},
+	))
+	assert.Error(t, s.add(&Route{Path: "/invalid", Methods: []string{"GET"}, MaxHits: -1}))
+
+	assert.Equal(t, "payload", serve(e, http.MethodGet, "/once").Body.String())
+	assert.NotEqual(t, "payload", serve(e, http.MethodGet, "/once").Body.String())
+	assert.NotEqual(t, "payload", serve(e, http.MethodGet, "/expired").Body.String())
+
+	// the hops of a one-shot redirect are not limited
+	location := "/ssrf"
+	for i := 0; i < 3; i++ {
+		rec := serve(e, http.MethodGet, location)
+		assert.Equal(t, http.StatusFound, rec.Code, location)
+		location = strings.TrimPrefix(rec.Header().Get("Location"), "http://example.com")
+	}
+	assert.Equal(t, "http://169.254.169.254/", location)
+	assert.Empty(t, serve(e, http.MethodGet, "/ssrf").Header().Get("Location"))
+
+	// hits are shown and saved
+	routes := restoreStore(t, echo.New(), file).list()
+	assert.Equal(t, "/expired", routes[0].Path)
+	assert.Equal(t, 0, routes[0].Hits)
+	assert.Equal(t, "/once", routes[1].Path)
+	assert.Equal(t, 1, routes[1].Hits)
+	assert.Equal(t, "/ssrf", routes[2].Path)
+	assert.Equal(t, 1, routes[2].Hits)
+}
+
+func TestProxyRoutes(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Server", "upstream")
+		w.Header().Set("X-Upstream-Path", r.URL.Path)
+		w.WriteHeader(http.StatusAccepted)
+		fmt.Fprintf(w, "%s %s %s %s", r.Method, r.Host, r.Header.Get("X-Token"), r.Header.Get("Cookie"))
+	}))
+	defer upstream.Close()
+
+	e := echo.New()
+	s := restoreStore(t, e, "")
+	assert.NoError(t, s.add(
+		&Route{
+			Path:    "/gen",
+			Methods: []string{"POST"},
+			Headers: map[string]string{"Server": "", "X-Proxied": "true"},
+			Proxy: &Proxy{
+				Upstream: upstream.URL + "/base",
+				Headers:  map[string]string{"X-Token": "secret", "Cookie": ""},
+			},
+		},
+		&Route{Path: "/host", Methods: []string{"GET"}, Proxy: &Proxy{Upstream: upstream.URL, PreserveHost: true}},
+		&Route{Path: "/down", Methods: []string{"GET"}, Proxy: &Proxy{Upstream: "http://127.0.0.1:1"}},
+	))
+	for _, r := range []*Route{
+		{Path: "/invalid", Methods: []string{"GET"}, Proxy: &Proxy{Upstream: "file:///etc/passwd"}},
+		{Path: "/invalid", Methods: []string{"GET"}, Proxy: &Proxy{Upstream: upstream.URL}, Template: true},
+	} {
+		assert.Error(t, s.add(r))
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/gen", strings.NewReader("body"))
+	req.Header.Set("Cookie", "session=1")
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusAccepted, rec.Code)
+	assert.Equal(t, "POST "+strings.TrimPrefix(upstream.URL, "http://")+" secret ", rec.Body.String())
+	assert.Equal(t, "/base/gen", rec.Header().Get("X-Upstream-Path"))
+	assert.Equal(t, "true", rec.Header().Get("X-Proxied"))
+	assert.Empty(t, rec.Header().Get("Server"))
+
+	assert.Equal(t, "GET example.com  ", serve(e, http.MethodGet, "/host").Body.String())
+	assert.Equal(t, http.StatusBadGateway, serve(e, http.MethodGet, "/down").Code)
+}
+
+func TestRouteIDs(t *testing.T) {
+	e := echo.New()
+	s := restoreStore(t, e, "")
+
+	r := &Route{ID: "ignored", Path: "/a", Methods: []string{"GET", "POST"}, Body: []byte("a")}
+	assert.NoError(t, s.create(r))
+	assert.NotEqual(t, "ignored", r.ID)
+	assert.NoError(t, s.create(&Route{Path: "/b", Methods: []string{"GET"}}))
+
+	// routes cannot be created or updated for the methods of another
+	// route
+	assert.ErrorIs(t, s.create(&Route{Path: "/a", Methods: []string{"POST"}}), ErrRouteConflict)
+	assert.ErrorIs(t, s.update(r.ID, &Route{Path: "/b", Methods: []string{"GET"}}), ErrRouteConflict)
+	assert.ErrorIs(t, s.update("unknown", &Route{Path: "/c", Methods: []string{"GET"}}), ErrRouteNotFound)
+	assert.ErrorIs(t, s.update(r.ID, &Route{Path: "/c"}), ErrInvalidRoute)
+
+	assert.NoError(t, s.update(r.ID, &Route{Path: "/a", Methods: []string{"GET"}, Body: []byte("updated")}))
+	updated, err := s.get(r.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"GET"}, updated.Methods)
+	assert.Equal(t, "updated", serve(e, http.MethodGet, "/a").Body.String())
+	assert.NotEqual(t, "a", serve(e, http.MethodPost, "/a").Body.String())
+
+	assert.NoError(t, s.delete(r.ID))
+	assert.ErrorIs(t, s.delete(r.ID), ErrRouteNotFound)
+	_, err = s.get(r.ID)
+	assert.ErrorIs(t, err, ErrRouteNotFound)
+	assert.Len(t, s.list(), 1)
+}
@@ -0,0 +1,622 @@
+package routes
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/rs/zerolog/log"
+)
+
+var (
+	// ErrInvalidRoute is wrapped by the validation errors of routes
+	ErrInvalidRoute = fmt.Errorf("Invalid route")
+	// ErrRouteNotFound is returned for unknown route IDs
+	ErrRouteNotFound = fmt.Errorf("Route not found")
+	// ErrRouteConflict is returned when a route is created for a
+	// host, path and method of another route
+	ErrRouteConflict = fmt.Errorf("Route conflicts with an existing route")
+)
+
+// Route is a custom response served at Path for each of the Methods.
+// The body is served unchanged with a Content-Length of its size
+type Route struct {
+	ID string `json:"id"` // Assigned when the route is added
+	// Host optionally limits the route to a host, e.g. a.example.com,
+	// or the subdomains of a wildcard, e.g. *.xxe.example.com
+	Host string `json:"host,omitempty"`
+	Path string `json:"path"`
+	// Match is how the Path matches the request path: exact, prefix,
+	// glob or regex. Defaults to exact
+	Match   string   `json:"match,omitempty"`
+	Methods []string `json:"methods"`
+	// Headers are added to the response. The Content-Type is detected
+	// from the body if it is not set
+	Headers map[string]string `json:"headers,omitempty"`
+	Body    []byte            `json:"body"`   // base64 encoded in JSON
+	Status  int               `json:"status"` // Optional. Defaults to 200
+	// Redirect optionally redirects the requests instead of serving
+	// the body
+	Redirect *Redirect `json:"redirect,omitempty"`
+	// Proxy optionally forwards the requests to an upstream service
+	// instead of serving the body
+	Proxy *Proxy `json:"proxy,omitempty"`
+	// Template renders the body as a text/template with the
+	// TemplateRequest of each request
+	Template bool `json:"template,omitempty"`
+	// MaxHits optionally serves the route to the first requests only,
+	// e.g. for stage-once payloads. Later requests are served the
+	// default response
+	MaxHits int `json:"maxHits,omitempty"`
+	// Expires optionally serves the default response after the time
+	Expires *time.Time `json:"expires,omitempty"`
+	Hits    int        `json:"hits"` // requests served by the route
+
+	tmpl    *template.Template
+	pattern *regexp.Regexp
+}
+
+// routeKey maps a host pattern, match type, path and method to a
+// route. An empty host matches any host
+type routeKey struct {
+	host   string
+	match  string
+	path   string
+	method string
+}
+
+// routeStore maps the host, path and method of the custom routes to
+// the route and saves the routes to file when they change. A route
+// added with multiple methods is shared by each of them. The store is
+// the router of the custom routes: requests are matched against it by
+// the catch-all route, so routes are added, replaced and removed
+// without changing the Echo router
+type routeStore struct {
+	mutex  *sync.RWMutex
+	routes map[routeKey]*Route
+	ids    map[string]*Route
+	file   string
+}
+
+var customRoutes = newRouteStore()
+
+func newRouteStore() *routeStore {
+	return &routeStore{
+		mutex:  &sync.RWMutex{},
+		routes: make(map[routeKey]*Route),
+		ids:    make(map[string]*Route),
+	}
+}
+
+// validateRoute checks the route, removes duplicate methods and sets
+// the default status
+func validateRoute(r *Route) error {
+	if r.Path == "" || len(r.Methods) == 0 {
+		return fmt.Errorf("%w: path and methods cannot be null", ErrInvalidRoute)
+	}
+
+	methods := make([]string, 0, len(r.Methods))
+	seen := make(map[string]bool)
+	for _, m := range r.Methods {
+		m = strings.ToUpper(strings.TrimSpace(m))
+		if m == "" {
+			return fmt.Errorf("%w: methods cannot be null", ErrInvalidRoute)
+		}
+		if !seen[m] {
+			seen[m] = true
+			methods = append(methods, m)
+		}
+	}
+	r.Methods = methods
+
+	if err := validateMatch(r); err != nil {
+		return err
+	}
+
+	r.Host = normalizeHost(r.Host)
+	if strings.Contains(strings.TrimPrefix(r.Host, "*."), "*") || strings.Contains(r.Host, "/") {
+		return fmt.Errorf("%w: invalid host %s", ErrInvalidRoute, r.Host)
+	}
+
+	if r.MaxHits < 0 || r.Hits < 0 {
+		return fmt.Errorf("%w: maxHits and hits cannot be negative", ErrInvalidRoute)
+	}
+
+	if r.Status == 0 {
+		r.Status = http.StatusOK
+	}
+	// 1xx responses are informational and cannot be the response
+	if r.Status < 200 || r.Status > 599 {
+		return fmt.Errorf("%w: invalid status %d", ErrInvalidRoute, r.Status)
+	}
+	if r.Template {
+		var err error
+		if r.tmpl, err = parseTemplate(r.Body); err != nil {
+			return err
+		}
+	}
+	if r.Proxy != nil {
+		if err := validateProxy(r); err != nil {
+			return err
+		}
+	}
+	if r.Redirect != nil {
+		return validateRedirect(r.Redirect)
+	}
+	return nil
+}
+
+// restore loads the routes saved in the file. A missing file is not
+// an error
+func (s *routeStore) restore(file string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.file = file
+	if file == "" {
+		return nil
+	}
+
+	data, err := ioutil.ReadFile(file)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	var routes []*Route
+	if err := json.Unmarshal(data, &routes); err != nil {
+		return err
+	}
+
+	for _, r := range routes {
+		if err := validateRoute(r); err != nil {
+			return err
+		}
+		s.put(r)
+	}
+	log.Info().Msgf("restored %d custom routes from %s", len(routes), file)
+
+	return nil
+}
+
+// add adds the routes and replaces the routes of other IDs for each
+// of their methods
+func (s *routeStore) add(routes ...*Route) error {
+	for _, r := range routes {
+		if err := validateRoute(r); err != nil {
+			return err
+		}
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for _, r := range routes {
+		s.put(r)
+	}
+	return s.save()
+}
+
+// replace removes every route before adding the routes
+func (s *routeStore) replace(routes ...*Route) error {
+	for _, r := range routes {
+		if err := validateRoute(r); err != nil {
+			return err
+		}
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.routes = make(map[routeKey]*Route)
+	s.ids = make(map[string]*Route)
+	for _, r := range routes {
+		s.put(r)
+	}
+	return s.save()
+}
+
+// remove removes the methods of the route at the host, match type
+// and path
+func (s *routeStore) remove(host, match, path string, methods []string) error {
+	if match == MatchExact {
+		match = ""
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for _, m := range methods {
+		s.unset(routeKey{host: normalizeHost(host), match: match, path: path, method: strings.ToUpper(m)})
+	}
+	return s.save()
+}
+
+// create adds the route with a new ID unless another route has the
+// host, path and method
+func (s *routeStore) create(r *Route) error {
+	if err := validateRoute(r); err != nil {
+		return err
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	r.ID = ""
+	if err := s.conflicts(r, nil); err != nil {
+		return err
+	}
+	s.put(r)
+	return s.save()
+}
+
+// update replaces the route of the ID unless another route has the
+// host, path and method of r
+func (s *routeStore) update(id string, r *Route) error {
+	if err := validateRoute(r); err != nil {
+		return err
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	old, ok := s.ids[id]
+	if !ok {
+		return ErrRouteNotFound
+	}
+	if err := s.conflicts(r, old); err != nil {
+		return err
+	}
+
+	r.ID = id
+	s.put(r)
+	return s.save()
+}
+
+// delete removes the route of the ID
+func (s *routeStore) delete(id string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	r, ok := s.ids[id]
+	if !ok {
+		return ErrRouteNotFound
+	}
+	s.drop(r)
+	return s.save()
+}
+
+// get returns a copy of the route of the ID
+func (s *routeStore) get(id string) (*Route, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	r, ok := s.ids[id]
+	if !ok {
+		return nil, ErrRouteNotFound
+	}
+	return r.copy(), nil
+}
+
+// conflicts returns an error if a route other than old has the host,
+// path and method of r. The lock must be held
+func (s *routeStore) conflicts(r, old *Route) error {
+	for _, m := range r.Methods {
+		if other, ok := s.routes[routeKey{host: r.Host, match: r.Match, path: r.Path, method: m}]; ok && other != old {
+			return fmt.Errorf("%w: %s %s is served by route %s", ErrRouteConflict, m, r.Path, other.ID)
+		}
+	}
+	return nil
+}
+
+// find returns the route matching the path and method of the most
+// specific host pattern matching the host, and the groups captured
+// from the path. Exact paths are tried before prefixes from the
+// longest, globs and regexes
+func (s *routeStore) find(host, path, method string) (*Route, []string, bool) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	for _, h := range hostPatterns(normalizeHost(host)) {
+		if r, ok := s.routes[routeKey{host: h, path: path, method: method}]; ok {
+			return r, []string{path}, true
+		}
+
+		var match *Route
+		var groups []string
+		for k, r := range s.routes {
+			if k.host != h || k.method != method || k.match == "" || !morePrecise(r, match) {
+				continue
+			}
+			if g, ok := r.matchPath(path); ok {
+				match, groups = r, g
+			}
+		}
+		if match != nil {
+			return match, groups, true
+		}
+	}
+
+	return nil, nil, false
+}
+
+// morePrecise reports whether r is tried before the route b
+func morePrecise(r, b *Route) bool {
+	switch {
+	case b == nil:
+		return true
+	case r.Match != b.Match:
+		return matchOrder[r.Match] < matchOrder[b.Match]
+	case r.Match == MatchPrefix && len(r.Path) != len(b.Path):
+		return len(r.Path) > len(b.Path)
+	default:
+		return r.Path < b.Path
+	}
+}
+
+// list returns copies of the routes sorted by path, match, method and
+// host, since the routes change while they are served
+func (s *routeStore) list() []*Route {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	routes := s.sorted()
+	for i, r := range routes {
+		routes[i] = r.copy()
+	}
+	return routes
+}
+
+// copy returns a copy of the route that is not changed by the store
+func (r *Route) copy() *Route {
+	cp := *r
+	cp.Methods = append([]string{}, r.Methods...)
+	return &cp
+}
+
+// hit counts a request of the route and reports whether the route
+// serves it. Hits of limited routes are saved, so that a restart does
+// not serve a one-shot route again
+func (s *routeStore) hit(r *Route, now time.Time) bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if (r.Expires != nil && !now.Before(*r.Expires)) || (r.MaxHits > 0 && r.Hits >= r.MaxHits) {
+		return false
+	}
+
+	r.Hits++
+	if r.MaxHits > 0 {
+		if err := s.save(); err != nil {
+			log.Error().Msgf("failed to save hits of route %s: %v", r.Path, err)
+		}
+	}
+	return true
+}
+
+// put maps each method of the route to it. The lock must be held
+func (s *routeStore) put(r *Route) {
+	// a route with the ID of another route replaces it
+	if r.ID == "" {
+		r.ID = newID()
+	} else if old, ok := s.ids[r.ID]; ok && old != r {
+		s.drop(old)
+	}
+	s.ids[r.ID] = r
+
+	for _, m := range r.Methods {
+		key := routeKey{host: r.Host, match: r.Match, path: r.Path, method: m}
+		if old, ok := s.routes[key]; ok && old != r {
+			s.unset(key)
+		}
+		s.routes[key] = r
+	}
+}
+
+// drop removes every method of the route. The lock must be held
+func (s *routeStore) drop(r *Route) {
+	for _, m := range r.Methods {
+		s.unset(routeKey{host: r.Host, match: r.Match, path: r.Path, method: m})
+	}
+	delete(s.ids, r.ID)
+}
+
+// unset removes the method from the route of the key and removes
+// routes without methods. The lock must be held
+func (s *routeStore) unset(key routeKey) {
+	r, ok := s.routes[key]
+	if !ok {
+		return
+	}
+	delete(s.routes, key)
+
+	methods := make([]string, 0, len(r.Methods))
+	for _, m := range r.Methods {
+		if m != key.method {
+			methods = append(methods, m)
+		}
+	}
+	r.Methods = methods
+	if len(methods) == 0 {
+		delete(s.ids, r.ID)
+	}
+}
+
+// newID returns a random route ID
+func newID() string {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		log.Fatal().Msgf("failed to generate route ID: %v", err)
+	}
+	return hex.EncodeToString(b)
+}
+
+// sorted returns each route once, sorted by path, match, method and
+// host.
+// The lock must be held
+func (s *routeStore) sorted() []*Route {
+	keys := make([]routeKey, 0, len(s.routes))
+	for k := range s.routes {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].path != keys[j].path {
+			return keys[i].path < keys[j].path
+		}
+		if keys[i].match != keys[j].match {
+			return matchOrder[keys[i].match] < matchOrder[keys[j].match]
+		}
+		if keys[i].method != keys[j].method {
+			return keys[i].method < keys[j].method
+		}
+		return keys[i].host < keys[j].host
+	})
+
+	routes := []*Route{}
+	seen := make(map[*Route]bool)
+	for _, k := range keys {
+		if r := s.routes[k]; !seen[r] {
+			seen[r] = true
+			routes = append(routes, r)
+		}
+	}
+
+	return routes
+}
+
+// save writes the routes to a temporary file that replaces the file,
+// so that a failed write does not lose the saved routes. The lock
+// must be held
+func (s *routeStore) save() error {
+	if s.file == "" {
+		return nil
+	}
+
+	data, err := json.MarshalIndent(s.sorted(), "", "    ")
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(s.file), 0700); err != nil {
+		return err
+	}
+
+	tmp, err := ioutil.TempFile(filepath.Dir(s.file), filepath.Base(s.file)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), s.file)
+}
+
+// serve writes the route matching the request and reports whether a
+// route matched. Redirect hops were counted by the first request, so
+// they are neither counted nor limited
+func (s *routeStore) serve(c echo.Context) (bool, error) {
+	req := c.Request()
+	r, groups, ok := s.find(req.Host, req.URL.Path, req.Method)
+	if !ok || (hop(c, r) == 0 && !s.hit(r, time.Now())) {
+		return false, nil
+	}
+	return true, writeRoute(c, r, groups)
+}
+
+// Serve writes the custom route matching the request and reports
+// whether a route matched. Custom routes are only served by Serve, so
+// it is called by the catch-all route, which serves the default
+// response if no route matched
+func Serve(c echo.Context) (bool, error) {
+	return customRoutes.serve(c)
+}
+
+// writeRoute writes the status, headers and body of the route. The
+// Content-Type and Content-Length are set exactly once, since a
+// duplicate or wrong length header breaks binary bodies
+func writeRoute(c echo.Context, r *Route, groups []string) error {
+	if r.Proxy != nil {
+		return writeProxy(c, r)
+	}
+
+	if r.Redirect != nil {
+		if redirected, err := writeRedirect(c, r); redirected {
+			return err
+		}
+	}
+
+	header := c.Response().Header()
+	contentType := ""
+	for h, v := range r.Headers {
+		switch {
+		case strings.EqualFold(h, echo.HeaderContentType):
+			contentType = v
+		case strings.EqualFold(h, echo.HeaderContentLength):
+		default:
+			header.Add(h, v)
+		}
+	}
+
+	if !bodyAllowed(r.Status) {
+		return c.NoContent(r.Status)
+	}
+
+	body := r.Body
+	if r.tmpl != nil {
+		var err error
+		if body, err = renderTemplate(c, r, groups); err != nil {
+			log.Error().Msgf("failed to render template of route %s: %v", r.Path, err)
+			return c.NoContent(http.StatusInternalServerError)
+		}
+	}
+
+	if contentType == "" {
+		contentType = http.DetectContentType(body)
+	}
+	header.Set(echo.HeaderContentType, contentType)
+	header.Set(echo.HeaderContentLength, strconv.Itoa(len(body)))
+
+	c.Response().WriteHeader(r.Status)
+	if c.Request().Method == http.MethodHead {
+		return nil
+	}
+	_, err := c.Response().Write(body)
+	return err
+}
+
+// bodyAllowed reports whether a response with the status may have a
+// body
+func bodyAllowed(status int) bool {
+	return status != http.StatusNoContent && status != http.StatusNotModified
+}
+
+// normalizeHost removes the port and the trailing dot of the host
+func normalizeHost(host string) string {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	return strings.TrimSuffix(strings.ToLower(host), ".")
+}
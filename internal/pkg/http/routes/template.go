@@ -0,0 +1,153 @@
+package routes
+
+import (
+	"bytes"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"text/template"
+
+	"github.com/labstack/echo/v4"
+	"github.com/spf13/viper"
+)
+
+// Template limits
+const (
+	maxTemplateOutput      = 10 << 20
+	maxTemplateRequestBody = 1 << 20
+)
+
+var (
+	invalidTemplate  error = fmt.Errorf("%w: template", ErrInvalidRoute)
+	templateTooLarge error = fmt.Errorf("Template output exceeds %d bytes", maxTemplateOutput)
+)
+
+// templateFuncs are the functions available to route templates in
+// addition to the text/template builtins. Functions cannot access
+// files, the environment or the network
+var templateFuncs = template.FuncMap{
+	"b64enc": func(s string) string { return base64.StdEncoding.EncodeToString([]byte(s)) },
+	"b64dec": func(s string) (string, error) {
+		b, err := base64.StdEncoding.DecodeString(s)
+		return string(b), err
+	},
+	"hex":     func(s string) string { return hex.EncodeToString([]byte(s)) },
+	"md5":     func(s string) string { return fmt.Sprintf("%x", md5.Sum([]byte(s))) },
+	"sha256":  func(s string) string { return fmt.Sprintf("%x", sha256.Sum256([]byte(s))) },
+	"lower":   strings.ToLower,
+	"upper":   strings.ToUpper,
+	"trim":    strings.TrimSpace,
+	"replace": func(s, old, new string) string { return strings.ReplaceAll(s, old, new) },
+	"xml": func(s string) string {
+		var b strings.Builder
+		xml.EscapeText(&b, []byte(s))
+		return b.String()
+	},
+	"default": func(d, s string) string {
+		if s == "" {
+			return d
+		}
+		return s
+	},
+}
+
+// TemplateRequest is the data of a route template. Query and Headers
+// are copies of the request, e.g. {{ .Headers.Get "User-Agent" }} or
+// {{ .Query.Get "id" }}
+type TemplateRequest struct {
+	Method        string
+	Scheme        string
+	Host          string
+	Path          string
+	Query         url.Values
+	Headers       http.Header
+	Body          string // the first MiB of the request body
+	ClientIP      string
+	InteractionID string // the label of Host before the domain
+	// Groups are the path followed by the groups captured by the route
+	// path, e.g. {{ index .Groups 1 }}
+	Groups []string
+	// NamedGroups are the named groups of a regex path, e.g.
+	// {{ .NamedGroups.id }} for (?P<id>[0-9]+)
+	NamedGroups map[string]string
+}
+
+// parseTemplate parses the body of the route
+func parseTemplate(body []byte) (*template.Template, error) {
+	t, err := template.New("route").Funcs(templateFuncs).Parse(string(body))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", invalidTemplate, err)
+	}
+	return t, nil
+}
+
+// limitedWriter fails writes beyond the limit
+type limitedWriter struct {
+	bytes.Buffer
+	limit int
+}
+
+// Write implements io.Writer
+func (w *limitedWriter) Write(b []byte) (int, error) {
+	if w.Len()+len(b) > w.limit {
+		return 0, templateTooLarge
+	}
+	return w.Buffer.Write(b)
+}
+
+// renderTemplate executes the template of the route with the request
+// and the groups captured from the path
+func renderTemplate(c echo.Context, r *Route, groups []string) ([]byte, error) {
+	req := c.Request()
+
+	var body []byte
+	if req.Body != nil {
+		var err error
+		if body, err = ioutil.ReadAll(io.LimitReader(req.Body, maxTemplateRequestBody)); err != nil {
+			return nil, err
+		}
+		// the remaining body is still available to later readers
+		req.Body = ioutil.NopCloser(io.MultiReader(bytes.NewReader(body), req.Body))
+	}
+
+	data := &TemplateRequest{
+		Method:        req.Method,
+		Scheme:        c.Scheme(),
+		Host:          req.Host,
+		Path:          req.URL.Path,
+		Query:         req.URL.Query(),
+		Headers:       req.Header.Clone(),
+		Body:          string(body),
+		ClientIP:      c.RealIP(),
+		InteractionID: interactionID(req.Host),
+		Groups:        groups,
+		NamedGroups:   r.namedGroups(groups),
+	}
+
+	w := &limitedWriter{limit: maxTemplateOutput}
+	if err := r.tmpl.Execute(w, data); err != nil {
+		return nil, err
+	}
+	return w.Bytes(), nil
+}
+
+// interactionID returns the label of the host before the domain, e.g.
+// abc for abc.test.example.com
+func interactionID(host string) string {
+	host = normalizeHost(host)
+	domain := strings.ToLower(viper.GetString("domain"))
+	if domain == "" || !strings.HasSuffix(host, "."+domain) {
+		return ""
+	}
+
+	labels := strings.Split(strings.TrimSuffix(host, "."+domain), ".")
+	return labels[len(labels)-1]
+}
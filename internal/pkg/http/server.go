@@ -23,8 +23,10 @@ import (
 
 	"github.com/tmoneypenny/conspirator/internal/pkg/encoding"
 	apiv1 "github.com/tmoneypenny/conspirator/internal/pkg/http/api/v1"
+	apiv2 "github.com/tmoneypenny/conspirator/internal/pkg/http/api/v2"
 	"github.com/tmoneypenny/conspirator/internal/pkg/http/controller"
 	interaction "github.com/tmoneypenny/conspirator/internal/pkg/http/middleware"
+	"github.com/tmoneypenny/conspirator/internal/pkg/http/routes"
 	"github.com/tmoneypenny/conspirator/internal/pkg/polling"
 )
 
@@ -85,16 +87,18 @@ func newServer(spec *HTTPServerConfig) *server {
 	pollingRegex = regexp.MustCompile(fmt.Sprintf(`^(%s[\.]{1})[^\.].*`, *spec.PollingDomain))
 
 	if spec.TLS != nil {
-		cert, err := tls.LoadX509KeyPair(*spec.TLS.CertFile, *spec.TLS.KeyFile)
-		if err != nil {
-			log.Fatal().Msgf("Cannot load KeyPair: %v", err)
+		tlsConfig := &tls.Config{GetCertificate: spec.TLS.GetCertificate}
+		if spec.TLS.GetCertificate == nil {
+			cert, err := tls.LoadX509KeyPair(*spec.TLS.CertFile, *spec.TLS.KeyFile)
+			if err != nil {
+				log.Fatal().Msgf("Cannot load KeyPair: %v", err)
+			}
+			tlsConfig.Certificates = []tls.Certificate{cert}
 		}
 
 		server.HTTP.TLSServer = &http.Server{
-			TLSConfig: &tls.Config{
-				Certificates: []tls.Certificate{cert},
-			},
-			Addr: fmt.Sprintf("%s:%d", *spec.Address, *spec.TLS.Port),
+			TLSConfig: tlsConfig,
+			Addr:      fmt.Sprintf("%s:%d", *spec.Address, *spec.TLS.Port),
 		}
 	}
 	return server
@@ -128,24 +132,8 @@ func (s *server) startListeners() {
 	s.HTTP.Use(interaction.InteractionMiddleware(interaction.InteractionConfig{
 		Polling:    s.PollingManager,
 		Marshaller: s.Marshaller,
-		Skipper: func(c echo.Context) bool {
-			reqHost, _, err := net.SplitHostPort(c.Request().Host)
-			if err != nil {
-				reqHost = c.Request().Host
-			}
-
-			if pollingRegex.MatchString(reqHost) {
-				return true
-			}
-
-			if strings.HasPrefix(c.Path(), "/admin") ||
-				strings.HasPrefix(c.Path(), "/api/v1") {
-				return true
-			}
-
-			return false
-		},
-		Version: apiVersion,
+		Skipper:    skipInteraction,
+		Version:    apiVersion,
 	}))
 
 	// Start HTTP
@@ -199,7 +187,8 @@ func (s *server) setupRouter() {
 	s.HTTP.Renderer = templateRenderer
 
 	// API
-	apiv1.Router(s.HTTP)
+	apiv1.Router(s.HTTP, viper.GetString("http.routesFile"))
+	apiv2.Router(s.HTTP)
 
 	// Controllers
 	controller.Router(s.HTTP)
@@ -267,11 +256,38 @@ func (s *server) setupRouter() {
 				}
 			}
 		}
+		// custom routes are served by the catch-all, so that removed
+		// routes serve the default response
+		if ok, err := routes.Serve(c); ok {
+			return err
+		}
+
 		s.defaultResponder(c)
 		return
 	})
 }
 
+// skipInteraction reports whether the request is not an interaction:
+// polling, the admin UI and every API version, whose requests carry
+// the bearer token and route payloads
+func skipInteraction(c echo.Context) bool {
+	reqHost, _, err := net.SplitHostPort(c.Request().Host)
+	if err != nil {
+		reqHost = c.Request().Host
+	}
+
+	if pollingRegex.MatchString(reqHost) {
+		return true
+	}
+
+	if strings.HasPrefix(c.Path(), "/admin") ||
+		strings.HasPrefix(c.Path(), "/api/") {
+		return true
+	}
+
+	return false
+}
+
 func (s *server) pollingResults() ([]byte, error) {
 	events := s.PollingManager.GetAll()
 	if len(events) == 0 {
@@ -0,0 +1,52 @@
+package http
+
+import (
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/tmoneypenny/conspirator/internal/pkg/encoding"
+	interaction "github.com/tmoneypenny/conspirator/internal/pkg/http/middleware"
+	"github.com/tmoneypenny/conspirator/internal/pkg/polling"
+)
+
+func TestSkipInteraction(t *testing.T) {
+	pollingRegex = regexp.MustCompile(`^(polling[\.]{1})[^\.].*`)
+	pm := polling.New(&polling.PollingConfig{MaxBufferSize: 10}).Start()
+	defer pm.Stop()
+
+	e := echo.New()
+	e.Use(interaction.InteractionMiddleware(interaction.InteractionConfig{
+		Polling:    pm,
+		Marshaller: encoding.NewMarshaller(encoding.Format("burp")),
+		Skipper:    skipInteraction,
+	}))
+	ok := func(c echo.Context) error { return c.String(http.StatusOK, "payload") }
+	e.GET("/api/v1/showRoutes", ok)
+	e.GET("/api/v2/routes", ok)
+	e.GET("/admin/home", ok)
+	e.Any("/*", ok)
+
+	for _, path := range []string{"/api/v1/showRoutes", "/api/v2/routes", "/admin/home", "/exploit"} {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.Header.Set("Authorization", "Bearer secret-token")
+		e.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	// only the catch-all request is published
+	var events []*polling.Event
+	assert.Eventually(t, func() bool {
+		events = pm.ReadAll()
+		return len(events) > 0
+	}, time.Second, 10*time.Millisecond)
+	// wait for any event of the skipped requests
+	time.Sleep(50 * time.Millisecond)
+	events = pm.ReadAll()
+	assert.Len(t, events, 1)
+	assert.Contains(t, string(events[0].Data.([]byte)), base64.StdEncoding.EncodeToString([]byte("GET /exploit")))
+}
@@ -1,6 +1,9 @@
 package wrapper
 
-import "github.com/tmoneypenny/conspirator/internal/pkg/polling"
+import (
+	"github.com/tmoneypenny/conspirator/internal/pkg/certs"
+	"github.com/tmoneypenny/conspirator/internal/pkg/polling"
+)
 
 type Module interface {
 	Start()
@@ -10,5 +13,8 @@ type Module interface {
 type Config struct {
 	PollingManager *polling.PollingServer
 	PublicAddress  string
-	Cfg            map[string]interface{}
+	// Certificates reloads the key pairs of TLS listeners and
+	// provides the certificates of the server, e.g. from ACME
+	Certificates *certs.Manager
+	Cfg          map[string]interface{}
 }
@@ -3,6 +3,7 @@ package main
 import (
 	"github.com/rs/zerolog/log"
 	"github.com/spf13/viper"
+	"github.com/tmoneypenny/conspirator/internal/pkg/certs"
 	"github.com/tmoneypenny/conspirator/internal/pkg/polling"
 	"github.com/tmoneypenny/conspirator/pkg/config"
 	"github.com/tmoneypenny/conspirator/pkg/wrapper"
@@ -32,8 +33,9 @@ func buildSpecFromConfig() *LDAPConfig {
 		})
 
 		if tls != nil {
-			cert := tls.(map[string]interface{})["publicKey"].(string)
-			pk := tls.(map[string]interface{})["privateKey"].(string)
+			// the key pair is optional if ACME provides certificates
+			cert, _ := tls.(map[string]interface{})["publicKey"].(string)
+			pk, _ := tls.(map[string]interface{})["privateKey"].(string)
 			ldapConfig.Configs[i].TLS = &TLSConfig{
 				CertFile: &cert,
 				KeyFile:  &pk,
@@ -73,6 +75,7 @@ type LDAPConfig struct {
 	Configs        []LDAPServerConfig
 	PollingManager *polling.PollingServer
 	PublicAddress  string
+	Certificates   *certs.Manager
 }
 
 // LDAPServerConfig contains fields necessary to build
@@ -105,6 +108,7 @@ func NewServer(cfg wrapper.Config) wrapper.Module {
 
 	ldapConfig.PollingManager = cfg.PollingManager
 	ldapConfig.PublicAddress = cfg.PublicAddress
+	ldapConfig.Certificates = cfg.Certificates
 
 	ldapFacade := &Server{
 		listener: newServer(ldapConfig),
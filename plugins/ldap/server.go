@@ -1,6 +1,7 @@
 package main
 
 import (
+	"crypto/tls"
 	"fmt"
 	"net"
 	"strings"
@@ -9,6 +10,7 @@ import (
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promauto"
 	"github.com/rs/zerolog/log"
+	"github.com/tmoneypenny/conspirator/internal/pkg/certs"
 	"github.com/tmoneypenny/conspirator/internal/pkg/encoding"
 	"github.com/tmoneypenny/conspirator/internal/pkg/polling"
 	"github.com/tmoneypenny/conspirator/internal/pkg/util"
@@ -32,6 +34,8 @@ type server struct {
 	PublicAddress string
 	Marshaller    *encoding.Marshal
 	ServerConfigs []LDAPServerConfig
+	// Certificates reloads the key pairs of LDAPs listeners
+	Certificates *certs.Manager
 }
 
 type handler struct {
@@ -49,6 +53,7 @@ func newServer(specs *LDAPConfig) *server {
 		DNs:           specs.DNs,
 		LDAP:          ldap.NewServer(),
 		ServerConfigs: specs.Configs,
+		Certificates:  specs.Certificates,
 	}
 }
 
@@ -71,11 +76,11 @@ func (s *server) startListeners() {
 		log.Info().Msgf("Starting LDAP listener %v:%d", *s.ServerConfigs[i].Address, *s.ServerConfigs[i].Port)
 		go func(svr LDAPServerConfig) {
 			if svr.TLS != nil {
-				if err := s.LDAP.ListenAndServeTLS(
-					fmt.Sprintf("%s:%d", *svr.Address, *svr.Port),
-					*svr.TLS.CertFile,
-					*svr.TLS.KeyFile,
-				); err != nil {
+				ln, err := tls.Listen("tcp", fmt.Sprintf("%s:%d", *svr.Address, *svr.Port), s.tlsConfig(svr.TLS))
+				if err != nil {
+					log.Fatal().Msgf("failed to start LDAPs: %s", err.Error())
+				}
+				if err := s.LDAP.Serve(ln); err != nil {
 					log.Fatal().Msgf("failed to start LDAPs: %s", err.Error())
 				}
 			} else {
@@ -90,6 +95,25 @@ func (s *server) startListeners() {
 	log.Info().Msg("LDAP listeners started")
 }
 
+// tlsConfig loads the key pair of the listener. The certificate
+// manager of the server reloads the key pair when it changes and
+// makes it optional if ACME provides the certificates
+func (s *server) tlsConfig(cfg *TLSConfig) *tls.Config {
+	if s.Certificates != nil {
+		getCertificate, err := s.Certificates.Listener(*cfg.CertFile, *cfg.KeyFile)
+		if err != nil {
+			log.Fatal().Msgf("failed to load LDAPs key pair: %s", err.Error())
+		}
+		return &tls.Config{GetCertificate: getCertificate}
+	}
+
+	cert, err := tls.LoadX509KeyPair(*cfg.CertFile, *cfg.KeyFile)
+	if err != nil {
+		log.Fatal().Msgf("failed to load LDAPs key pair: %s", err.Error())
+	}
+	return &tls.Config{Certificates: []tls.Certificate{cert}}
+}
+
 func (s *server) stopListeners() {
 	s.LDAP.QuitChannel(s.LDAP.Quit)
 }